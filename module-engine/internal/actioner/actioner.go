@@ -1,6 +1,10 @@
 package actioner
 
-import "github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+import (
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/client-go/dynamic"
+)
 
 // Actioner визначає інтерфейс для виконання дій та отримання їх назв.
 type Actioner interface {
@@ -8,11 +12,58 @@ type Actioner interface {
 	Name() string            // Name повертає назву дії.
 }
 
+// Reverter - необов'язкова можливість діяча скасувати виконану дію.
+// Для діячів, що її реалізують, Revert викликається після закінчення блокування або при ручному розблокуванні.
+type Reverter interface {
+	Revert(ip string) error // Revert скасовує дію, виконану для заданого IP.
+}
+
+// Incident - сценарій та інцидент, для яких виконується дія.
+type Incident struct {
+	Scenario string // Назва сценарію
+	ID       string // Ідентифікатор інциденту (порожній для дій поза інцидентом)
+}
+
+// IncidentExecutor - необов'язкова можливість діяча отримати сценарій та інцидент дії,
+// наприклад, щоб записати їх в опис створеного правила. Для таких діячів замість Execute викликається ExecuteIncident.
+type IncidentExecutor interface {
+	ExecuteIncident(ip string, incident Incident) error // ExecuteIncident виконує дію для IP в контексті інциденту.
+}
+
+// BlockScoper - необов'язкова можливість діяча назвати об'єкт блокування (правило, елемент набору, політику),
+// яким блокується IP. Кілька IP з однаковим об'єктом (наприклад, адреси однієї мережі при prefix_v4 < 32)
+// блокуються спільно: Revert для одного з них не викликається, доки заблоковано інші.
+type BlockScoper interface {
+	BlockScope(ip string) string // BlockScope повертає ідентифікатор об'єкта блокування для IP.
+}
+
+// Об'єкт блокування IP для діяча: BlockScope для діячів, що його реалізують, інакше сам IP
+func BlockScope(act Actioner, ip string) string {
+	if s, ok := act.(BlockScoper); ok {
+		return s.BlockScope(ip)
+	}
+	return ip
+}
+
+// Діапазон блокування як ідентифікатор об'єкта; для некоректного суб'єкта - сам суб'єкт
+func prefixScope(ip string, cfg config.ActionerConfig) string {
+	prefix, err := blockPrefix(ip, cfg)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
 // Діяч для роботи з Google Cloud Firewall
 func NewGCPFirewall(cfg config.ActionerConfig) *GCPFirewall {
 	return &GCPFirewall{cfg: cfg}
 }
 
+// Діяч для Google Cloud Firewall з готовим клієнтом Compute API (наприклад, з option.WithEndpoint для тестів)
+func NewGCPFirewallWithService(cfg config.ActionerConfig, svc *compute.Service) *GCPFirewall {
+	return &GCPFirewall{cfg: cfg, svc: svc}
+}
+
 // Діяч для роботи з Google Cloud Storage.
 func NewGCPStorage(cfg config.ActionerConfig) *GCPStorage {
 	return &GCPStorage{cfg: cfg}
@@ -22,3 +73,23 @@ func NewGCPStorage(cfg config.ActionerConfig) *GCPStorage {
 func NewSigmaHQActioner(cfg config.ActionerConfig) *SigmaHQActioner {
 	return &SigmaHQActioner{cfg: cfg}
 }
+
+// Діяч для блокування IP на локальному хості через nftables або iptables
+func NewLocalFirewall(cfg config.ActionerConfig) *LocalFirewall {
+	return NewLocalFirewallWithRunner(cfg, execRunner{})
+}
+
+// Діяч для локального брандмауера з власним виконавцем команд (наприклад, для тестів)
+func NewLocalFirewallWithRunner(cfg config.ActionerConfig, runner CommandRunner) *LocalFirewall {
+	return &LocalFirewall{cfg: cfg, runner: runner}
+}
+
+// Діяч для ізоляції IP політиками Cilium у кластері Kubernetes
+func NewCiliumPolicy(cfg config.ActionerConfig) *CiliumPolicy {
+	return &CiliumPolicy{cfg: cfg}
+}
+
+// Діяч для політик Cilium з готовим клієнтом Kubernetes (наприклад, fake-клієнтом для тестів)
+func NewCiliumPolicyWithClient(cfg config.ActionerConfig, client dynamic.Interface) *CiliumPolicy {
+	return &CiliumPolicy{cfg: cfg, client: client}
+}
@@ -0,0 +1,64 @@
+package actioner
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Діапазон, що блокується для адреси: /32 для IPv4 та /128 для IPv6,
+// якщо в конфігурації діяча не вказано іншої довжини префікса. Суб'єкт у вигляді CIDR
+// (об'єднане блокування мережі) блокується без змін
+func blockPrefix(ip string, cfg config.ActionerConfig) (netip.Prefix, error) {
+	if strings.Contains(ip, "/") {
+		prefix, err := netip.ParsePrefix(ip)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q не є діапазоном адрес", ip)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q не є IP-адресою", ip)
+	}
+	addr = addr.Unmap().WithZone("")
+	bits := addr.BitLen()
+	if addr.Is4() && cfg.PrefixV4 > 0 {
+		bits = cfg.PrefixV4
+	}
+	if addr.Is6() && cfg.PrefixV6 > 0 {
+		bits = cfg.PrefixV6
+	}
+	return addr.Prefix(bits)
+}
+
+// Запис діапазону, придатний для імен ресурсів GCP, Kubernetes та об'єктів сховища ([a-z0-9-]):
+// 203-0-113-7 для IPv4 та повна форма 2001-0db8-0000-...-0001 для IPv6, щоб ім'я не закінчувалося
+// дефісом після "::". Довжина префікса додається, якщо діапазон ширший за одну адресу
+func prefixLabel(p netip.Prefix) string {
+	addr := p.Addr()
+	label := strings.ReplaceAll(addr.String(), ".", "-")
+	if addr.Is6() {
+		label = strings.ReplaceAll(addr.StringExpanded(), ":", "-")
+	}
+	if !p.IsSingleIP() {
+		label += "-" + strconv.Itoa(p.Bits())
+	}
+	return label
+}
+
+// Запис суб'єкта для імен об'єктів: IP-адреса та CIDR кодуються prefixLabel, інші значення не змінюються
+func subjectLabel(subject string) string {
+	if prefix, err := netip.ParsePrefix(subject); err == nil {
+		return prefixLabel(prefix.Masked())
+	}
+	addr, err := netip.ParseAddr(subject)
+	if err != nil {
+		return subject
+	}
+	addr = addr.Unmap().WithZone("")
+	return prefixLabel(netip.PrefixFrom(addr, addr.BitLen()))
+}
@@ -0,0 +1,200 @@
+package actioner
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"sync"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Значення за замовчуванням для політик Cilium
+const (
+	defaultCiliumNamespace = "default"          // Простір імен для CiliumNetworkPolicy
+	ciliumPolicyPrefix     = "setmaster-block-" // Префікс імен політик, створених модулем
+)
+
+// Ресурси Cilium, з якими працює діяч
+var (
+	ciliumNetworkPolicyGVR            = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumnetworkpolicies"}
+	ciliumClusterwideNetworkPolicyGVR = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumclusterwidenetworkpolicies"}
+)
+
+// Структура для ізоляції атакуючих адрес політиками CiliumNetworkPolicy
+type CiliumPolicy struct {
+	cfg    config.ActionerConfig // Конфігурація діяча
+	mu     sync.Mutex            // Захист від одночасного створення клієнта
+	client dynamic.Interface     // Клієнт Kubernetes (створюється при першому використанні)
+}
+
+// Name повертає назву модуля
+func (c *CiliumPolicy) Name() string {
+	return "cilium_policy"
+}
+
+// Політика створюється для діапазону блокування, спільного для адрес однієї мережі при prefix_v4/prefix_v6
+func (c *CiliumPolicy) BlockScope(ip string) string {
+	return prefixScope(ip, c.cfg)
+}
+
+// Створення політики, що забороняє вхідний трафік з IP до подів honeypot, не змінюючи решту їхнього трафіку
+func (c *CiliumPolicy) Execute(ip string) error {
+	resource, err := c.resource()
+	if err != nil {
+		return err
+	}
+	prefix, err := blockPrefix(ip, c.cfg)
+	if err != nil {
+		return err
+	}
+	policy := c.policy(prefix)
+	_, err = resource.Create(context.Background(), policy, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Політика вже існує, отже IP ізольовано
+		log.Printf("Політика %s для IP %s уже існує", policy.GetName(), ip)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Не вдалося створити політику Cilium для IP %s: %v", ip, err)
+		return err
+	}
+	log.Printf("Успішно ізольовано IP %s політикою %s", ip, policy.GetName())
+	return nil
+}
+
+// Видалення політики для IP (реалізація Reverter)
+func (c *CiliumPolicy) Revert(ip string) error {
+	resource, err := c.resource()
+	if err != nil {
+		return err
+	}
+	prefix, err := blockPrefix(ip, c.cfg)
+	if err != nil {
+		return err
+	}
+	name := ciliumPolicyName(prefix)
+	err = resource.Delete(context.Background(), name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		// Політику вже видалено
+		log.Printf("Політику %s для IP %s не знайдено", name, ip)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Не вдалося видалити політику Cilium для IP %s: %v", ip, err)
+		return err
+	}
+	log.Printf("Успішно розблоковано IP %s шляхом видалення політики %s", ip, name)
+	return nil
+}
+
+// Формування об'єкта CiliumNetworkPolicy або CiliumClusterwideNetworkPolicy для діапазону
+func (c *CiliumPolicy) policy(prefix netip.Prefix) *unstructured.Unstructured {
+	kind := "CiliumNetworkPolicy"
+	if c.cfg.Clusterwide {
+		kind = "CiliumClusterwideNetworkPolicy"
+	}
+	matchLabels := map[string]interface{}{}
+	for k, v := range c.selector() {
+		matchLabels[k] = v
+	}
+
+	metadata := map[string]interface{}{
+		"name": ciliumPolicyName(prefix),
+		"labels": map[string]interface{}{
+			"app.kubernetes.io/managed-by": "setmaster",
+		},
+	}
+	if !c.cfg.Clusterwide {
+		metadata["namespace"] = c.namespace()
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cilium.io/v2",
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"description": "Blocked by SETMaster module-engine: " + prefix.String(),
+			"endpointSelector": map[string]interface{}{
+				"matchLabels": matchLabels,
+			},
+			// Політика, що вибирає под, інакше вмикає для нього заборону за замовчуванням,
+			// і перше ж блокування відрізало б honeypot від усього вхідного трафіку (Cilium 1.15+)
+			"enableDefaultDeny": map[string]interface{}{
+				"ingress": false,
+				"egress":  false,
+			},
+			"ingressDeny": []interface{}{
+				map[string]interface{}{
+					"fromCIDR": []interface{}{prefix.String()},
+				},
+			},
+		},
+	}}
+}
+
+// Ресурс для роботи з політиками: простір імен або весь кластер
+func (c *CiliumPolicy) resource() (dynamic.ResourceInterface, error) {
+	client, err := c.dynamicClient()
+	if err != nil {
+		log.Printf("Не вдалося створити клієнт Kubernetes: %v", err)
+		return nil, err
+	}
+	if c.cfg.Clusterwide {
+		return client.Resource(ciliumClusterwideNetworkPolicyGVR), nil
+	}
+	return client.Resource(ciliumNetworkPolicyGVR).Namespace(c.namespace()), nil
+}
+
+// Створення клієнта з kubeconfig або з конфігурації всередині кластера
+func (c *CiliumPolicy) dynamicClient() (dynamic.Interface, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	var restCfg *rest.Config
+	var err error
+	if c.cfg.Kubeconfig != "" {
+		restCfg, err = clientcmd.BuildConfigFromFlags("", c.cfg.Kubeconfig)
+	} else {
+		restCfg, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return client, nil
+}
+
+// Простір імен для політик
+func (c *CiliumPolicy) namespace() string {
+	if c.cfg.Namespace == "" {
+		return defaultCiliumNamespace
+	}
+	return c.cfg.Namespace
+}
+
+// Мітки подів honeypot, до яких застосовується політика
+func (c *CiliumPolicy) selector() map[string]string {
+	if len(c.cfg.Selector) == 0 {
+		return map[string]string{"app": "cowrie"}
+	}
+	return c.cfg.Selector
+}
+
+// Ім'я політики для діапазону (повна форма IPv6 з дефісами замість двокрапок)
+func ciliumPolicyName(prefix netip.Prefix) string {
+	return ciliumPolicyPrefix + prefixLabel(prefix)
+}
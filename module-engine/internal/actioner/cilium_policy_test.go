@@ -0,0 +1,133 @@
+package actioner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Fake-клієнт Kubernetes, що знає списки ресурсів Cilium
+func fakeCiliumClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ciliumNetworkPolicyGVR:            "CiliumNetworkPolicyList",
+		ciliumClusterwideNetworkPolicyGVR: "CiliumClusterwideNetworkPolicyList",
+	})
+}
+
+func TestCiliumPolicyExecuteAndRevert(t *testing.T) {
+	client := fakeCiliumClient()
+	c := NewCiliumPolicyWithClient(config.ActionerConfig{Namespace: "honeypot", Selector: map[string]string{"app": "cowrie"}}, client)
+	resource := client.Resource(ciliumNetworkPolicyGVR).Namespace("honeypot")
+	ctx := context.Background()
+
+	if err := c.Execute("203.0.113.7"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	policy, err := resource.Get(ctx, "setmaster-block-203-0-113-7", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("policy not created: %v", err)
+	}
+	if policy.GetKind() != "CiliumNetworkPolicy" || policy.GetNamespace() != "honeypot" {
+		t.Errorf("kind/namespace = %s/%s", policy.GetKind(), policy.GetNamespace())
+	}
+	cidrs, _, _ := unstructured.NestedSlice(policy.Object, "spec", "ingressDeny")
+	if len(cidrs) != 1 {
+		t.Fatalf("ingressDeny = %v", cidrs)
+	}
+	if from, _, _ := unstructured.NestedStringSlice(cidrs[0].(map[string]interface{}), "fromCIDR"); len(from) != 1 || from[0] != "203.0.113.7/32" {
+		t.Errorf("fromCIDR = %v", from)
+	}
+	if app, _, _ := unstructured.NestedString(policy.Object, "spec", "endpointSelector", "matchLabels", "app"); app != "cowrie" {
+		t.Errorf("endpointSelector app = %q", app)
+	}
+	// Політика не повинна вмикати заборону за замовчуванням для подів honeypot
+	for _, direction := range []string{"ingress", "egress"} {
+		enabled, found, _ := unstructured.NestedBool(policy.Object, "spec", "enableDefaultDeny", direction)
+		if !found || enabled {
+			t.Errorf("enableDefaultDeny.%s = %v (found %v), want false", direction, enabled, found)
+		}
+	}
+	if _, found, _ := unstructured.NestedSlice(policy.Object, "spec", "ingress"); found {
+		t.Error("policy must not contain allow rules")
+	}
+
+	// Повторне блокування не є помилкою
+	if err := c.Execute("203.0.113.7"); err != nil {
+		t.Errorf("second Execute() error = %v", err)
+	}
+
+	if err := c.Revert("203.0.113.7"); err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if _, err := resource.Get(ctx, "setmaster-block-203-0-113-7", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("policy not deleted: %v", err)
+	}
+	// Політику вже видалено: розблокування успішне
+	if err := c.Revert("203.0.113.7"); err != nil {
+		t.Errorf("Revert() of missing policy error = %v", err)
+	}
+}
+
+func TestCiliumPolicyIPv6(t *testing.T) {
+	client := fakeCiliumClient()
+	c := NewCiliumPolicyWithClient(config.ActionerConfig{PrefixV6: 64}, client)
+	if err := c.Execute("2001:db8::1"); err != nil {
+		t.Fatal(err)
+	}
+	name := "setmaster-block-2001-0db8-0000-0000-0000-0000-0000-0000-64"
+	policy, err := client.Resource(ciliumNetworkPolicyGVR).Namespace(defaultCiliumNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("policy %s not created: %v", name, err)
+	}
+	cidrs, _, _ := unstructured.NestedSlice(policy.Object, "spec", "ingressDeny")
+	if from, _, _ := unstructured.NestedStringSlice(cidrs[0].(map[string]interface{}), "fromCIDR"); len(from) != 1 || from[0] != "2001:db8::/64" {
+		t.Errorf("fromCIDR = %v", from)
+	}
+}
+
+func TestCiliumPolicyClusterwide(t *testing.T) {
+	client := fakeCiliumClient()
+	c := NewCiliumPolicyWithClient(config.ActionerConfig{Clusterwide: true, Namespace: "ignored"}, client)
+	ctx := context.Background()
+
+	if err := c.Execute("203.0.113.7"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	policy, err := client.Resource(ciliumClusterwideNetworkPolicyGVR).Get(ctx, "setmaster-block-203-0-113-7", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("clusterwide policy not created: %v", err)
+	}
+	if policy.GetKind() != "CiliumClusterwideNetworkPolicy" || policy.GetNamespace() != "" {
+		t.Errorf("kind/namespace = %s/%q", policy.GetKind(), policy.GetNamespace())
+	}
+	if list, _ := client.Resource(ciliumNetworkPolicyGVR).Namespace("ignored").List(ctx, metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Errorf("namespaced policies created in clusterwide mode: %d", len(list.Items))
+	}
+
+	if err := c.Revert("203.0.113.7"); err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if _, err := client.Resource(ciliumClusterwideNetworkPolicyGVR).Get(ctx, "setmaster-block-203-0-113-7", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("clusterwide policy not deleted: %v", err)
+	}
+}
+
+func TestCiliumPolicyRevertError(t *testing.T) {
+	client := fakeCiliumClient()
+	client.PrependReactor("delete", "ciliumnetworkpolicies", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(ciliumNetworkPolicyGVR.GroupResource(), "setmaster-block-203-0-113-7", errors.New("rbac"))
+	})
+	c := NewCiliumPolicyWithClient(config.ActionerConfig{}, client)
+	if err := c.Revert("203.0.113.7"); err == nil {
+		t.Error("Revert() should return errors other than NotFound")
+	}
+}
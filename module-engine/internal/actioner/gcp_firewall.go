@@ -2,17 +2,26 @@ package actioner
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
 
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
 // Структура для роботи з брандмауером Google Cloud Platform
 type GCPFirewall struct {
-	cfg config.ActionerConfig // Конфігурація для доступу до GCP
+	cfg   config.ActionerConfig // Конфігурація для доступу до GCP
+	svc   *compute.Service      // Готовий клієнт Compute API (nil - створюється з credentials_file)
+	mu    sync.Mutex            // Послідовні зміни спільних правил у межах процесу
+	owner string                // Ідентифікатор екземпляра в lease спільних правил
 }
 
 // Name повертає назву модуля
@@ -20,27 +29,43 @@ func (g *GCPFirewall) Name() string {
 	return "gcp_firewall" // Унікальне ім'я для ідентифікації модуля
 }
 
+// Правило (або діапазон спільного правила) створюється для діапазону блокування, спільного для адрес однієї мережі при prefix_v4/prefix_v6
+func (g *GCPFirewall) BlockScope(ip string) string {
+	return prefixScope(ip, g.cfg)
+}
+
 // Блокування IP у брандмауері GCP
 func (g *GCPFirewall) Execute(ip string) error {
+	return g.ExecuteIncident(ip, Incident{})
+}
+
+// Блокування IP з описом правила, що містить сценарій та інцидент (реалізація IncidentExecutor)
+func (g *GCPFirewall) ExecuteIncident(ip string, incident Incident) error {
+	if g.cfg.Consolidate {
+		return g.updateShared(ip, true) // Додаємо діапазон до спільного правила
+	}
 	ctx := context.Background() // Створюємо контекст для запитів до API
-	// Ініціалізуємо сервіс Google Compute Engine з використанням файлу облікових даних
-	svc, err := compute.NewService(ctx, option.WithCredentialsFile(g.cfg.CredentialsFile))
+	svc, err := g.service(ctx)
 	if err != nil {
 		return err // Повертаємо помилку, якщо не вдалося підключитися до сервісу
 	}
-	// Формуємо унікальне ім'я правила для брандмауера, замінюючи крапки в IP на дефіси
-	ruleName := "block-" + strings.ReplaceAll(ip, ".", "-")
-	ruleName = strings.ToLower(ruleName) // Переводимо ім'я в нижній регістр для консистентності
+	// Діапазон для блокування: /32 або /128 чи префікс із конфігурації
+	prefix, err := blockPrefix(ip, g.cfg)
+	if err != nil {
+		return err
+	}
+	ruleName := firewallRuleName(prefix) // Унікальне ім'я правила для діапазону
 
 	// Створюємо нове правило брандмауера для блокування IP
-	firewall := &compute.Firewall{
-		Name:         ruleName,                                       // Ім'я правила
-		SourceRanges: []string{ip + "/32"},                           // Діапазон IP для блокування (одинична адреса)
-		Denied:       []*compute.FirewallDenied{{IPProtocol: "all"}}, // Блокуємо весь трафік
-	}
+	firewall := g.rule(ruleName, []string{prefix.String()}, g.description(ip, incident))
 
 	// Виконуємо запит на створення правила в GCP
 	_, err = svc.Firewalls.Insert(g.cfg.ProjectID, firewall).Do()
+	if isAlreadyExists(err) {
+		// Повторне блокування: правило залишилося від попереднього блокування діапазону
+		log.Printf("Правило %s для IP %s уже існує, IP заблоковано", ruleName, ip)
+		return nil
+	}
 	if err != nil {
 		// Логуємо помилку, якщо не вдалося створити правило
 		log.Printf("Не вдалося заблокувати IP %s: %v", ip, err)
@@ -51,21 +76,32 @@ func (g *GCPFirewall) Execute(ip string) error {
 	return nil // Повертаємо nil, якщо все пройшло успішно
 }
 
-// Видаляємо правило блокування для заданого IP
-func (g *GCPFirewall) Unblock(ip string) error {
+// Видаляємо правило блокування для заданого IP (реалізація Reverter)
+func (g *GCPFirewall) Revert(ip string) error {
+	if g.cfg.Consolidate {
+		return g.updateShared(ip, false) // Видаляємо діапазон зі спільного правила
+	}
 	ctx := context.Background() // Створюємо контекст для запитів до API
-	// Ініціалізуємо сервіс Google Compute Engine з використанням файлу облікових даних
-	svc, err := compute.NewService(ctx, option.WithCredentialsFile(g.cfg.CredentialsFile))
+	svc, err := g.service(ctx)
 	if err != nil {
 		return err // Повертаємо помилку, якщо не вдалося підключитися до сервісу
 	}
 
 	// Формуємо ім'я правила для видалення, аналогічно до створення
-	ruleName := "block-" + strings.ReplaceAll(ip, ".", "-")
-	ruleName = strings.ToLower(ruleName) // Переводимо ім'я в нижній регістр
+	prefix, err := blockPrefix(ip, g.cfg)
+	if err != nil {
+		return err
+	}
+	ruleName := firewallRuleName(prefix)
 
 	// Виконуємо запит на видалення правила з брандмауера
-	if _, err := svc.Firewalls.Delete(g.cfg.ProjectID, ruleName).Do(); err != nil {
+	_, err = svc.Firewalls.Delete(g.cfg.ProjectID, ruleName).Do()
+	if isNotFound(err) {
+		// Правило вже видалено (вручну або попереднім розблокуванням, відповідь на яке не надійшла)
+		log.Printf("Правило %s для IP %s не знайдено, IP уже розблоковано", ruleName, ip)
+		return nil
+	}
+	if err != nil {
 		// Логуємо помилку, якщо не вдалося видалити правило
 		log.Printf("Не вдалося розблокувати IP %s: %v", ip, err)
 		return err
@@ -74,3 +110,93 @@ func (g *GCPFirewall) Unblock(ip string) error {
 	log.Printf("Успішно розблоковано IP %s шляхом видалення правила %s", ip, ruleName)
 	return nil // Повертаємо nil, якщо все пройшло успішно
 }
+
+// Ім'я правила для діапазону: block-203-0-113-7 для IPv4 (як у правил попередніх версій)
+// та block-2001-0db8-...-0001 для IPv6; довжина не перевищує 63 символів, дозволених GCP
+func firewallRuleName(prefix netip.Prefix) string {
+	return "block-" + prefixLabel(prefix)
+}
+
+// Клієнт Compute API: переданий у конструкторі або створений з файлу облікових даних
+func (g *GCPFirewall) service(ctx context.Context) (*compute.Service, error) {
+	if g.svc != nil {
+		return g.svc, nil
+	}
+	return compute.NewService(ctx, option.WithCredentialsFile(g.cfg.CredentialsFile))
+}
+
+// Правило блокування діапазонів з мережею, пріоритетом, напрямком та цільовими тегами з конфігурації
+func (g *GCPFirewall) rule(name string, ranges []string, description string) *compute.Firewall {
+	firewall := &compute.Firewall{
+		Name:        name,                                           // Ім'я правила
+		Network:     g.network(),                                    // Мережа VPC (порожня - default)
+		Direction:   g.direction(),                                  // Вхідний або вихідний трафік
+		TargetTags:  g.cfg.TargetTags,                               // ВМ, до яких застосовується правило
+		Description: description,                                    // Сценарій та інцидент блокування
+		Denied:      []*compute.FirewallDenied{{IPProtocol: "all"}}, // Блокуємо весь трафік
+	}
+	if g.cfg.Priority != nil {
+		// Пріоритет 0 (найвищий) потрібно надіслати явно, інакше GCP встановить 1000
+		firewall.Priority = int64(*g.cfg.Priority)
+		firewall.ForceSendFields = []string{"Priority"}
+	}
+	g.setRanges(firewall, ranges)
+	return firewall
+}
+
+// Напрямок правил: EGRESS блокує з'єднання до адрес, INGRESS (за замовчуванням) - від них
+func (g *GCPFirewall) direction() string {
+	if strings.EqualFold(g.cfg.Direction, "EGRESS") {
+		return "EGRESS"
+	}
+	return "INGRESS"
+}
+
+// Діапазони правила залежно від напрямку: джерела для INGRESS, призначення для EGRESS
+func (g *GCPFirewall) ranges(firewall *compute.Firewall) []string {
+	if g.direction() == "EGRESS" {
+		return firewall.DestinationRanges
+	}
+	return firewall.SourceRanges
+}
+
+// Встановлення діапазонів правила залежно від напрямку
+func (g *GCPFirewall) setRanges(firewall *compute.Firewall, ranges []string) {
+	if g.direction() == "EGRESS" {
+		firewall.DestinationRanges = ranges
+	} else {
+		firewall.SourceRanges = ranges
+	}
+}
+
+// Мережа VPC: коротке ім'я перетворюється на шлях у проєкті, URL або шлях передаються як є
+func (g *GCPFirewall) network() string {
+	if g.cfg.Network == "" || strings.Contains(g.cfg.Network, "/") {
+		return g.cfg.Network
+	}
+	return fmt.Sprintf("projects/%s/global/networks/%s", g.cfg.ProjectID, g.cfg.Network)
+}
+
+// Опис правила: SETMaster scenario=block_ip incident=4f2a... ip=203.0.113.7
+func (g *GCPFirewall) description(ip string, incident Incident) string {
+	description := g.cfg.Description
+	if description == "" {
+		description = "SETMaster"
+	}
+	if incident.Scenario != "" {
+		description += " scenario=" + incident.Scenario
+	}
+	if incident.ID != "" {
+		description += " incident=" + incident.ID
+	}
+	if ip != "" {
+		description += " ip=" + ip
+	}
+	return description
+}
+
+// Чи означає помилка, що правило з таким ім'ям уже існує
+func isAlreadyExists(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
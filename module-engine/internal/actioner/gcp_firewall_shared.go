@@ -0,0 +1,438 @@
+package actioner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// Режим спільних правил (consolidate): замість правила на кожен IP підтримується невеликий набір
+// правил <rule_prefix>-4-N та <rule_prefix>-6-N, у списки джерел (для EGRESS - призначень) яких
+// додаються та з яких видаляються діапазони. Коли правило досягає max_ranges, створюється наступне.
+// Опис спільного правила не містить окремих інцидентів.
+//
+// Ресурс Firewall не має fingerprint, тому Patch не захищений від одночасної зміни іншим екземпляром.
+// Зміни правил сімейства виконуються під lease - вимкненим правилом <rule_prefix>-4-lease (-6-lease),
+// яке атомарно створюється через Insert і в описі містить власника та час закінчення. Власник перевіряє
+// lease перед кожною зміною, а після неї перечитує правило; lease екземпляра, що завершився аварійно,
+// видаляється після закінчення leaseTTL
+
+const (
+	defaultRulePrefix = "setmaster-deny" // Префікс імен спільних правил
+	defaultMaxRanges  = 256              // Діапазонів в одному правилі
+	sharedAttempts    = 5                // Спроб оновлення спільного правила
+	leaseTTL          = 2 * time.Minute  // Час, після якого lease вважається покинутим
+)
+
+var (
+	sharedBackoff = 500 * time.Millisecond // Пауза перед повторною спробою (множиться на номер спроби)
+	leaseWait     = 30 * time.Second       // Максимальне очікування lease, зайнятого іншим екземпляром
+)
+
+// Результат операції перезаписано одночасною зміною правила
+var errSharedConflict = errors.New("спільне правило змінено одночасним запитом")
+
+// Lease сімейства правил не звільнено іншим екземпляром за leaseWait
+var errLeaseHeld = errors.New("спільні правила змінюються іншим екземпляром")
+
+// Додавання (add) або видалення діапазону IP у спільних правилах з повторами при конфліктах
+func (g *GCPFirewall) updateShared(ip string, add bool) error {
+	ctx := context.Background()
+	svc, err := g.service(ctx)
+	if err != nil {
+		return err
+	}
+	prefix, err := blockPrefix(ip, g.cfg)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for attempt := 1; ; attempt++ {
+		ruleName, err := g.applyLeased(ctx, svc, prefix, add)
+		if err == nil {
+			if ruleName == "" {
+				log.Printf("IP %s не знайдено у спільних правилах, розблокування не потрібне", ip)
+			} else if add {
+				log.Printf("Успішно заблоковано IP %s у спільному правилі %s", ip, ruleName)
+			} else {
+				log.Printf("Успішно розблоковано IP %s у спільному правилі %s", ip, ruleName)
+			}
+			return nil
+		}
+		if !retryableShared(err) || attempt == sharedAttempts {
+			log.Printf("Не вдалося оновити спільне правило для IP %s: %v", ip, err)
+			return err
+		}
+		log.Printf("Конфлікт при оновленні спільного правила для IP %s (спроба %d з %d): %v", ip, attempt, sharedAttempts, err)
+		time.Sleep(time.Duration(attempt) * sharedBackoff)
+	}
+}
+
+// Одна спроба під lease сімейства адрес
+func (g *GCPFirewall) applyLeased(ctx context.Context, svc *compute.Service, prefix netip.Prefix, add bool) (string, error) {
+	base := g.shardPrefix(prefix)
+	if err := g.acquireLease(ctx, svc, base, prefix.String()); err != nil {
+		return "", err
+	}
+	defer g.releaseLease(ctx, svc, base)
+	return g.applyShared(ctx, svc, prefix, add)
+}
+
+// Одна спроба: читання правил сімейства адрес, зміна одного з них та перевірка результату
+func (g *GCPFirewall) applyShared(ctx context.Context, svc *compute.Service, prefix netip.Prefix, add bool) (string, error) {
+	base := g.shardPrefix(prefix)
+	rules, err := g.shards(ctx, svc, base)
+	if err != nil {
+		return "", err
+	}
+	r := prefix.String()
+
+	for _, rule := range rules {
+		if !containsRange(g.ranges(rule), r) {
+			continue
+		}
+		if add {
+			return rule.Name, nil // Діапазон уже заблоковано
+		}
+		if err := g.checkLease(ctx, svc, base); err != nil {
+			return rule.Name, err
+		}
+		ranges := removeRange(g.ranges(rule), r)
+		var op *compute.Operation
+		if len(ranges) == 0 {
+			// Правило без джерел недопустиме, тому останній діапазон видаляється разом із правилом
+			op, err = svc.Firewalls.Delete(g.cfg.ProjectID, rule.Name).Context(ctx).Do()
+		} else {
+			op, err = svc.Firewalls.Patch(g.cfg.ProjectID, rule.Name, g.patch(ranges)).Context(ctx).Do()
+		}
+		if err == nil {
+			err = g.wait(ctx, svc, op)
+		}
+		if err != nil {
+			return rule.Name, err
+		}
+		return rule.Name, g.verifyShared(ctx, svc, rule.Name, r, false)
+	}
+
+	if !add {
+		// Діапазону немає в спільних правилах: блокування могло бути створене до увімкнення consolidate
+		return g.deleteLegacy(ctx, svc, prefix)
+	}
+
+	// Додавання до першого правила, в якому є місце
+	for _, rule := range rules {
+		if len(g.ranges(rule)) >= g.maxRanges() {
+			continue
+		}
+		if err := g.checkLease(ctx, svc, base); err != nil {
+			return rule.Name, err
+		}
+		ranges := append(append([]string{}, g.ranges(rule)...), r)
+		op, err := svc.Firewalls.Patch(g.cfg.ProjectID, rule.Name, g.patch(ranges)).Context(ctx).Do()
+		if err == nil {
+			err = g.wait(ctx, svc, op)
+		}
+		if err != nil {
+			return rule.Name, err
+		}
+		return rule.Name, g.verifyShared(ctx, svc, rule.Name, r, true)
+	}
+
+	// Усі правила заповнені: створюємо наступне
+	ruleName := base + strconv.Itoa(nextShard(rules, base))
+	if err := g.checkLease(ctx, svc, base); err != nil {
+		return ruleName, err
+	}
+	firewall := g.rule(ruleName, []string{r}, g.description("", Incident{})) // Спільне правило не належить одному інциденту
+	op, err := svc.Firewalls.Insert(g.cfg.ProjectID, firewall).Context(ctx).Do()
+	if err == nil {
+		err = g.wait(ctx, svc, op)
+	}
+	if err != nil {
+		return ruleName, err
+	}
+	return ruleName, g.verifyShared(ctx, svc, ruleName, r, true)
+}
+
+// Перевірка, що після операції діапазон є (add) або відсутній у правилі
+func (g *GCPFirewall) verifyShared(ctx context.Context, svc *compute.Service, ruleName, r string, add bool) error {
+	rule, err := svc.Firewalls.Get(g.cfg.ProjectID, ruleName).Context(ctx).Do()
+	if isNotFound(err) {
+		if add {
+			return errSharedConflict // Правило видалено одночасним розблокуванням
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if containsRange(g.ranges(rule), r) != add {
+		return errSharedConflict
+	}
+	return nil
+}
+
+// Захоплення lease правил з префіксом base: вимкнене правило з діапазоном r, власником та часом закінчення в описі.
+// Insert атомарний, тому lease отримує лише один екземпляр; прострочений lease видаляється
+func (g *GCPFirewall) acquireLease(ctx context.Context, svc *compute.Service, base, r string) error {
+	name := base + "lease"
+	deadline := time.Now().Add(leaseWait)
+	for {
+		lease := g.rule(name, []string{r}, fmt.Sprintf("SETMaster lease owner=%s until=%d", g.leaseOwner(), time.Now().Add(leaseTTL).Unix()))
+		lease.Disabled = true // Правило lease не впливає на трафік
+		op, err := svc.Firewalls.Insert(g.cfg.ProjectID, lease).Context(ctx).Do()
+		if err == nil {
+			err = g.wait(ctx, svc, op)
+		}
+		if err == nil {
+			return nil
+		}
+		if !isAlreadyExists(err) && !errors.Is(err, errSharedConflict) {
+			return err
+		}
+
+		held, err := svc.Firewalls.Get(g.cfg.ProjectID, name).Context(ctx).Do()
+		if isNotFound(err) {
+			continue // Lease щойно звільнено
+		}
+		if err != nil {
+			return err
+		}
+		owner, until := parseLease(held.Description)
+		if time.Now().After(until) {
+			log.Printf("Lease %s екземпляра %s прострочено, видаляємо", name, owner)
+			if op, err := svc.Firewalls.Delete(g.cfg.ProjectID, name).Context(ctx).Do(); err == nil {
+				g.wait(ctx, svc, op) // Результат перевіряє наступний Insert
+			} else if !isNotFound(err) {
+				return err
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s (lease %s до %s)", errLeaseHeld, owner, name, until.Format("15:04:05"))
+		}
+		time.Sleep(sharedBackoff)
+	}
+}
+
+// Перевірка перед зміною, що lease досі належить цьому екземпляру і не прострочений
+func (g *GCPFirewall) checkLease(ctx context.Context, svc *compute.Service, base string) error {
+	held, err := svc.Firewalls.Get(g.cfg.ProjectID, base+"lease").Context(ctx).Do()
+	if isNotFound(err) {
+		return fmt.Errorf("%w: lease %slease втрачено", errSharedConflict, base)
+	}
+	if err != nil {
+		return err
+	}
+	owner, until := parseLease(held.Description)
+	if owner != g.leaseOwner() || time.Now().After(until) {
+		return fmt.Errorf("%w: lease %slease належить %s", errSharedConflict, base, owner)
+	}
+	return nil
+}
+
+// Звільнення lease, якщо він досі належить цьому екземпляру
+func (g *GCPFirewall) releaseLease(ctx context.Context, svc *compute.Service, base string) {
+	name := base + "lease"
+	held, err := svc.Firewalls.Get(g.cfg.ProjectID, name).Context(ctx).Do()
+	if err != nil {
+		if !isNotFound(err) {
+			log.Printf("Не вдалося перевірити lease %s: %v", name, err)
+		}
+		return
+	}
+	if owner, _ := parseLease(held.Description); owner != g.leaseOwner() {
+		return // Lease прострочено і захоплено іншим екземпляром
+	}
+	op, err := svc.Firewalls.Delete(g.cfg.ProjectID, name).Context(ctx).Do()
+	if err == nil {
+		err = g.wait(ctx, svc, op)
+	}
+	if err != nil && !isNotFound(err) {
+		log.Printf("Не вдалося звільнити lease %s: %v", name, err)
+	}
+}
+
+// Ідентифікатор екземпляра для lease: ім'я хоста, PID та випадковий суфікс
+func (g *GCPFirewall) leaseOwner() string {
+	if g.owner == "" {
+		host, _ := os.Hostname()
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		g.owner = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+	}
+	return g.owner
+}
+
+// Власник та час закінчення з опису lease: SETMaster lease owner=host-42-1a2b3c4d until=1700000000
+func parseLease(description string) (string, time.Time) {
+	var owner string
+	var until int64
+	for _, field := range strings.Fields(description) {
+		if v, ok := strings.CutPrefix(field, "owner="); ok {
+			owner = v
+		} else if v, ok := strings.CutPrefix(field, "until="); ok {
+			until, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return owner, time.Unix(until, 0)
+}
+
+// Видалення окремого правила block-* для діапазону, створеного без consolidate
+func (g *GCPFirewall) deleteLegacy(ctx context.Context, svc *compute.Service, prefix netip.Prefix) (string, error) {
+	ruleName := firewallRuleName(prefix)
+	op, err := svc.Firewalls.Delete(g.cfg.ProjectID, ruleName).Context(ctx).Do()
+	if isNotFound(err) {
+		return "", nil // Діапазон не заблоковано
+	}
+	if err != nil {
+		return ruleName, err
+	}
+	return ruleName, g.wait(ctx, svc, op)
+}
+
+// Очікування завершення глобальної операції Compute API
+func (g *GCPFirewall) wait(ctx context.Context, svc *compute.Service, op *compute.Operation) error {
+	var err error
+	for op.Status != "DONE" {
+		op, err = svc.GlobalOperations.Wait(g.cfg.ProjectID, op.Name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		e := op.Error.Errors[0]
+		switch e.Code {
+		case "RESOURCE_NOT_READY", "ALREADY_EXISTS", "RESOURCE_NOT_FOUND":
+			return fmt.Errorf("%w: %s", errSharedConflict, e.Message) // Правило змінюється іншою операцією
+		}
+		return fmt.Errorf("операція %s: %s: %s", op.Name, e.Code, e.Message)
+	}
+	return nil
+}
+
+// Спільні правила з префіксом імені base, впорядковані за номером
+func (g *GCPFirewall) shards(ctx context.Context, svc *compute.Service, base string) ([]*compute.Firewall, error) {
+	var rules []*compute.Firewall
+	call := svc.Firewalls.List(g.cfg.ProjectID).Filter(fmt.Sprintf(`name eq "%s[0-9]+"`, regexp.QuoteMeta(base)))
+	err := call.Pages(ctx, func(list *compute.FirewallList) error {
+		for _, rule := range list.Items {
+			if shardIndex(rule.Name, base) >= 0 {
+				rules = append(rules, rule)
+			}
+		}
+		return nil
+	})
+	sort.Slice(rules, func(i, j int) bool {
+		return shardIndex(rules[i].Name, base) < shardIndex(rules[j].Name, base)
+	})
+	return rules, err
+}
+
+// Зміна правила, що замінює лише список діапазонів
+func (g *GCPFirewall) patch(ranges []string) *compute.Firewall {
+	firewall := &compute.Firewall{}
+	g.setRanges(firewall, ranges)
+	return firewall
+}
+
+// Префікс імен спільних правил для сімейства адрес діапазону
+func (g *GCPFirewall) shardPrefix(prefix netip.Prefix) string {
+	base := g.cfg.RulePrefix
+	if base == "" {
+		base = defaultRulePrefix
+	}
+	if prefix.Addr().Is4() {
+		return base + "-4-"
+	}
+	return base + "-6-" // GCP не дозволяє змішувати IPv4 та IPv6 в одному правилі
+}
+
+// Максимальна кількість діапазонів в одному спільному правилі
+func (g *GCPFirewall) maxRanges() int {
+	if g.cfg.MaxRanges > 0 {
+		return g.cfg.MaxRanges
+	}
+	return defaultMaxRanges
+}
+
+// Номер спільного правила за ім'ям; -1, якщо ім'я не належить набору
+func shardIndex(name, base string) int {
+	if !strings.HasPrefix(name, base) {
+		return -1
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(name, base))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// Перший вільний номер для нового правила
+func nextShard(rules []*compute.Firewall, base string) int {
+	next := 0
+	for _, rule := range rules {
+		if n := shardIndex(rule.Name, base); n >= next {
+			next = n + 1
+		}
+	}
+	return next
+}
+
+// Чи є діапазон у списку
+func containsRange(ranges []string, r string) bool {
+	for _, v := range ranges {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Список без діапазону r
+func removeRange(ranges []string, r string) []string {
+	var out []string
+	for _, v := range ranges {
+		if v != r {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Помилки, після яких має сенс перечитати правила та повторити спробу
+func retryableShared(err error) bool {
+	if errors.Is(err, errSharedConflict) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed:
+			return true // Правило видалено, вже створено або змінюється іншою операцією
+		}
+	}
+	return false
+}
+
+// Чи означає помилка, що правила не існує
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
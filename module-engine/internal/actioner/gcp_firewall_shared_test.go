@@ -0,0 +1,219 @@
+package actioner
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"google.golang.org/api/compute/v1"
+)
+
+// Діяч у режимі consolidate з max_ranges діапазонів у правилі та короткими паузами між спробами
+func sharedFirewall(t *testing.T, svc *compute.Service, maxRanges int) *GCPFirewall {
+	t.Helper()
+	backoff := sharedBackoff
+	sharedBackoff = time.Millisecond
+	t.Cleanup(func() { sharedBackoff = backoff })
+	return NewGCPFirewallWithService(config.ActionerConfig{ProjectID: "honeypot", Consolidate: true, MaxRanges: maxRanges}, svc)
+}
+
+func TestSharedRulesFillAndRollover(t *testing.T) {
+	f, svc := newFakeCompute(t)
+	g := sharedFirewall(t, svc, 2)
+	step := func(op func(string) error, ip string, want map[string][]string) {
+		t.Helper()
+		if err := op(ip); err != nil {
+			t.Fatalf("%s: %v", ip, err)
+		}
+		got := map[string][]string{}
+		for _, name := range f.names() {
+			got[name] = f.ranges(name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("after %s: rules %v, want %v", ip, got, want)
+		}
+	}
+
+	step(g.Execute, "203.0.113.1", map[string][]string{"setmaster-deny-4-0": {"203.0.113.1/32"}})
+	step(g.Execute, "203.0.113.2", map[string][]string{"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"}})
+	step(g.Execute, "203.0.113.2", map[string][]string{"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"}})
+	step(g.Execute, "203.0.113.3", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-1": {"203.0.113.3/32"},
+	})
+	step(g.Execute, "203.0.113.4", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-1": {"203.0.113.3/32", "203.0.113.4/32"},
+	})
+	step(g.Execute, "203.0.113.5", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-1": {"203.0.113.3/32", "203.0.113.4/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32"},
+	})
+
+	// Розблокування з середнього правила; останній діапазон видаляється разом із правилом
+	step(g.Revert, "203.0.113.3", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-1": {"203.0.113.4/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32"},
+	})
+	step(g.Revert, "203.0.113.4", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32"},
+	})
+	step(g.Revert, "203.0.113.4", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32"},
+	})
+
+	// Нові діапазони заповнюють вільне місце, а нове правило отримує номер після найбільшого
+	step(g.Execute, "203.0.113.6", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32", "203.0.113.6/32"},
+	})
+	step(g.Execute, "203.0.113.7", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32", "203.0.113.6/32"},
+		"setmaster-deny-4-3": {"203.0.113.7/32"},
+	})
+	step(g.Execute, "2001:db8::1", map[string][]string{
+		"setmaster-deny-4-0": {"203.0.113.1/32", "203.0.113.2/32"},
+		"setmaster-deny-4-2": {"203.0.113.5/32", "203.0.113.6/32"},
+		"setmaster-deny-4-3": {"203.0.113.7/32"},
+		"setmaster-deny-6-0": {"2001:db8::1/128"},
+	})
+
+	for _, rule := range f.inserted {
+		if strings.HasSuffix(rule.Name, "-lease") && !rule.Disabled {
+			t.Errorf("lease %s inserted enabled", rule.Name)
+		}
+	}
+}
+
+// Patch іншого екземпляра, що надійшов після зміни, виявляється перевіркою і зміна повторюється
+func TestSharedRulesOverwrite(t *testing.T) {
+	f, svc := newFakeCompute(t)
+	g := sharedFirewall(t, svc, 4)
+	if err := g.Execute("203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.overwrite["setmaster-deny-4-0"] = true
+	if err := g.Execute("203.0.113.2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.ranges("setmaster-deny-4-0"), []string{"203.0.113.1/32", "203.0.113.2/32"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges = %v, want %v", got, want)
+	}
+	if f.patches["setmaster-deny-4-0"] != 2 {
+		t.Errorf("patched %d times, want a retry after the overwrite", f.patches["setmaster-deny-4-0"])
+	}
+
+	f.overwrite["setmaster-deny-4-0"] = true
+	if err := g.Revert("203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.ranges("setmaster-deny-4-0"), []string{"203.0.113.2/32"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranges after revert = %v, want %v", got, want)
+	}
+}
+
+// Два екземпляри одночасно блокують і розблоковують адреси: жодна зміна не втрачається
+func TestSharedRulesConcurrentInstances(t *testing.T) {
+	f, svc := newFakeCompute(t)
+	f.listDelay = 2 * time.Millisecond
+	f.delay = func() time.Duration { return time.Duration(rand.IntN(5)) * time.Millisecond }
+	instances := []*GCPFirewall{sharedFirewall(t, svc, 4), sharedFirewall(t, svc, 4)}
+
+	var wg sync.WaitGroup
+	for n, g := range instances {
+		for i := 1; i <= 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ip := fmt.Sprintf("203.0.%d.%d", n, i)
+				if err := g.Execute(ip); err != nil {
+					t.Error(err)
+				}
+				if i%2 == 0 {
+					if err := g.Revert(ip); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	blocked := map[string]int{}
+	for _, name := range f.names() {
+		if strings.HasSuffix(name, "-lease") {
+			t.Errorf("lease %s not released", name)
+			continue
+		}
+		ranges := f.ranges(name)
+		if len(ranges) > 4 {
+			t.Errorf("%s has %d ranges, max_ranges is 4", name, len(ranges))
+		}
+		for _, r := range ranges {
+			blocked[r]++
+		}
+	}
+	for n := range instances {
+		for i := 1; i <= 10; i++ {
+			r := fmt.Sprintf("203.0.%d.%d/32", n, i)
+			want := 1
+			if i%2 == 0 {
+				want = 0
+			}
+			if blocked[r] != want {
+				t.Errorf("%s present %d times, want %d (%s)", r, blocked[r], want, f)
+			}
+		}
+	}
+}
+
+func TestSharedRulesLease(t *testing.T) {
+	f, svc := newFakeCompute(t)
+	g := sharedFirewall(t, svc, 4)
+	wait := leaseWait
+	leaseWait = 20 * time.Millisecond
+	t.Cleanup(func() { leaseWait = wait })
+	lease := func(until time.Time) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.rules["setmaster-deny-4-lease"] = &compute.Firewall{
+			Name:         "setmaster-deny-4-lease",
+			Disabled:     true,
+			SourceRanges: []string{"198.51.100.1/32"},
+			Description:  fmt.Sprintf("SETMaster lease owner=other-1-00000000 until=%d", until.Unix()),
+		}
+	}
+
+	// Lease іншого екземпляра: зміна не виконується
+	lease(time.Now().Add(time.Minute))
+	if err := g.Execute("203.0.113.1"); !errors.Is(err, errLeaseHeld) {
+		t.Fatalf("err = %v, want lease held", err)
+	}
+	if f.ranges("setmaster-deny-4-0") != nil {
+		t.Fatal("rule changed while another instance held the lease")
+	}
+	if f.ranges("setmaster-deny-4-lease") == nil {
+		t.Fatal("lease of another instance released")
+	}
+
+	// Покинутий lease видаляється
+	lease(time.Now().Add(-time.Second))
+	if err := g.Execute("203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.names(); !reflect.DeepEqual(got, []string{"setmaster-deny-4-0"}) {
+		t.Errorf("rules = %v", got)
+	}
+}
@@ -0,0 +1,298 @@
+package actioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// Сервер Compute API з правилами брандмауера в пам'яті; операції завершуються одразу
+type fakeCompute struct {
+	mu        sync.Mutex
+	rules     map[string]*compute.Firewall
+	inserted  []*compute.Firewall  // Тіла запитів Insert у порядку надходження
+	raw       []map[string]any     // Ті самі тіла без декодування: поля, що надсилаються явно
+	patches   map[string]int       // Кількість Patch для кожного правила
+	overwrite map[string]bool      // Наступний Patch правила перезаписується застарілим списком діапазонів
+	listDelay time.Duration        // Затримка List, що розширює вікно між читанням і зміною
+	delay     func() time.Duration // Затримка Patch: зміна іншого екземпляра може надійти вже після перевірки
+}
+
+// Фейковий сервер і клієнт Compute API, що до нього звертається
+func newFakeCompute(t *testing.T) (*fakeCompute, *compute.Service) {
+	t.Helper()
+	f := &fakeCompute{rules: map[string]*compute.Firewall{}, patches: map[string]int{}, overwrite: map[string]bool{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	svc, err := compute.NewService(context.Background(), option.WithEndpoint(srv.URL+"/compute/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, svc
+}
+
+var (
+	firewallsPath  = regexp.MustCompile(`^/compute/v1/projects/[^/]+/global/firewalls(?:/([^/]+))?$`)
+	operationsPath = regexp.MustCompile(`^/compute/v1/projects/[^/]+/global/operations/([^/]+)/wait$`)
+	nameFilter     = regexp.MustCompile(`^name eq "(.*)"$`)
+)
+
+func (f *fakeCompute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m := operationsPath.FindStringSubmatch(r.URL.Path); m != nil {
+		reply(w, http.StatusOK, &compute.Operation{Name: m[1], Status: "DONE"})
+		return
+	}
+	m := firewallsPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		reply(w, http.StatusNotFound, apiError(http.StatusNotFound, "unknown path "+r.URL.Path))
+		return
+	}
+	name := m[1]
+	if name == "" && r.Method == http.MethodGet {
+		time.Sleep(f.listDelay)
+	}
+	if r.Method == http.MethodPatch && f.delay != nil {
+		time.Sleep(f.delay())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		filter := nameFilter.FindStringSubmatch(r.URL.Query().Get("filter"))
+		list := &compute.FirewallList{}
+		for ruleName, rule := range f.rules {
+			if filter == nil || regexp.MustCompile("^(?:"+filter[1]+")$").MatchString(ruleName) {
+				list.Items = append(list.Items, rule)
+			}
+		}
+		reply(w, http.StatusOK, list)
+	case name == "" && r.Method == http.MethodPost:
+		body, _ := io.ReadAll(r.Body)
+		var rule compute.Firewall
+		var raw map[string]any
+		json.Unmarshal(body, &rule)
+		json.Unmarshal(body, &raw)
+		f.inserted = append(f.inserted, &rule)
+		f.raw = append(f.raw, raw)
+		if _, exists := f.rules[rule.Name]; exists {
+			reply(w, http.StatusConflict, apiError(http.StatusConflict, "The resource '"+rule.Name+"' already exists"))
+			return
+		}
+		f.rules[rule.Name] = &rule
+		reply(w, http.StatusOK, &compute.Operation{Name: "insert-" + rule.Name, Status: "DONE"})
+	case f.rules[name] == nil:
+		reply(w, http.StatusNotFound, apiError(http.StatusNotFound, "The resource '"+name+"' was not found"))
+	case r.Method == http.MethodGet:
+		reply(w, http.StatusOK, f.rules[name])
+	case r.Method == http.MethodDelete:
+		delete(f.rules, name)
+		reply(w, http.StatusOK, &compute.Operation{Name: "delete-" + name, Status: "DONE"})
+	case r.Method == http.MethodPatch:
+		var patch compute.Firewall
+		json.NewDecoder(r.Body).Decode(&patch)
+		rule := f.rules[name]
+		stale := *rule
+		if patch.SourceRanges != nil {
+			rule.SourceRanges = patch.SourceRanges
+		}
+		if patch.DestinationRanges != nil {
+			rule.DestinationRanges = patch.DestinationRanges
+		}
+		if patch.Description != "" {
+			rule.Description = patch.Description
+		}
+		f.patches[name]++
+		if f.overwrite[name] {
+			// Patch іншого екземпляра, прочитаного до цієї зміни, надходить одразу після неї
+			delete(f.overwrite, name)
+			rule.SourceRanges, rule.DestinationRanges = stale.SourceRanges, stale.DestinationRanges
+		}
+		reply(w, http.StatusOK, &compute.Operation{Name: "patch-" + name, Status: "DONE"})
+	default:
+		reply(w, http.StatusMethodNotAllowed, apiError(http.StatusMethodNotAllowed, r.Method))
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func apiError(code int, message string) map[string]any {
+	return map[string]any{"error": map[string]any{"code": code, "message": message}}
+}
+
+// Імена всіх правил, зокрема lease
+func (f *fakeCompute) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for name := range f.rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Діапазони правила (джерела або призначення); nil, якщо правила немає
+func (f *fakeCompute) ranges(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rule := f.rules[name]
+	if rule == nil {
+		return nil
+	}
+	return append(append([]string{}, rule.SourceRanges...), rule.DestinationRanges...)
+}
+
+// Перелік діапазонів для повідомлень тестів
+func (f *fakeCompute) String() string {
+	var parts []string
+	for _, name := range f.names() {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, f.ranges(name)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestGCPFirewallRule(t *testing.T) {
+	zero, high := 0, 100
+	tests := []struct {
+		name         string
+		cfg          config.ActionerConfig
+		ip           string
+		wantName     string
+		wantNetwork  string
+		wantPriority any // Значення priority у тілі запиту; nil - поле не надсилається
+		wantDir      string
+		wantSource   []string
+		wantDest     []string
+		wantTags     []string
+		wantDesc     string
+	}{
+		{
+			name:       "defaults",
+			ip:         "203.0.113.7",
+			wantName:   "block-203-0-113-7",
+			wantDir:    "INGRESS",
+			wantSource: []string{"203.0.113.7/32"},
+			wantDesc:   "SETMaster scenario=ssh incident=4f2a ip=203.0.113.7",
+		},
+		{
+			name:         "priority 0 is sent explicitly",
+			cfg:          config.ActionerConfig{Priority: &zero},
+			ip:           "203.0.113.7",
+			wantName:     "block-203-0-113-7",
+			wantPriority: float64(0),
+			wantDir:      "INGRESS",
+			wantSource:   []string{"203.0.113.7/32"},
+			wantDesc:     "SETMaster scenario=ssh incident=4f2a ip=203.0.113.7",
+		},
+		{
+			name:         "network name, priority and tags",
+			cfg:          config.ActionerConfig{Network: "honeypot-vpc", Priority: &high, TargetTags: []string{"honeypot", "ssh"}, Description: "Honeypot"},
+			ip:           "203.0.113.7",
+			wantName:     "block-203-0-113-7",
+			wantNetwork:  "projects/honeypot/global/networks/honeypot-vpc",
+			wantPriority: float64(100),
+			wantDir:      "INGRESS",
+			wantSource:   []string{"203.0.113.7/32"},
+			wantTags:     []string{"honeypot", "ssh"},
+			wantDesc:     "Honeypot scenario=ssh incident=4f2a ip=203.0.113.7",
+		},
+		{
+			name:        "network url",
+			cfg:         config.ActionerConfig{Network: "https://www.googleapis.com/compute/v1/projects/shared/global/networks/vpc"},
+			ip:          "203.0.113.7",
+			wantName:    "block-203-0-113-7",
+			wantNetwork: "https://www.googleapis.com/compute/v1/projects/shared/global/networks/vpc",
+			wantDir:     "INGRESS",
+			wantSource:  []string{"203.0.113.7/32"},
+			wantDesc:    "SETMaster scenario=ssh incident=4f2a ip=203.0.113.7",
+		},
+		{
+			name:     "egress blocks destinations",
+			cfg:      config.ActionerConfig{Direction: "egress", PrefixV6: 64},
+			ip:       "2001:db8::7",
+			wantName: "block-2001-0db8-0000-0000-0000-0000-0000-0000-64",
+			wantDir:  "EGRESS",
+			wantDest: []string{"2001:db8::/64"},
+			wantDesc: "SETMaster scenario=ssh incident=4f2a ip=2001:db8::7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, svc := newFakeCompute(t)
+			tt.cfg.ProjectID = "honeypot"
+			g := NewGCPFirewallWithService(tt.cfg, svc)
+			if err := g.ExecuteIncident(tt.ip, Incident{Scenario: "ssh", ID: "4f2a"}); err != nil {
+				t.Fatal(err)
+			}
+			if len(f.inserted) != 1 {
+				t.Fatalf("inserted %d rules", len(f.inserted))
+			}
+			rule, raw := f.inserted[0], f.raw[0]
+			if rule.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", rule.Name, tt.wantName)
+			}
+			if rule.Network != tt.wantNetwork {
+				t.Errorf("network = %q, want %q", rule.Network, tt.wantNetwork)
+			}
+			if raw["priority"] != tt.wantPriority {
+				t.Errorf("priority = %v, want %v", raw["priority"], tt.wantPriority)
+			}
+			if rule.Direction != tt.wantDir {
+				t.Errorf("direction = %q, want %q", rule.Direction, tt.wantDir)
+			}
+			if !reflect.DeepEqual(rule.SourceRanges, tt.wantSource) || !reflect.DeepEqual(rule.DestinationRanges, tt.wantDest) {
+				t.Errorf("source = %v, destination = %v, want %v and %v", rule.SourceRanges, rule.DestinationRanges, tt.wantSource, tt.wantDest)
+			}
+			if !reflect.DeepEqual(rule.TargetTags, tt.wantTags) {
+				t.Errorf("target tags = %v, want %v", rule.TargetTags, tt.wantTags)
+			}
+			if rule.Description != tt.wantDesc {
+				t.Errorf("description = %q, want %q", rule.Description, tt.wantDesc)
+			}
+			if len(rule.Denied) != 1 || rule.Denied[0].IPProtocol != "all" || len(rule.Allowed) != 0 {
+				t.Errorf("denied = %+v, allowed = %+v", rule.Denied, rule.Allowed)
+			}
+		})
+	}
+}
+
+// Повторне блокування та розблокування вже видаленого правила не є помилкою
+func TestGCPFirewallRepeat(t *testing.T) {
+	f, svc := newFakeCompute(t)
+	g := NewGCPFirewallWithService(config.ActionerConfig{ProjectID: "honeypot"}, svc)
+	for i := 0; i < 2; i++ {
+		if err := g.Execute("203.0.113.7"); err != nil {
+			t.Fatalf("execute %d: %v", i+1, err)
+		}
+	}
+	if got := f.names(); !reflect.DeepEqual(got, []string{"block-203-0-113-7"}) {
+		t.Fatalf("rules = %v", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := g.Revert("203.0.113.7"); err != nil {
+			t.Fatalf("revert %d: %v", i+1, err)
+		}
+	}
+	if got := f.names(); len(got) != 0 {
+		t.Errorf("rules left: %v", got)
+	}
+}
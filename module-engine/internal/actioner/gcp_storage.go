@@ -33,8 +33,8 @@ func (g *GCPStorage) Execute(ip string) error {
 	// Вибір бакета (сховища) з конфігурації
 	bucket := client.Bucket(g.cfg.BucketName)
 
-	// Формуємо унікальне ім’я файлу на основі IP-адреси
-	obj := bucket.Object(fmt.Sprintf("logs-%s.txt", ip))
+	// Формуємо унікальне ім’я файлу на основі IP-адреси (двокрапки IPv6 замінюються дефісами)
+	obj := bucket.Object(fmt.Sprintf("logs-%s.txt", subjectLabel(ip)))
 
 	// Створення об’єкта для запису даних у сховище
 	w := obj.NewWriter(ctx)
@@ -0,0 +1,272 @@
+package actioner
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Значення за замовчуванням для локального брандмауера
+const (
+	defaultLocalBackend = "nftables"        // Бекенд за замовчуванням
+	defaultNftTable     = "setmaster"       // Таблиця nftables (родина inet)
+	defaultNftSet       = "blocked"         // Набір заблокованих адрес
+	defaultIptChain     = "SETMASTER-BLOCK" // Окремий ланцюжок iptables
+)
+
+// CommandRunner виконує зовнішню команду та повертає її об'єднаний вивід.
+type CommandRunner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// Виконання команд через os/exec
+type execRunner struct{}
+
+// Run запускає команду та повертає stdout і stderr
+func (execRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// Структура для блокування IP на локальному хості через nftables або iptables
+type LocalFirewall struct {
+	cfg    config.ActionerConfig // Конфігурація діяча
+	runner CommandRunner         // Виконавець команд nft/iptables
+	mu     sync.Mutex            // Захист від одночасного налаштування та зміни правил
+	ready  map[string]bool       // Команди (nft, iptables, ip6tables), для яких створено таблицю/ланцюжок
+}
+
+// Name повертає назву модуля
+func (l *LocalFirewall) Name() string {
+	return "local_firewall"
+}
+
+// Елемент набору створюється для діапазону блокування, спільного для адрес однієї мережі при prefix_v4/prefix_v6
+func (l *LocalFirewall) BlockScope(ip string) string {
+	return prefixScope(ip, l.cfg)
+}
+
+// Блокування IP: додавання адреси до набору nftables або правила DROP до ланцюжка iptables
+func (l *LocalFirewall) Execute(ip string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prefix, err := blockPrefix(ip, l.cfg)
+	if err != nil {
+		return err
+	}
+	v6 := prefix.Addr().Is6()
+	if err := l.setup(v6); err != nil {
+		log.Printf("Не вдалося підготувати локальний брандмауер: %v", err)
+		return err
+	}
+
+	target := blockTarget(prefix)
+	if l.backend() == "iptables" {
+		// Правило додається лише якщо його ще немає, щоб повторне блокування не дублювало записи
+		if _, checkErr := l.run(l.iptables(v6), "-C", l.chain(), "-s", target, "-j", "DROP"); checkErr != nil {
+			_, err = l.run(l.iptables(v6), "-A", l.chain(), "-s", target, "-j", "DROP")
+		}
+	} else {
+		_, err = l.run("nft", "add", "element", "inet", l.table(), l.set(v6), "{ "+target+" }")
+	}
+	if err != nil {
+		log.Printf("Не вдалося заблокувати IP %s локально: %v", ip, err)
+		return err
+	}
+	log.Printf("Успішно заблоковано IP %s локально (%s)", ip, l.backend())
+	return nil
+}
+
+// Розблокування IP: видалення адреси з набору nftables або правила з ланцюжка iptables (реалізація Reverter)
+func (l *LocalFirewall) Revert(ip string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prefix, err := blockPrefix(ip, l.cfg)
+	if err != nil {
+		return err
+	}
+	v6 := prefix.Addr().Is6()
+	target := blockTarget(prefix)
+	// Правила могли зникнути після перезавантаження або ручного очищення: відсутній запис означає, що IP вже розблоковано
+	var out []byte
+	if l.backend() == "iptables" {
+		if out, err = l.run(l.iptables(v6), "-C", l.chain(), "-s", target, "-j", "DROP"); err == nil {
+			out, err = l.run(l.iptables(v6), "-D", l.chain(), "-s", target, "-j", "DROP")
+		}
+	} else {
+		out, err = l.run("nft", "delete", "element", "inet", l.table(), l.set(v6), "{ "+target+" }")
+	}
+	if err != nil && missingEntry(out) {
+		log.Printf("IP %s відсутній у локальному брандмауері (%s), розблокування не потрібне", ip, l.backend())
+		return nil
+	}
+	if err != nil {
+		log.Printf("Не вдалося розблокувати IP %s локально: %v", ip, err)
+		return err
+	}
+	log.Printf("Успішно розблоковано IP %s локально (%s)", ip, l.backend())
+	return nil
+}
+
+// Чи означає вивід nft/iptables, що елемента, правила, набору чи ланцюжка не існує
+func missingEntry(out []byte) bool {
+	text := string(out)
+	for _, marker := range []string{
+		"No such file or directory",  // nft: немає елемента, набору або таблиці
+		"does a matching rule exist", // iptables: немає правила
+		"No chain/target/match",      // iptables: немає ланцюжка
+		"does not exist",             // iptables-nft
+	} {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Створення таблиці, наборів та ланцюжків для блокувань (виконується один раз для кожної команди).
+// Ланцюжок ip6tables готується лише при першому блокуванні IPv6
+func (l *LocalFirewall) setup(v6 bool) error {
+	cmd := "nft"
+	if l.backend() == "iptables" {
+		cmd = l.iptables(v6)
+	}
+	if l.ready[cmd] {
+		return nil
+	}
+	var err error
+	if cmd == "nft" {
+		err = l.setupNftables()
+	} else {
+		err = l.setupIptables(cmd)
+	}
+	if err != nil {
+		return err
+	}
+	if l.ready == nil {
+		l.ready = make(map[string]bool)
+	}
+	l.ready[cmd] = true
+	return nil
+}
+
+// Окремий ланцюжок, на який переходять INPUT та FORWARD (трафік до подів k3s); cmd - iptables або ip6tables
+func (l *LocalFirewall) setupIptables(cmd string) error {
+	if _, err := l.run(cmd, "-n", "-L", l.chain()); err != nil {
+		if _, err := l.run(cmd, "-N", l.chain()); err != nil {
+			return err
+		}
+	}
+	for _, hook := range []string{"INPUT", "FORWARD"} {
+		if _, err := l.run(cmd, "-C", hook, "-j", l.chain()); err != nil {
+			if _, err := l.run(cmd, "-I", hook, "-j", l.chain()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Таблиця inet з наборами адрес IPv4 та IPv6 і базовими ланцюжками input і forward, що відкидають трафік з наборів
+func (l *LocalFirewall) setupNftables() error {
+	cmds := [][]string{
+		{"add", "table", "inet", l.table()},
+		{"add", "set", "inet", l.table(), l.set(false), "{ type ipv4_addr; flags interval; }"},
+		{"add", "set", "inet", l.table(), l.set(true), "{ type ipv6_addr; flags interval; }"},
+	}
+	for _, args := range cmds {
+		if _, err := l.run("nft", args...); err != nil {
+			return err
+		}
+	}
+	for _, hook := range []string{"input", "forward"} {
+		chain := "{ type filter hook " + hook + " priority -10; policy accept; }"
+		if _, err := l.run("nft", "add", "chain", "inet", l.table(), hook, chain); err != nil {
+			return err
+		}
+		// Правила додаються лише один раз, навіть якщо таблиця вже існувала до запуску
+		out, err := l.run("nft", "list", "chain", "inet", l.table(), hook)
+		if err != nil {
+			return err
+		}
+		for _, family := range []struct {
+			match string // Селектор адреси джерела
+			v6    bool   // Набір IPv6
+		}{{"ip", false}, {"ip6", true}} {
+			if strings.Contains(string(out), family.match+" saddr @"+l.set(family.v6)+" drop") {
+				continue
+			}
+			if _, err := l.run("nft", "add", "rule", "inet", l.table(), hook, family.match, "saddr", "@"+l.set(family.v6), "drop"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Запис діапазону для правила: одна адреса без довжини префікса (як у правил попередніх версій) або CIDR
+func blockTarget(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+// Команда iptables для родини адрес
+func (l *LocalFirewall) iptables(v6 bool) string {
+	if v6 {
+		return "ip6tables"
+	}
+	return "iptables"
+}
+
+// Виконання команди з додаванням виводу до тексту помилки
+func (l *LocalFirewall) run(name string, args ...string) ([]byte, error) {
+	out, err := l.runner.Run(name, args...)
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// Обраний бекенд: nftables (за замовчуванням) або iptables
+func (l *LocalFirewall) backend() string {
+	if l.cfg.Backend == "" {
+		return defaultLocalBackend
+	}
+	return l.cfg.Backend
+}
+
+// Назва таблиці nftables
+func (l *LocalFirewall) table() string {
+	if l.cfg.Table == "" {
+		return defaultNftTable
+	}
+	return l.cfg.Table
+}
+
+// Назва набору nftables; набір IPv6 має суфікс 6 (blocked6)
+func (l *LocalFirewall) set(v6 bool) string {
+	name := l.cfg.Set
+	if name == "" {
+		name = defaultNftSet
+	}
+	if v6 {
+		name += "6"
+	}
+	return name
+}
+
+// Назва ланцюжка iptables
+func (l *LocalFirewall) chain() string {
+	if l.cfg.Chain == "" {
+		return defaultIptChain
+	}
+	return l.cfg.Chain
+}
@@ -0,0 +1,230 @@
+package actioner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Виконавець команд, що записує виклики та повертає помилку для команд із заданими префіксами
+type fakeRunner struct {
+	calls []string          // Виконані команди
+	fail  map[string]string // Префікс команди -> вивід помилки
+}
+
+func (f *fakeRunner) Run(name string, args ...string) ([]byte, error) {
+	cmd := name + " " + strings.Join(args, " ")
+	f.calls = append(f.calls, cmd)
+	for prefix, out := range f.fail {
+		if strings.HasPrefix(cmd, prefix) {
+			return []byte(out), errors.New("exit status 1")
+		}
+	}
+	return nil, nil
+}
+
+// Чи виконувалася команда
+func (f *fakeRunner) ran(cmd string) bool {
+	for _, c := range f.calls {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	nftMissing = "Error: Could not process rule: No such file or directory"
+	iptMissing = "iptables: Bad rule (does a matching rule exist in that chain?)."
+)
+
+func TestLocalFirewallExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ActionerConfig
+		ip      string
+		fail    map[string]string
+		want    string // Команда блокування
+		wantNot string // Команда, якої не має бути
+	}{
+		{
+			name: "nftables ipv4",
+			ip:   "203.0.113.7",
+			want: "nft add element inet setmaster blocked { 203.0.113.7 }",
+		},
+		{
+			name: "nftables ipv6 uses the ipv6 set",
+			ip:   "2001:db8::1",
+			want: "nft add element inet setmaster blocked6 { 2001:db8::1 }",
+		},
+		{
+			name: "nftables prefix",
+			cfg:  config.ActionerConfig{PrefixV6: 64},
+			ip:   "2001:db8::1",
+			want: "nft add element inet setmaster blocked6 { 2001:db8::/64 }",
+		},
+		{
+			name: "iptables ipv4",
+			cfg:  config.ActionerConfig{Backend: "iptables"},
+			ip:   "203.0.113.7",
+			fail: map[string]string{"iptables -C SETMASTER-BLOCK -s": iptMissing},
+			want: "iptables -A SETMASTER-BLOCK -s 203.0.113.7 -j DROP",
+		},
+		{
+			name: "ip6tables ipv6",
+			cfg:  config.ActionerConfig{Backend: "iptables"},
+			ip:   "2001:db8::1",
+			fail: map[string]string{"ip6tables -C SETMASTER-BLOCK -s": iptMissing},
+			want: "ip6tables -A SETMASTER-BLOCK -s 2001:db8::1 -j DROP",
+		},
+		{
+			name:    "iptables rule already present",
+			cfg:     config.ActionerConfig{Backend: "iptables"},
+			ip:      "203.0.113.7",
+			want:    "iptables -C SETMASTER-BLOCK -s 203.0.113.7 -j DROP",
+			wantNot: "iptables -A SETMASTER-BLOCK -s 203.0.113.7 -j DROP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{fail: tt.fail}
+			l := NewLocalFirewallWithRunner(tt.cfg, runner)
+			if err := l.Execute(tt.ip); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !runner.ran(tt.want) {
+				t.Errorf("command %q not run; calls:\n%s", tt.want, strings.Join(runner.calls, "\n"))
+			}
+			if tt.wantNot != "" && runner.ran(tt.wantNot) {
+				t.Errorf("command %q should not run", tt.wantNot)
+			}
+		})
+	}
+}
+
+func TestLocalFirewallSetupOnce(t *testing.T) {
+	runner := &fakeRunner{}
+	l := NewLocalFirewallWithRunner(config.ActionerConfig{}, runner)
+	for _, ip := range []string{"203.0.113.7", "203.0.113.8"} {
+		if err := l.Execute(ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables := 0
+	for _, c := range runner.calls {
+		if c == "nft add table inet setmaster" {
+			tables++
+		}
+	}
+	if tables != 1 {
+		t.Errorf("table created %d times, want 1", tables)
+	}
+	if !runner.ran("nft add rule inet setmaster input ip6 saddr @blocked6 drop") {
+		t.Error("ipv6 drop rule not added")
+	}
+}
+
+func TestLocalFirewallRevert(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ActionerConfig
+		ip      string
+		fail    map[string]string
+		want    string // Очікувана команда
+		wantNot string // Команда, якої не має бути
+		wantErr bool
+	}{
+		{
+			name: "nftables ipv4",
+			ip:   "203.0.113.7",
+			want: "nft delete element inet setmaster blocked { 203.0.113.7 }",
+		},
+		{
+			name: "nftables ipv6",
+			ip:   "2001:db8::1",
+			want: "nft delete element inet setmaster blocked6 { 2001:db8::1 }",
+		},
+		{
+			name: "nftables element already gone",
+			ip:   "203.0.113.7",
+			fail: map[string]string{"nft delete element": nftMissing},
+			want: "nft delete element inet setmaster blocked { 203.0.113.7 }",
+		},
+		{
+			name: "nftables table gone after reboot",
+			ip:   "2001:db8::1",
+			fail: map[string]string{"nft delete element": "Error: No such file or directory; did you mean table 'filter' in family inet?"},
+			want: "nft delete element inet setmaster blocked6 { 2001:db8::1 }",
+		},
+		{
+			name:    "nftables other error",
+			ip:      "203.0.113.7",
+			fail:    map[string]string{"nft delete element": "Error: Operation not permitted"},
+			wantErr: true,
+		},
+		{
+			name: "iptables ipv4",
+			cfg:  config.ActionerConfig{Backend: "iptables"},
+			ip:   "203.0.113.7",
+			want: "iptables -D SETMASTER-BLOCK -s 203.0.113.7 -j DROP",
+		},
+		{
+			name: "ip6tables ipv6",
+			cfg:  config.ActionerConfig{Backend: "iptables"},
+			ip:   "2001:db8::1",
+			want: "ip6tables -D SETMASTER-BLOCK -s 2001:db8::1 -j DROP",
+		},
+		{
+			name:    "iptables rule already gone",
+			cfg:     config.ActionerConfig{Backend: "iptables"},
+			ip:      "203.0.113.7",
+			fail:    map[string]string{"iptables -C": iptMissing},
+			wantNot: "iptables -D SETMASTER-BLOCK -s 203.0.113.7 -j DROP",
+		},
+		{
+			name:    "iptables chain gone after flush",
+			cfg:     config.ActionerConfig{Backend: "iptables"},
+			ip:      "2001:db8::1",
+			fail:    map[string]string{"ip6tables -C": "ip6tables: No chain/target/match by that name."},
+			wantNot: "ip6tables -D SETMASTER-BLOCK -s 2001:db8::1 -j DROP",
+		},
+		{
+			name:    "iptables permission denied",
+			cfg:     config.ActionerConfig{Backend: "iptables"},
+			ip:      "203.0.113.7",
+			fail:    map[string]string{"iptables -C": "iptables v1.8.7 (nf_tables): Could not fetch rule set generation id: Permission denied (you must be root)"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{fail: tt.fail}
+			l := NewLocalFirewallWithRunner(tt.cfg, runner)
+			err := l.Revert(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Revert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != "" && !runner.ran(tt.want) {
+				t.Errorf("command %q not run; calls:\n%s", tt.want, strings.Join(runner.calls, "\n"))
+			}
+			if tt.wantNot != "" && runner.ran(tt.wantNot) {
+				t.Errorf("command %q should not run", tt.wantNot)
+			}
+		})
+	}
+}
+
+func TestLocalFirewallRevertTwice(t *testing.T) {
+	runner := &fakeRunner{}
+	l := NewLocalFirewallWithRunner(config.ActionerConfig{}, runner)
+	if err := l.Revert("203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	// Другий виклик бачить, що елемента вже немає
+	runner.fail = map[string]string{"nft delete element": nftMissing}
+	if err := l.Revert("203.0.113.7"); err != nil {
+		t.Fatalf("second Revert() error = %v", err)
+	}
+}
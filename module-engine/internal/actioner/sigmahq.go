@@ -50,10 +50,10 @@ func (s *SigmaHQActioner) Execute(ip string) error {
 
 	// Створюємо подію у форматі SigmaHQ
 	sigmaEvent := SigmaHQEvent{
-		Title:       fmt.Sprintf("Detected Failed SSH Login Attempt for IP %s", ip),        // Формуємо заголовок із IP
-		ID:          fmt.Sprintf("event-%s-%s", ip, time.Now().Format("20060102T150405Z")), // Генеруємо унікальний ID
-		Description: "Detects failed SSH login attempts based on Falco event",              // Задаємо опис
-		Level:       "medium",                                                              // Встановлюємо середній рівень критичності
+		Title:       fmt.Sprintf("Detected Failed SSH Login Attempt for IP %s", ip),                      // Формуємо заголовок із IP
+		ID:          fmt.Sprintf("event-%s-%s", subjectLabel(ip), time.Now().Format("20060102T150405Z")), // Генеруємо унікальний ID
+		Description: "Detects failed SSH login attempts based on Falco event",                            // Задаємо опис
+		Level:       "medium",                                                                            // Встановлюємо середній рівень критичності
 		LogSource: struct { // Налаштовуємо джерело логів
 			Product string `yaml:"product"`
 			Service string `yaml:"service"`
@@ -98,7 +98,7 @@ func (s *SigmaHQActioner) Execute(ip string) error {
 	defer client.Close() // Закриваємо клієнт після завершення роботи
 
 	// Генеруємо ім’я файлу з часовою міткою
-	fileName := fmt.Sprintf("sigmahq/%s-%s.yaml", ip, time.Now().Format("20060102T150405Z"))
+	fileName := fmt.Sprintf("sigmahq/%s-%s.yaml", subjectLabel(ip), time.Now().Format("20060102T150405Z"))
 	bucket := client.Bucket(bucketName) // Отримуємо бакет
 	obj := bucket.Object(fileName)      // Створюємо об’єкт для запису
 
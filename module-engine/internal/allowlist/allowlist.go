@@ -0,0 +1,329 @@
+package allowlist
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Приватні діапазони: RFC1918, loopback, link-local та унікальні локальні адреси IPv6
+var privateRanges = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// Діапазони Google Cloud: сервер метаданих, health check балансувальників та IAP
+var gcpRanges = []string{
+	"169.254.169.254/32",
+	"35.191.0.0/16",
+	"130.211.0.0/22",
+	"209.85.152.0/22",
+	"209.85.204.0/22",
+	"35.235.240.0/20",
+}
+
+// Час, протягом якого зберігаються адреси, отримані для імен хостів
+const resolveTTL = 5 * time.Minute
+
+// Пауза перед повторним розв'язанням імені після помилки
+const resolveRetry = 30 * time.Second
+
+// Сховище записів, доданих через дашборд або кнопку сповіщення
+type Store interface {
+	GetAllowlist() ([]models.AllowlistEntry, error)
+	AddAllowlist(entry models.AllowlistEntry) error
+	DeleteAllowlist(id int) error
+}
+
+// Функція розв'язання імені хоста (net.LookupHost); замінюється для перевірки без DNS
+type Resolver func(host string) ([]string, error)
+
+// Розв'язані адреси імені хоста
+type resolved struct {
+	addrs      []netip.Addr // Адреси хоста
+	expires    time.Time    // Час, після якого ім'я розв'язується повторно
+	refreshing bool         // Оновлення вже виконується у фоні
+}
+
+// Список дозволених із конфігурації та бази даних
+type List struct {
+	static  []string             // Записи конфігурації у вигляді для відображення
+	entries []entry              // Розібрані записи конфігурації
+	store   Store                // Записи з бази даних
+	resolve Resolver             // Розв'язання імен хостів
+	mu      sync.Mutex           // Захист кешів записів бази та імен
+	stored  []entry              // Розібрані записи бази даних
+	loaded  bool                 // Записи бази прочитано після останньої зміни
+	cache   map[string]*resolved // Адреси імен хостів
+}
+
+// Розібраний запис: діапазон адрес, ім'я хоста або довільне значення суб'єкта
+type entry struct {
+	raw    string       // Запис у вигляді з конфігурації
+	prefix netip.Prefix // Діапазон адрес (для IP та CIDR)
+	host   string       // Ім'я хоста
+}
+
+// Новий список дозволених
+func New(cfg config.AllowlistConfig, store Store) (*List, error) {
+	return NewWithResolver(cfg, store, net.LookupHost)
+}
+
+// Новий список дозволених з власною функцією розв'язання імен
+func NewWithResolver(cfg config.AllowlistConfig, store Store, resolve Resolver) (*List, error) {
+	l := &List{store: store, resolve: resolve, cache: make(map[string]*resolved)}
+	values := append([]string{}, cfg.Entries...)
+	if cfg.Private {
+		values = append(values, privateRanges...)
+	}
+	if cfg.GCP {
+		values = append(values, gcpRanges...)
+	}
+	if cfg.Local {
+		local, err := localAddrs()
+		if err != nil {
+			return nil, fmt.Errorf("не вдалося отримати адреси інтерфейсів: %v", err)
+		}
+		values = append(values, local...)
+	}
+	for _, value := range values {
+		e, err := parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("allowlist: %v", err)
+		}
+		l.entries = append(l.entries, e)
+		l.static = append(l.static, e.raw)
+	}
+	return l, nil
+}
+
+// Перевірка та нормалізація запису, що додається через дашборд
+func Validate(value string) (string, error) {
+	e, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	return e.raw, nil
+}
+
+// Записи конфігурації (лише для читання)
+func (l *List) Static() []string {
+	return l.static
+}
+
+// Додавання запису до бази даних; кеш записів бази перечитується при наступній перевірці
+func (l *List) Add(entry models.AllowlistEntry) error {
+	if err := l.store.AddAllowlist(entry); err != nil {
+		return err
+	}
+	l.invalidate()
+	return nil
+}
+
+// Видалення запису з бази даних
+func (l *List) Delete(id int) error {
+	if err := l.store.DeleteAllowlist(id); err != nil {
+		return err
+	}
+	l.invalidate()
+	return nil
+}
+
+// Скидання кешу записів бази даних
+func (l *List) invalidate() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loaded = false
+}
+
+// Записи конфігурації та бази даних. Записи бази читаються лише після змін через Add або Delete;
+// якщо прочитати їх не вдалося, використовується попередній результат, а читання повторюється
+func (l *List) all() []entry {
+	if l.store == nil {
+		return l.entries
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.loaded {
+		stored, err := l.store.GetAllowlist()
+		if err != nil {
+			log.Printf("Не вдалося отримати список дозволених із бази даних: %v", err)
+		} else {
+			l.stored = nil
+			for _, s := range stored {
+				e, err := parse(s.Value)
+				if err != nil {
+					continue // Некоректний запис у базі не повинен блокувати перевірку інших
+				}
+				l.stored = append(l.stored, e)
+			}
+			l.loaded = true
+		}
+	}
+	return append(append([]entry(nil), l.entries...), l.stored...)
+}
+
+// Пошук запису, що охоплює суб'єкт; повертає запис для логування.
+// Для суб'єкта у вигляді CIDR достатньо перетину з будь-яким записом
+func (l *List) Match(subject string) (string, bool) {
+	var target netip.Prefix // Діапазон суб'єкта (одна адреса або мережа)
+	if addr, err := netip.ParseAddr(subject); err == nil {
+		addr = addr.Unmap() // IPv4-mapped IPv6 порівнюється як IPv4
+		target = netip.PrefixFrom(addr, addr.BitLen())
+	} else if prefix, err := netip.ParsePrefix(subject); err == nil {
+		target = prefix.Masked()
+	}
+	isAddr := target.IsValid()
+
+	for _, e := range l.all() {
+		switch {
+		case e.raw == subject:
+			return e.raw, true
+		case !isAddr:
+			continue // Суб'єкт не є IP-адресою чи мережею: підходить лише точний збіг
+		case e.prefix.IsValid():
+			if e.prefix.Overlaps(target) {
+				return e.raw, true
+			}
+		case e.host != "":
+			for _, a := range l.lookup(e.host) {
+				if target.Contains(a) {
+					return e.raw, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Адреси імені хоста з кешем. Застарілі адреси повертаються одразу й оновлюються у фоні,
+// тому повільний DNS не затримує перевірку подій; ім'я розв'язується без блокування списку
+func (l *List) lookup(host string) []netip.Addr {
+	l.mu.Lock()
+	cached, ok := l.cache[host]
+	if ok {
+		if time.Now().After(cached.expires) && !cached.refreshing {
+			cached.refreshing = true
+			go l.refresh(host)
+		}
+		addrs := cached.addrs
+		l.mu.Unlock()
+		return addrs
+	}
+	l.mu.Unlock()
+	return l.refresh(host) // Перше звернення: адрес ще немає
+}
+
+// Розв'язання імені хоста та збереження результату; при помилці залишаються попередні адреси
+func (l *List) refresh(host string) []netip.Addr {
+	names, err := l.resolve(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cached, ok := l.cache[host]
+	if !ok {
+		cached = &resolved{}
+		l.cache[host] = cached
+	}
+	cached.refreshing = false
+	if err != nil {
+		log.Printf("Не вдалося розв'язати ім'я %s зі списку дозволених: %v", host, err)
+		cached.expires = time.Now().Add(resolveRetry)
+		return cached.addrs
+	}
+	var addrs []netip.Addr
+	for _, name := range names {
+		if addr, err := netip.ParseAddr(name); err == nil {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	cached.addrs = addrs
+	cached.expires = time.Now().Add(resolveTTL)
+	return addrs
+}
+
+// Розбір запису: CIDR, IP-адреса, ім'я хоста або інше значення суб'єкта
+func parse(value string) (entry, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return entry{}, fmt.Errorf("порожній запис")
+	}
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return entry{}, fmt.Errorf("некоректний CIDR %q: %v", value, err)
+		}
+		return entry{raw: prefix.Masked().String(), prefix: prefix.Masked()}, nil
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return entry{raw: addr.String(), prefix: netip.PrefixFrom(addr, addr.BitLen())}, nil
+	}
+	if looksLikeAddr(value) {
+		return entry{}, fmt.Errorf("некоректна IP-адреса %q", value)
+	}
+	// Ім'я хоста розв'язується в адреси; інші значення (наприклад, імена користувачів) порівнюються точно
+	if isHostname(value) {
+		return entry{raw: value, host: strings.ToLower(strings.TrimSuffix(value, "."))}, nil
+	}
+	return entry{raw: value}, nil
+}
+
+// Значення, схоже на IP-адресу з помилкою: лише цифри та крапки або шістнадцяткові цифри з двокрапками
+func looksLikeAddr(value string) bool {
+	digits := strings.Trim(value, "0123456789.") == ""
+	hex := strings.Count(value, ":") >= 2 && strings.Trim(strings.ToLower(value), "0123456789abcdef:.") == ""
+	return digits || hex
+}
+
+// Перевірка синтаксису імені хоста (RFC 1123): щонайменше дві мітки з літер, цифр і дефісів
+// довжиною до 63 символів, без дефіса на початку чи в кінці мітки; домен верхнього рівня не числовий
+func isHostname(value string) bool {
+	value = strings.TrimSuffix(value, ".")
+	if len(value) > 253 {
+		return false
+	}
+	labels := strings.Split(value, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return strings.Trim(labels[len(labels)-1], "0123456789") != ""
+}
+
+// Адреси мережевих інтерфейсів хоста
+func localAddrs() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			values = append(values, ipNet.IP.String())
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,345 @@
+package allowlist
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Сховище записів у пам'яті з лічильником читань
+type fakeStore struct {
+	mu      sync.Mutex
+	entries []models.AllowlistEntry
+	reads   int
+	fail    error // Помилка читання
+}
+
+func (f *fakeStore) GetAllowlist() ([]models.AllowlistEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	return append([]models.AllowlistEntry(nil), f.entries...), nil
+}
+
+func (f *fakeStore) AddAllowlist(entry models.AllowlistEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry.ID = len(f.entries) + 1
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func (f *fakeStore) DeleteAllowlist(id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, e := range f.entries {
+		if e.ID == id {
+			f.entries = append(f.entries[:i], f.entries[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+// Розв'язання імен за таблицею; імена з gate чекають, доки канал не закрито
+type fakeResolver struct {
+	mu    sync.Mutex
+	addrs map[string][]string
+	gate  map[string]chan struct{}
+	calls map[string]int
+}
+
+func newFakeResolver(addrs map[string][]string) *fakeResolver {
+	return &fakeResolver{addrs: addrs, gate: map[string]chan struct{}{}, calls: map[string]int{}}
+}
+
+func (f *fakeResolver) resolve(host string) ([]string, error) {
+	f.mu.Lock()
+	f.calls[host]++
+	gate := f.gate[host]
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	addrs, ok := f.addrs[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func (f *fakeResolver) set(host string, addrs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addrs[host] = addrs
+}
+
+func (f *fakeResolver) block(host string) chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan struct{})
+	f.gate[host] = ch
+	return ch
+}
+
+func (f *fakeResolver) callCount(host string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[host]
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		raw     string
+		host    string
+		prefix  string
+		wantErr bool
+	}{
+		{value: "203.0.113.7", raw: "203.0.113.7", prefix: "203.0.113.7/32"},
+		{value: " ::ffff:203.0.113.7 ", raw: "203.0.113.7", prefix: "203.0.113.7/32"},
+		{value: "10.1.2.3/8", raw: "10.0.0.0/8", prefix: "10.0.0.0/8"},
+		{value: "2001:db8::1", raw: "2001:db8::1", prefix: "2001:db8::1/128"},
+		{value: "gw.example.com", raw: "gw.example.com", host: "gw.example.com"},
+		{value: "GW.Example.COM.", raw: "GW.Example.COM.", host: "gw.example.com"},
+		{value: "ci-runner-1.corp.internal", raw: "ci-runner-1.corp.internal", host: "ci-runner-1.corp.internal"},
+		{value: "root", raw: "root"},
+		{value: "john.doe@example.com", raw: "john.doe@example.com"},
+		{value: "svc_account.prod", raw: "svc_account.prod"},
+		{value: "-bad.example.com", raw: "-bad.example.com"},
+		{value: "two..dots.example.com", raw: "two..dots.example.com"},
+		{value: "release.2024", raw: "release.2024"},
+		{value: "C:\\Windows\\cmd.exe", raw: "C:\\Windows\\cmd.exe"},
+		{value: "203.0.113", wantErr: true},
+		{value: "203.0.113.256", wantErr: true},
+		{value: "2001:db8:::1", wantErr: true},
+		{value: "10.0.0.0/33", wantErr: true},
+		{value: "  ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			e, err := parse(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if e.raw != tt.raw || e.host != tt.host {
+				t.Errorf("parse() = raw %q host %q, want raw %q host %q", e.raw, e.host, tt.raw, tt.host)
+			}
+			if got := e.prefix.String(); tt.prefix != "" && got != tt.prefix || tt.prefix == "" && e.prefix.IsValid() {
+				t.Errorf("prefix = %s, want %q", got, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	resolver := newFakeResolver(map[string][]string{"gw.example.com": {"192.0.2.10", "2001:db8::10"}})
+	l, err := NewWithResolver(config.AllowlistConfig{Entries: []string{"198.51.100.0/24", "gw.example.com", "root"}}, nil, resolver.resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{"198.51.100.7", "198.51.100.0/24"},
+		{"198.51.0.0/16", "198.51.100.0/24"}, // Мережа, що перетинається із записом
+		{"192.0.2.10", "gw.example.com"},
+		{"::ffff:192.0.2.10", "gw.example.com"},
+		{"2001:db8::10", "gw.example.com"},
+		{"root", "root"},
+		{"gw.example.com", "gw.example.com"},
+		{"192.0.2.11", ""},
+		{"admin", ""},
+	}
+	for _, tt := range tests {
+		got, ok := l.Match(tt.subject)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Match(%s) = %q, %v, want %q", tt.subject, got, ok, tt.want)
+		}
+	}
+}
+
+// Записи бази читаються один раз і перечитуються лише після Add або Delete
+func TestStoredEntriesCached(t *testing.T) {
+	store := &fakeStore{entries: []models.AllowlistEntry{{ID: 1, Value: "203.0.113.7"}}}
+	l, err := NewWithResolver(config.AllowlistConfig{}, store, newFakeResolver(nil).resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := l.Match("203.0.113.7"); !ok {
+			t.Fatal("stored entry not matched")
+		}
+	}
+	if n := store.readCount(); n != 1 {
+		t.Errorf("store read %d times, want 1", n)
+	}
+
+	if err := l.Add(models.AllowlistEntry{Value: "198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Match("198.51.100.9"); !ok {
+		t.Error("entry added with Add() not matched")
+	}
+	if err := l.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Match("203.0.113.7"); ok {
+		t.Error("entry removed with Delete() still matched")
+	}
+	if n := store.readCount(); n != 3 {
+		t.Errorf("store read %d times, want 3", n)
+	}
+}
+
+// Помилка читання бази не скидає попередні записи, а читання повторюється
+func TestStoredEntriesReadError(t *testing.T) {
+	store := &fakeStore{entries: []models.AllowlistEntry{{ID: 1, Value: "203.0.113.7"}}}
+	l, err := NewWithResolver(config.AllowlistConfig{Entries: []string{"10.0.0.0/8"}}, store, newFakeResolver(nil).resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Match("203.0.113.7")
+
+	store.fail = errors.New("database is locked")
+	l.invalidate()
+	if _, ok := l.Match("203.0.113.7"); !ok {
+		t.Error("previous stored entries dropped after read error")
+	}
+	if _, ok := l.Match("10.1.1.1"); !ok {
+		t.Error("config entries not matched after read error")
+	}
+	if n := store.readCount(); n != 3 {
+		t.Errorf("store read %d times, want a retry on every check after an error", n)
+	}
+}
+
+// Повільний DNS для одного імені не блокує перевірку інших записів
+func TestSlowResolveDoesNotBlock(t *testing.T) {
+	resolver := newFakeResolver(map[string][]string{"fast.example.com": {"192.0.2.1"}, "slow.example.com": {"192.0.2.2"}})
+	l, err := NewWithResolver(config.AllowlistConfig{Entries: []string{"fast.example.com", "slow.example.com"}}, nil, resolver.resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Match("192.0.2.1") // Адреса fast.example.com потрапляє до кешу
+
+	gate := resolver.block("slow.example.com")
+	slow := make(chan bool)
+	go func() {
+		_, ok := l.Match("198.51.100.1") // Перевіряє всі записи й чекає на slow.example.com
+		slow <- ok
+	}()
+	for resolver.callCount("slow.example.com") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan bool)
+	go func() {
+		_, ok := l.Match("192.0.2.1")
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("cached host not matched")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Match blocked while another host was resolving")
+	}
+
+	close(gate)
+	if <-slow {
+		t.Error("198.51.100.1 matched")
+	}
+}
+
+// Застарілі адреси використовуються, доки ім'я оновлюється у фоні
+func TestStaleAddressesRefreshedInBackground(t *testing.T) {
+	const host = "gw.example.com"
+	resolver := newFakeResolver(map[string][]string{host: {"192.0.2.10"}})
+	l, err := NewWithResolver(config.AllowlistConfig{Entries: []string{host}}, nil, resolver.resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Match("192.0.2.10"); !ok {
+		t.Fatal("host not matched")
+	}
+	expire := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cache[host].expires = time.Now().Add(-time.Second)
+	}
+
+	// Адреса хоста змінилася, а DNS відповідає повільно
+	expire()
+	resolver.set(host, "192.0.2.20")
+	gate := resolver.block(host)
+	for i := 0; i < 10; i++ {
+		if _, ok := l.Match("192.0.2.10"); !ok {
+			t.Fatal("stale address not used while refreshing")
+		}
+	}
+	close(gate)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := l.Match("192.0.2.20"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("address not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := resolver.callCount(host); n != 2 {
+		t.Errorf("resolved %d times, want one refresh", n)
+	}
+
+	// Помилка DNS не скидає відомі адреси
+	expire()
+	resolver.mu.Lock()
+	delete(resolver.addrs, host)
+	resolver.gate = map[string]chan struct{}{}
+	resolver.mu.Unlock()
+	l.Match("192.0.2.20")
+	refreshed := func() (bool, time.Time) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return !l.cache[host].refreshing, l.cache[host].expires
+	}
+	for done, _ := refreshed(); !done; done, _ = refreshed() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := l.Match("192.0.2.20"); !ok {
+		t.Error("known addresses dropped after resolve error")
+	}
+	if _, expires := refreshed(); time.Until(expires) > resolveRetry || time.Until(expires) <= 0 {
+		t.Errorf("retry after error in %s, want within %s", time.Until(expires), resolveRetry)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if got, err := Validate("10.1.2.3/8"); err != nil || got != "10.0.0.0/8" {
+		t.Errorf("Validate() = %q, %v", got, err)
+	}
+	if _, err := Validate("300.1.1.1"); err == nil {
+		t.Error("Validate() accepted a malformed address")
+	}
+}
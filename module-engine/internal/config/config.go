@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -9,31 +11,142 @@ import (
 // Основна структура конфігурації програми
 type Config struct {
 	Server struct {
-		Port          int               `yaml:"port"`           // Порт основного сервера
-		DashboardPort int               `yaml:"dashboard_port"` // Порт для дашборду
-		Aliases       map[string]string `yaml:"aliases"`        // Мапа псевдонімів для серверів
+		Port          int              `yaml:"port"`           // Порт основного сервера
+		DashboardPort int              `yaml:"dashboard_port"` // Порт для дашборду
+		Aliases       map[string]Alias `yaml:"aliases"`        // Мапа псевдонімів для серверів
+		TLS           struct {         // Налаштування TLS основного сервера
+			CertFile     string `yaml:"cert_file"`      // Сертифікат сервера
+			KeyFile      string `yaml:"key_file"`       // Приватний ключ сервера
+			ClientCAFile string `yaml:"client_ca_file"` // CA для перевірки клієнтських сертифікатів (mTLS)
+		} `yaml:"tls"`
 	} `yaml:"server"`
-	Scenarios map[string]struct { // Налаштування сценаріїв
-		Rule   string         `yaml:"rule"`   // Правило для спрацьовування сценарію
-		Params ScenarioParams `yaml:"params"` // Параметри сценарію
-		Action ScenarioAction `yaml:"action"` // Дія, що виконується при спрацьовуванні
-	} `yaml:"scenarios"`
+	Scenarios map[string]Scenario       `yaml:"scenarios"` // Налаштування сценаріїв
 	Actioners map[string]ActionerConfig `yaml:"actioners"` // Налаштування виконавців дій
-	Notifier  struct {                  // Налаштування системи сповіщень
+	Events    struct {                  // Налаштування зберігання подій
+		Retention int `yaml:"retention"` // Час зберігання подій (в секундах)
+	} `yaml:"events"`
+	Allowlist AllowlistConfig `yaml:"allowlist"` // Адреси, для яких діячі ніколи не виконуються
+	Notifier  struct {        // Налаштування системи сповіщень
 		Slack struct {
-			WebhookURL  string `yaml:"webhook_url"`  // URL вебхука для Slack
-			CallbackURL string `yaml:"callback_url"` // URL для зворотних викликів
-			BotToken    string `yaml:"bot_token"`    // Токен бота Slack
-			Channel     string `yaml:"channel"`      // Канал для надсилання повідомлень
+			WebhookURL    string `yaml:"webhook_url"`    // URL вебхука для Slack
+			CallbackURL   string `yaml:"callback_url"`   // URL для зворотних викликів
+			BotToken      string `yaml:"bot_token"`      // Токен бота Slack
+			Channel       string `yaml:"channel"`        // Канал для надсилання повідомлень
+			SigningSecret string `yaml:"signing_secret"` // Секрет підпису запитів Slack для перевірки зворотних викликів
 		} `yaml:"slack"`
+		Teams    TeamsConfig    `yaml:"teams"`    // Microsoft Teams (вхідний вебхук)
+		Telegram TelegramConfig `yaml:"telegram"` // Telegram-бот з inline-клавіатурою
+		Email    EmailConfig    `yaml:"email"`    // Електронна пошта через SMTP
+		Webhook  WebhookConfig  `yaml:"webhook"`  // Довільний вихідний вебхук
+		Approval ApprovalConfig `yaml:"approval"` // Підписані посилання для вибору дії без зворотних викликів
 	} `yaml:"notifier"`
 }
 
+// Налаштування сповіщень Microsoft Teams
+type TeamsConfig struct {
+	WebhookURL string `yaml:"webhook_url"` // URL вхідного вебхука (Workflows або конектор)
+}
+
+// Налаштування сповіщень Telegram
+type TelegramConfig struct {
+	BotToken      string `yaml:"bot_token"`      // Токен бота від BotFather
+	ChatID        string `yaml:"chat_id"`        // Чат або канал для повідомлень
+	CallbackPath  string `yaml:"callback_path"`  // Шлях вебхука бота для натискань кнопок (за замовчуванням /telegram/callback)
+	WebhookSecret string `yaml:"webhook_secret"` // secret_token, вказаний у setWebhook
+}
+
+// Налаштування сповіщень електронною поштою
+type EmailConfig struct {
+	Host     string   `yaml:"host"`     // SMTP-сервер
+	Port     int      `yaml:"port"`     // Порт SMTP-сервера (за замовчуванням 587)
+	Username string   `yaml:"username"` // Ім'я користувача SMTP (порожнє - без автентифікації)
+	Password string   `yaml:"password"` // Пароль SMTP
+	From     string   `yaml:"from"`     // Адреса відправника
+	To       []string `yaml:"to"`       // Адреси отримувачів
+}
+
+// Налаштування вихідного вебхука
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`     // Адреса, на яку надсилаються сповіщення
+	Headers map[string]string `yaml:"headers"` // Додаткові заголовки запиту
+	Secret  string            `yaml:"secret"`  // Секрет підпису тіла HMAC-SHA256 (заголовок X-Signature)
+}
+
+// Налаштування підписаних посилань для вибору дії (Teams, email, вебхук)
+type ApprovalConfig struct {
+	BaseURL string `yaml:"base_url"` // Зовнішня адреса основного сервера, наприклад https://hostname:2808
+	Secret  string `yaml:"secret"`   // Секрет підпису посилань
+	TTL     int    `yaml:"ttl"`      // Час дії посилання (в хвилинах, за замовчуванням 60)
+}
+
+// Налаштування псевдоніма: шлях для прийому подій та тип їх джерела
+type Alias struct {
+	Path     string            `yaml:"path"`     // Шлях HTTP для прийому подій
+	File     string            `yaml:"file"`     // Файл журналу з подіями по одній у рядку (необов'язково)
+	Source   string            `yaml:"source"`   // Тип джерела: falco (за замовчуванням), hubble, cowrie або json
+	Rule     string            `yaml:"rule"`     // Назва правила для подій без власного правила (hubble, json)
+	Priority string            `yaml:"priority"` // Пріоритет подій без власного пріоритету
+	Fields   map[string]string `yaml:"fields"`   // Відповідність полів події виразам JSONPath (для json)
+	Auth     AliasAuth         `yaml:"auth"`     // Автентифікація запитів до псевдоніма
+}
+
+// Налаштування автентифікації запитів з подіями
+type AliasAuth struct {
+	Mode            string   `yaml:"mode"`             // Режим: none (за замовчуванням), bearer, hmac або mtls
+	Token           string   `yaml:"token"`            // Спільний токен для режиму bearer
+	Secret          string   `yaml:"secret"`           // Секрет підпису тіла запиту для режиму hmac
+	Header          string   `yaml:"header"`           // Заголовок з підписом HMAC-SHA256 (за замовчуванням X-Signature)
+	TimestampHeader string   `yaml:"timestamp_header"` // Заголовок з часом підпису в секундах Unix (за замовчуванням X-Timestamp)
+	ClientNames     []string `yaml:"client_names"`     // Дозволені CN або DNS-імена клієнтських сертифікатів (mtls)
+}
+
+// Псевдонім можна задати рядком зі шляхом (джерело falco) або структурою
+func (a *Alias) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var path string
+	if err := unmarshal(&path); err == nil {
+		*a = Alias{Path: path}
+		return nil
+	}
+	type plain Alias // Тип без методу UnmarshalYAML, щоб уникнути рекурсії
+	return unmarshal((*plain)(a))
+}
+
+// Список дозволених: події для цих адрес не активують сценаріїв, а діячі для них не виконуються
+type AllowlistConfig struct {
+	Entries []string `yaml:"entries"` // IP-адреси, CIDR або повні імена хостів (розв'язуються в IP)
+	Private bool     `yaml:"private"` // Приватні діапазони RFC1918, loopback та link-local
+	GCP     bool     `yaml:"gcp"`     // Сервер метаданих, health check та IAP Google Cloud
+	Local   bool     `yaml:"local"`   // Адреси мережевих інтерфейсів цього хоста
+}
+
+// Налаштування сценарію
+type Scenario struct {
+	Rule         string            `yaml:"rule"`          // Правило для спрацьовування сценарію
+	Priority     string            `yaml:"priority"`      // Мінімальний пріоритет події (необов'язково)
+	Tags         []string          `yaml:"tags"`          // Теги, які мають бути присутні в події (необов'язково)
+	Source       string            `yaml:"source"`        // Джерело події, наприклад syscall або k8s_audit (необов'язково)
+	Fields       map[string]string `yaml:"fields"`        // Значення полів події; підтримується шаблон * (необов'язково)
+	SubjectField string            `yaml:"subject_field"` // Поле output_fields із суб'єктом події (за замовчуванням fd.rip)
+	Params       ScenarioParams    `yaml:"params"`        // Параметри сценарію
+	Action       ScenarioAction    `yaml:"action"`        // Дія, що виконується при спрацьовуванні
+	Aggregate    AggregateConfig   `yaml:"aggregate"`     // Об'єднання блокувань адрес однієї мережі (необов'язково)
+}
+
+// Об'єднання блокувань: коли в одній мережі заблоковано threshold адрес за window секунд,
+// їхні правила замінюються одним блокуванням мережі з власним записом і розкладом розблокування
+type AggregateConfig struct {
+	Threshold    int `yaml:"threshold"`     // Кількість заблокованих адрес мережі (0 - об'єднання вимкнено)
+	Window       int `yaml:"window"`        // Вікно підрахунку блокувань (в секундах, за замовчуванням 3600)
+	PrefixV4     int `yaml:"prefix_v4"`     // Довжина префікса мережі IPv4 (за замовчуванням 24)
+	PrefixV6     int `yaml:"prefix_v6"`     // Довжина префікса мережі IPv6 (за замовчуванням 48)
+	UnblockAfter int `yaml:"unblock_after"` // Час блокування мережі (в хвилинах, за замовчуванням як у сценарію)
+}
+
 // Параметри для сценаріїв
 type ScenarioParams struct {
 	TriggerCount  int `yaml:"trigger_count"`  // Кількість спрацьовувань для активації
 	TriggerWindow int `yaml:"trigger_window"` // Часовий проміжок для підрахунку спрацьовувань (в секундах)
-	UnblockAfter  int `yaml:"unblock_after"`  // Час після якого знімається блокування (в секундах)
+	UnblockAfter  int `yaml:"unblock_after"`  // Час після якого знімається блокування (в хвилинах)
 }
 
 // Дії які виконуються в сценарії
@@ -47,14 +160,33 @@ type NotifierConfig struct {
 	Enabled bool   `yaml:"enabled"` // Увімкнено чи вимкнено сповіщення
 	Name    string `yaml:"name"`    // Ім'я нотифікатора
 	Timeout int    `yaml:"timeout"` // Таймаут для сповіщень (в секундах)
+	Snooze  int    `yaml:"snooze"`  // На скільки хвилин відкладається сценарій кнопкою snooze (за замовчуванням 60)
 }
 
 // Конфігурація діяча
 type ActionerConfig struct {
-	ProjectID       string `yaml:"project_id"`       // Ідентифікатор проєкту
-	BucketName      string `yaml:"bucket_name"`      // Назва бакета для зберігання
-	LogCount        int    `yaml:"log_count"`        // Кількість логів для обробки
-	CredentialsFile string `yaml:"credentials_file"` // Шлях до файлу з обліковими даними
+	ProjectID       string            `yaml:"project_id"`       // Ідентифікатор проєкту
+	BucketName      string            `yaml:"bucket_name"`      // Назва бакета для зберігання
+	LogCount        int               `yaml:"log_count"`        // Кількість логів для обробки
+	CredentialsFile string            `yaml:"credentials_file"` // Шлях до файлу з обліковими даними
+	Backend         string            `yaml:"backend"`          // Бекенд локального брандмауера: nftables або iptables
+	Table           string            `yaml:"table"`            // Таблиця nftables
+	Set             string            `yaml:"set"`              // Набір адрес nftables (IPv6 - набір з суфіксом 6)
+	Chain           string            `yaml:"chain"`            // Ланцюжок iptables
+	Namespace       string            `yaml:"namespace"`        // Простір імен Kubernetes для політик
+	Selector        map[string]string `yaml:"selector"`         // Мітки подів, до яких застосовується політика
+	Kubeconfig      string            `yaml:"kubeconfig"`       // Шлях до kubeconfig (порожній - конфігурація з кластера)
+	Clusterwide     bool              `yaml:"clusterwide"`      // Використовувати CiliumClusterwideNetworkPolicy
+	PrefixV4        int               `yaml:"prefix_v4"`        // Довжина префікса блокування IPv4 (за замовчуванням 32)
+	PrefixV6        int               `yaml:"prefix_v6"`        // Довжина префікса блокування IPv6 (за замовчуванням 128)
+	Consolidate     bool              `yaml:"consolidate"`      // Спільні правила GCP зі списками діапазонів замість правила на кожен IP
+	RulePrefix      string            `yaml:"rule_prefix"`      // Префікс імен спільних правил (за замовчуванням setmaster-deny)
+	MaxRanges       int               `yaml:"max_ranges"`       // Кількість діапазонів в одному спільному правилі (за замовчуванням 256)
+	Network         string            `yaml:"network"`          // Мережа VPC правил GCP: ім'я або URL (за замовчуванням default)
+	Priority        *int              `yaml:"priority"`         // Пріоритет правил GCP, 0-65535 (за замовчуванням 1000)
+	Direction       string            `yaml:"direction"`        // Напрямок правил GCP: INGRESS (за замовчуванням) або EGRESS
+	TargetTags      []string          `yaml:"target_tags"`      // Мережеві теги ВМ, до яких застосовуються правила GCP (порожні - усі ВМ)
+	Description     string            `yaml:"description"`      // Початок опису правил GCP (за замовчуванням SETMaster)
 }
 
 // Завантаження конфігурації з конфігураційного файлу
@@ -64,6 +196,45 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err // Повернення помилки, якщо файл не вдалося прочитати
 	}
 	var cfg Config
-	err = yaml.Unmarshal(data, &cfg) // Розпарсинг YAML у структуру Config
-	return &cfg, err                 // Повернення конфігурації або помилки
+	if err := yaml.Unmarshal(data, &cfg); err != nil { // Розпарсинг YAML у структуру Config
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil { // Помилки, через які сценарії мовчки не спрацьовували б
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Рівні пріоритетів Falco, від найвищого до найнижчого
+var falcoPriorities = map[string]int{
+	"emergency":     7,
+	"alert":         6,
+	"critical":      5,
+	"error":         4,
+	"warning":       3,
+	"notice":        2,
+	"informational": 1,
+	"info":          1,
+	"debug":         0,
+}
+
+// Рівень пріоритету Falco без урахування регістру; false для невідомого значення
+func PriorityLevel(priority string) (int, bool) {
+	level, ok := falcoPriorities[strings.ToLower(priority)]
+	return level, ok
+}
+
+// Перевірка значень конфігурації
+func (c *Config) validate() error {
+	for name, scenario := range c.Scenarios {
+		if _, ok := PriorityLevel(scenario.Priority); scenario.Priority != "" && !ok {
+			return fmt.Errorf("сценарій %s: невідомий пріоритет %q (emergency, alert, critical, error, warning, notice, informational, debug)", name, scenario.Priority)
+		}
+	}
+	for name, alias := range c.Server.Aliases {
+		if _, ok := PriorityLevel(alias.Priority); alias.Priority != "" && !ok {
+			return fmt.Errorf("псевдонім %s: невідомий пріоритет %q", name, alias.Priority)
+		}
+	}
+	return nil
 }
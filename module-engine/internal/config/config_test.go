@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Запис конфігурації у тимчасовий файл
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "known priority",
+			config: `
+scenarios:
+  ssh:
+    rule: "Detect Failed SSH Login Attempts"
+    priority: "warning"
+`,
+		},
+		{
+			name: "priority is case insensitive",
+			config: `
+scenarios:
+  ssh:
+    rule: "Detect Failed SSH Login Attempts"
+    priority: "WARNING"
+`,
+		},
+		{
+			name: "no priority",
+			config: `
+scenarios:
+  ssh:
+    rule: "Detect Failed SSH Login Attempts"
+`,
+		},
+		{
+			name: "unknown scenario priority",
+			config: `
+scenarios:
+  ssh:
+    rule: "Detect Failed SSH Login Attempts"
+    priority: "warn"
+`,
+			wantErr: `сценарій ssh: невідомий пріоритет "warn"`,
+		},
+		{
+			name: "unknown alias priority",
+			config: `
+server:
+  aliases:
+    cilium:
+      path: "/monitoring"
+      source: hubble
+      priority: "high"
+`,
+			wantErr: `псевдонім cilium: невідомий пріоритет "high"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig() error = %v", err)
+				}
+				if cfg == nil {
+					t.Fatal("LoadConfig() returned nil config")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPriorityLevel(t *testing.T) {
+	if level, ok := PriorityLevel("Critical"); !ok || level != 5 {
+		t.Errorf("PriorityLevel(Critical) = %d, %v", level, ok)
+	}
+	if a, _ := PriorityLevel("informational"); a != 1 {
+		t.Errorf("PriorityLevel(informational) = %d", a)
+	}
+	if _, ok := PriorityLevel("warn"); ok {
+		t.Error("PriorityLevel(warn) should be unknown")
+	}
+}
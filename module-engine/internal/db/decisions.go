@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Схема таблиць decisions (рішення у сповіщеннях) та allowlist (список дозволених)
+const decisionsSchema = `
+        CREATE TABLE IF NOT EXISTS decisions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            incident_id TEXT NOT NULL DEFAULT '',
+            scenario TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            action TEXT NOT NULL,
+            user TEXT NOT NULL DEFAULT '',
+            time INTEGER NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS decisions_ip_time ON decisions (ip, time);
+        CREATE INDEX IF NOT EXISTS decisions_incident ON decisions (incident_id);
+        CREATE TABLE IF NOT EXISTS allowlist (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            value TEXT NOT NULL UNIQUE,
+            comment TEXT NOT NULL DEFAULT '',
+            added_by TEXT NOT NULL DEFAULT '',
+            time INTEGER NOT NULL
+        );
+    `
+
+// Створення таблиць decisions та allowlist, якщо вони ще не існують
+func createDecisions(db *sql.DB) error {
+	_, err := db.Exec(decisionsSchema)
+	return err
+}
+
+// Збереження рішення, прийнятого у сповіщенні
+func (d *SQLiteDB) RecordDecision(decision models.Decision) error {
+	_, err := d.db.Exec("INSERT INTO decisions (incident_id, scenario, ip, action, user, time) VALUES (?, ?, ?, ?, ?, ?)",
+		decision.IncidentID, decision.Scenario, decision.IP, decision.Action, decision.User, decision.Time)
+	return err
+}
+
+// Перше рішення, прийняте для інциденту; nil, якщо рішення ще немає
+func (d *SQLiteDB) GetDecisionByIncident(incidentID string) (*models.Decision, error) {
+	if incidentID == "" {
+		return nil, nil
+	}
+	var dec models.Decision
+	err := d.db.QueryRow("SELECT id, incident_id, scenario, ip, action, user, time FROM decisions WHERE incident_id = ? ORDER BY id LIMIT 1", incidentID).
+		Scan(&dec.ID, &dec.IncidentID, &dec.Scenario, &dec.IP, &dec.Action, &dec.User, &dec.Time)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dec, nil
+}
+
+// Вибірка рішень для IP (від найновіших)
+func (d *SQLiteDB) GetDecisionsByIP(ip string) ([]models.Decision, error) {
+	rows, err := d.db.Query("SELECT id, incident_id, scenario, ip, action, user, time FROM decisions WHERE ip = ? ORDER BY time DESC, id DESC", ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []models.Decision
+	for rows.Next() {
+		var dec models.Decision
+		if err := rows.Scan(&dec.ID, &dec.IncidentID, &dec.Scenario, &dec.IP, &dec.Action, &dec.User, &dec.Time); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, dec)
+	}
+	return decisions, rows.Err()
+}
+
+// Додавання до списку дозволених; для наявного запису оновлюються коментар та автор
+func (d *SQLiteDB) AddAllowlist(entry models.AllowlistEntry) error {
+	_, err := d.db.Exec(`INSERT INTO allowlist (value, comment, added_by, time) VALUES (?, ?, ?, ?)
+            ON CONFLICT (value) DO UPDATE SET comment = excluded.comment, added_by = excluded.added_by, time = excluded.time`,
+		entry.Value, entry.Comment, entry.AddedBy, entry.Time)
+	return err
+}
+
+// Вибірка записів списку дозволених (від найновіших)
+func (d *SQLiteDB) GetAllowlist() ([]models.AllowlistEntry, error) {
+	rows, err := d.db.Query("SELECT id, value, comment, added_by, time FROM allowlist ORDER BY time DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AllowlistEntry
+	for rows.Next() {
+		var e models.AllowlistEntry
+		if err := rows.Scan(&e.ID, &e.Value, &e.Comment, &e.AddedBy, &e.Time); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Видалення запису списку дозволених
+func (d *SQLiteDB) DeleteAllowlist(id int) error {
+	_, err := d.db.Exec("DELETE FROM allowlist WHERE id = ?", id)
+	return err
+}
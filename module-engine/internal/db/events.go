@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Схема таблиці events: кожна подія, що відповідає сценарію, для підрахунку в ковзному вікні
+const eventsSchema = `
+        CREATE TABLE IF NOT EXISTS events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            scenario TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            rule TEXT NOT NULL DEFAULT '',
+            time INTEGER NOT NULL,
+            priority TEXT NOT NULL DEFAULT '',
+            output TEXT NOT NULL DEFAULT '',
+            hostname TEXT NOT NULL DEFAULT '',
+            tags TEXT NOT NULL DEFAULT '',
+            raw TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS events_scenario_ip_time ON events (scenario, ip, time);
+        CREATE INDEX IF NOT EXISTS events_time ON events (time);
+    `
+
+// Колонки таблиці events, додані після першої версії схеми
+var addedEventColumns = [][2]string{
+	{"priority", "TEXT NOT NULL DEFAULT ''"},
+	{"output", "TEXT NOT NULL DEFAULT ''"},
+	{"hostname", "TEXT NOT NULL DEFAULT ''"},
+	{"tags", "TEXT NOT NULL DEFAULT ''"},
+	{"raw", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Створення таблиці events, якщо вона ще не існує
+func createEvents(db *sql.DB) error {
+	if _, err := db.Exec(eventsSchema); err != nil {
+		return err
+	}
+	for _, col := range addedEventColumns {
+		if err := ensureColumn(db, "events", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Збереження події та атомарне оновлення запису сценарію.
+// Функція fn отримує кількість подій у ковзному вікні [at-window, at], враховуючи лише події після
+// останнього скидання лічильника (ResetAt). Подія, запис та лічильник зберігаються в одній транзакції
+func (d *SQLiteDB) RecordEvent(scenario string, event models.Event, at, window int64, fn func(record *models.BlockRecord, recent int) error) (*models.BlockRecord, error) {
+	ip := event.IP
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Відкат, якщо транзакцію не було підтверджено
+
+	// Разом із подією зберігається її повний JSON для перегляду на дашборді
+	_, err = tx.Exec("INSERT INTO events (scenario, ip, rule, time, priority, output, hostname, tags, raw) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		scenario, ip, event.Rule, at, event.Priority, event.Output, event.Hostname, joinList(event.Tags), string(event.Raw))
+	if err != nil {
+		return nil, err
+	}
+	record, err := getOrCreateBlockRecord(tx, scenario, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	// Кількість подій у ковзному вікні після останнього скидання
+	var recent int
+	err = tx.QueryRow("SELECT COUNT(*) FROM events WHERE scenario = ? AND ip = ? AND time > ? AND time >= ?",
+		scenario, ip, at-window, record.ResetAt).Scan(&recent)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(record, recent); err != nil {
+		return nil, err
+	}
+	if err := updateBlockRecord(tx, record); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Видалення подій, старших за вказаний час; повертає кількість видалених рядків
+func (d *SQLiteDB) PruneEvents(before int64) (int64, error) {
+	res, err := d.db.Exec("DELETE FROM events WHERE time < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Вибірка всіх збережених подій для IP (від найновіших)
+func (d *SQLiteDB) GetEventsByIP(ip string) ([]models.EventRecord, error) {
+	rows, err := d.db.Query("SELECT id, scenario, ip, rule, priority, output, hostname, tags, time, raw FROM events WHERE ip = ? ORDER BY time DESC, id DESC", ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.EventRecord
+	for rows.Next() {
+		var e models.EventRecord
+		var tags string
+		if err := rows.Scan(&e.ID, &e.Scenario, &e.IP, &e.Rule, &e.Priority, &e.Output, &e.Hostname, &tags, &e.Time, &e.Raw); err != nil {
+			return nil, err
+		}
+		e.Tags = splitList(tags)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
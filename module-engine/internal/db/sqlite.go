@@ -2,61 +2,259 @@ package db
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Сценарій, до якого відносяться записи зі старої схеми (до появи колонки scenario)
+const legacyScenario = "block_ip"
+
+// Діяч заблокованих записів, створених до появи колонки actioners: тоді блокував лише gcp_firewall
+const legacyActioners = "gcp_firewall"
+
 type SQLiteDB struct {
 	db *sql.DB
 }
 
 // Ініціалізація бази
 func NewSQLiteDB(path string) (*SQLiteDB, error) {
-	// Відкриваємо з'єднання з базою даних SQLite за вказаним шляхом
-	db, err := sql.Open("sqlite3", path)
+	// Відкриваємо з'єднання з базою даних SQLite за вказаним шляхом.
+	// Транзакції одразу захоплюють блокування на запис, а конкурентні запити чекають на нього до 5 секунд
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, err
 	}
+	// SQLite допускає лише одного записувача, тому запити виконуються через одне з'єднання
+	db.SetMaxOpenConns(1)
+	// Переносимо дані зі старої схеми, якщо таблиця blocks ще не містить колонки scenario
+	if err := migrateBlocks(db); err != nil {
+		return nil, err
+	}
 	// Створення таблиці blocks, якщо вона ще не існує
-	_, err = db.Exec(`
+	if _, err = db.Exec(blocksSchema); err != nil {
+		return nil, err
+	}
+	// Додавання колонок, що з'явилися після створення таблиці
+	hadActioners, err := hasColumn(db, "blocks", "actioners")
+	if err != nil {
+		return nil, err
+	}
+	for _, col := range addedColumns {
+		if err := ensureColumn(db, "blocks", col[0], col[1]); err != nil {
+			return nil, err
+		}
+	}
+	// Без діяча в записі розблокування не скасувало б правило, створене старою версією
+	if !hadActioners {
+		if _, err := db.Exec("UPDATE blocks SET actioners = ? WHERE blocked_at > 0", legacyActioners); err != nil {
+			return nil, err
+		}
+	}
+	// Створення таблиці подій для ковзного вікна
+	if err := createEvents(db); err != nil {
+		return nil, err
+	}
+	// Створення таблиць рішень у сповіщеннях та списку дозволених
+	if err := createDecisions(db); err != nil {
+		return nil, err
+	}
+	// Повертаємо об'єкт SQLiteDB
+	return &SQLiteDB{db}, nil
+}
+
+// Колонки таблиці blocks, додані після першої версії схеми: назва та визначення
+var addedColumns = [][2]string{
+	{"actioners", "TEXT NOT NULL DEFAULT ''"},
+	{"notified_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"message_ts", "TEXT NOT NULL DEFAULT ''"},
+	{"reset_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"incident_id", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Колонки, що зчитуються в models.BlockRecord (порядок відповідає scanRecord)
+const recordColumns = "id, scenario, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken, actioners, notified_at, message_ts, reset_at, incident_id"
+
+// Інтерфейс, спільний для sql.DB та sql.Tx
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Інтерфейс, спільний для sql.Row та sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Зчитування рядка з колонками recordColumns у запис
+func scanRecord(row rowScanner, r *models.BlockRecord) error {
+	var actioners string
+	if err := row.Scan(&r.ID, &r.Scenario, &r.IP, &r.BlockedAt, &r.UnblockAfter, &r.BlockCount, &r.TriggerCount, &r.LastEventTime, &r.ActionTaken, &actioners, &r.NotifiedAt, &r.MessageTS, &r.ResetAt, &r.IncidentID); err != nil {
+		return err
+	}
+	r.Actioners = splitList(actioners)
+	return nil
+}
+
+// Схема таблиці blocks: стан зберігається окремо для кожної пари (сценарій, IP)
+const blocksSchema = `
         CREATE TABLE IF NOT EXISTS blocks (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
-            ip TEXT UNIQUE,
+            scenario TEXT NOT NULL DEFAULT '',
+            ip TEXT NOT NULL,
             blocked_at INTEGER,
             unblock_after INTEGER,
             block_count INTEGER,
             trigger_count INTEGER,
             last_event_time INTEGER DEFAULT 0,
-			action_taken BOOLEAN DEFAULT 0
+            action_taken BOOLEAN DEFAULT 0,
+            actioners TEXT NOT NULL DEFAULT '',
+            notified_at INTEGER NOT NULL DEFAULT 0,
+            message_ts TEXT NOT NULL DEFAULT '',
+            reset_at INTEGER NOT NULL DEFAULT 0,
+            incident_id TEXT NOT NULL DEFAULT '',
+            UNIQUE (scenario, ip)
         )
-    `)
-	// Повертаємо об'єкт SQLiteDB або помилку, якщо вона виникла
-	return &SQLiteDB{db}, err
+    `
+
+// Міграція таблиці blocks зі схеми з унікальним ip на схему з ключем (scenario, ip)
+func migrateBlocks(db *sql.DB) error {
+	exists, err := hasTable(db, "blocks")
+	if err != nil || !exists {
+		return err
+	}
+	migrated, err := hasColumn(db, "blocks", "scenario")
+	if err != nil || migrated {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Перейменовуємо стару таблицю, створюємо нову та копіюємо записи під сценарій за замовчуванням;
+	// заблоковані записи отримують діяча, що створив їхні правила
+	stmts := []string{
+		"ALTER TABLE blocks RENAME TO blocks_legacy",
+		blocksSchema,
+		`INSERT INTO blocks (id, scenario, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken, actioners)
+            SELECT id, '` + legacyScenario + `', ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken,
+                CASE WHEN blocked_at > 0 THEN '` + legacyActioners + `' ELSE '' END FROM blocks_legacy`,
+		"DROP TABLE blocks_legacy",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Додаємо колонку до таблиці, якщо її ще немає
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// Перетворення списку в рядок для зберігання в колонці
+func joinList(items []string) string {
+	return strings.Join(items, ",")
+}
+
+// Перетворення значення колонки назад у список
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Перевіряємо, чи існує таблиця з вказаною назвою
+func hasTable(db *sql.DB, table string) (bool, error) {
+	var name string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Перевіряємо, чи містить таблиця вказану колонку
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 // Створюємо запис в таблиці
-func (d *SQLiteDB) GetOrCreateBlockRecord(ip string) (*models.BlockRecord, error) {
+func (d *SQLiteDB) GetOrCreateBlockRecord(scenario, ip string) (*models.BlockRecord, error) {
+	return getOrCreateBlockRecord(d.db, scenario, ip)
+}
+
+// Атомарне оновлення запису: читання (або створення), зміна функцією fn та запис виконуються в одній транзакції.
+// Якщо fn повертає помилку, зміни не зберігаються
+func (d *SQLiteDB) UpdateRecord(scenario, ip string, fn func(record *models.BlockRecord) error) (*models.BlockRecord, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Відкат, якщо транзакцію не було підтверджено
+
+	record, err := getOrCreateBlockRecord(tx, scenario, ip)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(record); err != nil {
+		return nil, err
+	}
+	if err := updateBlockRecord(tx, record); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Отримання або створення запису в межах з'єднання чи транзакції
+func getOrCreateBlockRecord(q querier, scenario, ip string) (*models.BlockRecord, error) {
 	var record models.BlockRecord
-	// Отримуємо запис із таблиці за IP-адресою
-	err := d.db.QueryRow("SELECT id, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken FROM blocks WHERE ip = ?", ip).Scan(
-		&record.ID, &record.IP, &record.BlockedAt, &record.UnblockAfter, &record.BlockCount, &record.TriggerCount, &record.LastEventTime, &record.ActionTaken,
-	)
+	// Отримуємо запис із таблиці за сценарієм та IP-адресою
+	err := scanRecord(q.QueryRow("SELECT "+recordColumns+" FROM blocks WHERE scenario = ? AND ip = ?", scenario, ip), &record)
 	if err != nil && err != sql.ErrNoRows {
 		// Якщо сталася помилка, крім відсутності запису, повертаємо її
 		return nil, err
 	}
 	if err == sql.ErrNoRows {
 		// Якщо запису немає, створюємо новий із початковими значеннями
-		res, err := d.db.Exec("INSERT INTO blocks (ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken) VALUES (?, 0, 0, 0, 0, 0, 0)", ip)
+		res, err := q.Exec("INSERT INTO blocks (scenario, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken) VALUES (?, ?, 0, 0, 0, 0, 0, 0)", scenario, ip)
 		if err != nil {
 			return nil, err
 		}
 		// Отримуємо ID нового запису
 		id, _ := res.LastInsertId()
-		// Ініціалізуємо запис із ID та IP
-		record = models.BlockRecord{ID: int(id), IP: ip}
+		// Ініціалізуємо запис із ID, сценарієм та IP
+		record = models.BlockRecord{ID: int(id), Scenario: scenario, IP: ip}
 	}
 	// Повертаємо вказівник на запис та nil як помилку
 	return &record, nil
@@ -64,18 +262,23 @@ func (d *SQLiteDB) GetOrCreateBlockRecord(ip string) (*models.BlockRecord, error
 
 // Оновлюємо запис про блокування
 func (d *SQLiteDB) UpdateBlockRecord(record *models.BlockRecord) error {
-	// Оновлюємо всі поля запису в таблиці за IP-адресою
-	_, err := d.db.Exec("UPDATE blocks SET blocked_at = ?, unblock_after = ?, block_count = ?, trigger_count = ?, last_event_time = ?, action_taken = ? WHERE ip = ?",
-		record.BlockedAt, record.UnblockAfter, record.BlockCount, record.TriggerCount, record.LastEventTime, record.ActionTaken, record.IP)
+	return updateBlockRecord(d.db, record)
+}
+
+// Оновлення запису в межах з'єднання чи транзакції
+func updateBlockRecord(q querier, record *models.BlockRecord) error {
+	// Оновлюємо всі поля запису в таблиці за сценарієм та IP-адресою
+	_, err := q.Exec("UPDATE blocks SET blocked_at = ?, unblock_after = ?, block_count = ?, trigger_count = ?, last_event_time = ?, action_taken = ?, actioners = ?, notified_at = ?, message_ts = ?, reset_at = ?, incident_id = ? WHERE scenario = ? AND ip = ?",
+		record.BlockedAt, record.UnblockAfter, record.BlockCount, record.TriggerCount, record.LastEventTime, record.ActionTaken, joinList(record.Actioners), record.NotifiedAt, record.MessageTS, record.ResetAt, record.IncidentID, record.Scenario, record.IP)
 	// Повертаємо результат виконання (помилку або nil)
 	return err
 }
 
 // Перевіряємо чи вже було здійснено блокування
-func (d *SQLiteDB) WasActionTaken(ip string) bool {
+func (d *SQLiteDB) WasActionTaken(scenario, ip string) bool {
 	var actionTaken bool
-	// Отримуємо значення action_taken для вказаної IP-адреси
-	d.db.QueryRow("SELECT action_taken FROM blocks WHERE ip = ?", ip).Scan(&actionTaken)
+	// Отримуємо значення action_taken для вказаного сценарію та IP-адреси
+	d.db.QueryRow("SELECT action_taken FROM blocks WHERE scenario = ? AND ip = ?", scenario, ip).Scan(&actionTaken)
 	// Повертаємо булеве значення, чи було виконано дію
 	return actionTaken
 }
@@ -83,7 +286,45 @@ func (d *SQLiteDB) WasActionTaken(ip string) bool {
 // Вибірка всіх даних з бази
 func (d *SQLiteDB) GetAllRecords() ([]models.BlockRecord, error) {
 	// Виконуємо запит для отримання всіх записів із таблиці
-	rows, err := d.db.Query("SELECT id, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time FROM blocks")
+	return d.queryRecords("SELECT " + recordColumns + " FROM blocks ORDER BY ip, scenario")
+}
+
+// Вибірка записів усіх сценаріїв для IP
+func (d *SQLiteDB) GetRecordsByIP(ip string) ([]models.BlockRecord, error) {
+	return d.queryRecords("SELECT "+recordColumns+" FROM blocks WHERE ip = ? ORDER BY scenario", ip)
+}
+
+// Вибірка заблокованих записів сценарію, блокування яких почалося не раніше since
+func (d *SQLiteDB) GetBlockedRecords(scenario string, since int64) ([]models.BlockRecord, error) {
+	return d.queryRecords("SELECT "+recordColumns+" FROM blocks WHERE scenario = ? AND blocked_at > 0 AND blocked_at >= ? ORDER BY blocked_at", scenario, since)
+}
+
+// Вибірка всіх заблокованих записів усіх сценаріїв
+func (d *SQLiteDB) GetActiveBlocks() ([]models.BlockRecord, error) {
+	return d.queryRecords("SELECT " + recordColumns + " FROM blocks WHERE blocked_at > 0")
+}
+
+// Пошук запису за ідентифікатором інциденту; nil, якщо інцидент не знайдено
+func (d *SQLiteDB) GetRecordByIncident(incidentID string) (*models.BlockRecord, error) {
+	if incidentID == "" {
+		return nil, nil
+	}
+	records, err := d.queryRecords("SELECT "+recordColumns+" FROM blocks WHERE incident_id = ?", incidentID)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+// Вибірка записів, для яких після перезапуску потрібно відновити таймери:
+// заблоковані IP та сповіщення, на які ще не обрано дію
+func (d *SQLiteDB) GetPendingRecords() ([]models.BlockRecord, error) {
+	return d.queryRecords("SELECT " + recordColumns + " FROM blocks WHERE blocked_at > 0 OR (notified_at > 0 AND action_taken = 0)")
+}
+
+// Виконання запиту, що повертає колонки recordColumns
+func (d *SQLiteDB) queryRecords(query string, args ...any) ([]models.BlockRecord, error) {
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -95,12 +336,12 @@ func (d *SQLiteDB) GetAllRecords() ([]models.BlockRecord, error) {
 	for rows.Next() {
 		var r models.BlockRecord
 		// Зчитуємо дані з кожного рядка в структуру BlockRecord
-		if err := rows.Scan(&r.ID, &r.IP, &r.BlockedAt, &r.UnblockAfter, &r.BlockCount, &r.TriggerCount, &r.LastEventTime); err != nil {
+		if err := scanRecord(rows, &r); err != nil {
 			return nil, err
 		}
 		// Додаємо запис до слайсу
 		records = append(records, r)
 	}
 	// Повертаємо слайс із усіма записами та nil як помилку
-	return records, nil
+	return records, rows.Err()
 }
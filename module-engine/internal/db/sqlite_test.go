@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Схема таблиці blocks першої версії (унікальний ip, без сценарію та діячів)
+const baselineSchema = `
+        CREATE TABLE blocks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            ip TEXT UNIQUE,
+            blocked_at INTEGER,
+            unblock_after INTEGER,
+            block_count INTEGER,
+            trigger_count INTEGER,
+            last_event_time INTEGER DEFAULT 0,
+			action_taken BOOLEAN DEFAULT 0
+        )
+    `
+
+// Схема після появи колонки scenario, але до колонки actioners
+const scenarioSchema = `
+        CREATE TABLE blocks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            scenario TEXT NOT NULL DEFAULT '',
+            ip TEXT NOT NULL,
+            blocked_at INTEGER,
+            unblock_after INTEGER,
+            block_count INTEGER,
+            trigger_count INTEGER,
+            last_event_time INTEGER DEFAULT 0,
+            action_taken BOOLEAN DEFAULT 0,
+            UNIQUE (scenario, ip)
+        )
+    `
+
+// Створення бази зі старою схемою та записами
+func legacyDB(t *testing.T, schema string, stmts ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	for _, stmt := range append([]string{schema}, stmts...) {
+		if _, err := raw.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return path
+}
+
+func TestMigrateBaselineSchema(t *testing.T) {
+	path := legacyDB(t, baselineSchema,
+		`INSERT INTO blocks (ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken)
+            VALUES ('203.0.113.7', 1700000000, 1700000600, 2, 5, 1700000000, 1)`,
+		`INSERT INTO blocks (ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken)
+            VALUES ('198.51.100.1', 0, 0, 0, 1, 1700000000, 0)`,
+	)
+
+	d, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	records, err := d.GetAllRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	for _, r := range records {
+		if r.Scenario != legacyScenario {
+			t.Errorf("%s: scenario = %q, want %q", r.IP, r.Scenario, legacyScenario)
+		}
+	}
+
+	blocked, err := d.GetOrCreateBlockRecord(legacyScenario, "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blocked.Actioners, []string{legacyActioners}) {
+		t.Errorf("blocked record actioners = %v, want [%s]", blocked.Actioners, legacyActioners)
+	}
+	if blocked.BlockedAt != 1700000000 || blocked.UnblockAfter != 1700000600 || blocked.BlockCount != 2 || !blocked.ActionTaken {
+		t.Errorf("blocked record not copied: %+v", blocked)
+	}
+
+	idle, err := d.GetOrCreateBlockRecord(legacyScenario, "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idle.Actioners) != 0 {
+		t.Errorf("unblocked record actioners = %v, want none", idle.Actioners)
+	}
+
+	// Заблокований запис має потрапити до відновлення таймерів після перезапуску
+	pending, err := d.GetPendingRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].IP != "203.0.113.7" {
+		t.Errorf("pending records = %+v, want only 203.0.113.7", pending)
+	}
+}
+
+func TestMigrateScenarioSchemaBackfillsActioners(t *testing.T) {
+	path := legacyDB(t, scenarioSchema,
+		`INSERT INTO blocks (scenario, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken)
+            VALUES ('ssh', '203.0.113.7', 1700000000, 1700000600, 1, 3, 1700000000, 1)`,
+		`INSERT INTO blocks (scenario, ip, blocked_at, unblock_after, block_count, trigger_count, last_event_time, action_taken)
+            VALUES ('ssh', '198.51.100.1', 0, 0, 0, 1, 1700000000, 0)`,
+	)
+
+	d, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteDB: %v", err)
+	}
+	blocked, err := d.GetOrCreateBlockRecord("ssh", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blocked.Actioners, []string{legacyActioners}) {
+		t.Errorf("blocked record actioners = %v, want [%s]", blocked.Actioners, legacyActioners)
+	}
+	idle, err := d.GetOrCreateBlockRecord("ssh", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idle.Actioners) != 0 {
+		t.Errorf("unblocked record actioners = %v, want none", idle.Actioners)
+	}
+}
+
+func TestReopenKeepsActioners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	d, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Запис, заблокований поточною версією лише локальним брандмауером
+	if _, err := d.UpdateRecord("ssh", "203.0.113.7", func(r *models.BlockRecord) error {
+		r.BlockedAt = 1700000000
+		r.Actioners = []string{"local_firewall"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d.db.Close()
+
+	// Повторне відкриття не повинно перезаписувати діячів
+	d, err = NewSQLiteDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.GetOrCreateBlockRecord("ssh", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Actioners, []string{"local_firewall"}) {
+		t.Errorf("actioners = %v, want [local_firewall]", r.Actioners)
+	}
+}
@@ -0,0 +1,86 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Шлях сторінки підтвердження дії за підписаним посиланням
+const ApprovalPath = "/approve"
+
+// Час дії посилання за замовчуванням
+const defaultApprovalTTL = 60 * time.Minute
+
+// Підписані посилання для вибору дії у сповіщеннях без власних зворотних викликів
+// (Teams, електронна пошта, вебхук). Посилання містить сценарій, IP, інцидент, дію та
+// час завершення дії, підписані HMAC-SHA256
+type ApprovalLinks struct {
+	baseURL string        // Зовнішня адреса сервера
+	secret  []byte        // Секрет підпису
+	ttl     time.Duration // Час дії посилання
+}
+
+// Створення підписувача посилань; nil, якщо посилання не налаштовано
+func NewApprovalLinks(cfg config.ApprovalConfig) *ApprovalLinks {
+	if cfg.BaseURL == "" || cfg.Secret == "" {
+		return nil
+	}
+	ttl := time.Duration(cfg.TTL) * time.Minute
+	if ttl <= 0 {
+		ttl = defaultApprovalTTL
+	}
+	return &ApprovalLinks{baseURL: strings.TrimRight(cfg.BaseURL, "/"), secret: []byte(cfg.Secret), ttl: ttl}
+}
+
+// Підписане посилання для дії; порожнє, якщо посилання не налаштовано
+func (a *ApprovalLinks) URL(v ActionValue, now time.Time) string {
+	if a == nil {
+		return ""
+	}
+	q := url.Values{}
+	q.Set("scenario", v.Scenario)
+	q.Set("ip", v.IP)
+	q.Set("incident", v.IncidentID)
+	q.Set("action", v.Action)
+	q.Set("exp", strconv.FormatInt(now.Add(a.ttl).Unix(), 10))
+	q.Set("sig", hex.EncodeToString(a.sign(q)))
+	return a.baseURL + ApprovalPath + "?" + q.Encode()
+}
+
+// Перевірка підпису та терміну дії посилання
+func (a *ApprovalLinks) Verify(q url.Values, now time.Time) (ActionValue, error) {
+	v := ActionValue{Scenario: q.Get("scenario"), IP: q.Get("ip"), IncidentID: q.Get("incident"), Action: q.Get("action")}
+	if a == nil {
+		return v, errors.New("підписані посилання не налаштовано")
+	}
+	sig, err := hex.DecodeString(q.Get("sig"))
+	if err != nil || !hmac.Equal(sig, a.sign(q)) {
+		return v, errors.New("невірний підпис посилання")
+	}
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || now.Unix() > exp {
+		return v, errors.New("термін дії посилання минув")
+	}
+	if v.Scenario == "" || v.IP == "" || v.Action == "" {
+		return v, errors.New("неповне посилання")
+	}
+	return v, nil
+}
+
+// Підпис полів посилання
+func (a *ApprovalLinks) sign(q url.Values) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	for _, key := range []string{"scenario", "ip", "incident", "action", "exp"} {
+		mac.Write([]byte(q.Get(key)))
+		mac.Write([]byte{0}) // Роздільник, щоб межі полів не можна було зсунути
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Параметри підписаного посилання
+func approvalQuery(t *testing.T, a *ApprovalLinks, v ActionValue, now time.Time) url.Values {
+	t.Helper()
+	link := a.URL(v, now)
+	if !strings.HasPrefix(link, "https://setmaster.example.com"+ApprovalPath+"?") {
+		t.Fatalf("URL() = %s", link)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+func TestApprovalLinks(t *testing.T) {
+	a := NewApprovalLinks(config.ApprovalConfig{BaseURL: "https://setmaster.example.com/", Secret: "s3cret", TTL: 30})
+	issued := time.Unix(1700000000, 0)
+	value := ActionValue{Scenario: "ssh", IP: "203.0.113.7", IncidentID: "a1b2c3d4", Action: "all"}
+
+	tests := []struct {
+		name    string
+		change  func(q url.Values)
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", now: issued.Add(29 * time.Minute)},
+		{name: "valid until expiry", now: issued.Add(30 * time.Minute)},
+		{name: "expired", now: issued.Add(31 * time.Minute), wantErr: "термін дії"},
+		{name: "extended expiry", now: issued.Add(2 * time.Hour), change: func(q url.Values) {
+			q.Set("exp", "1800000000")
+		}, wantErr: "підпис"},
+		{name: "wrong incident", now: issued, change: func(q url.Values) { q.Set("incident", "e5f6a7b8") }, wantErr: "підпис"},
+		{name: "other ip", now: issued, change: func(q url.Values) { q.Set("ip", "198.51.100.1") }, wantErr: "підпис"},
+		{name: "other scenario", now: issued, change: func(q url.Values) { q.Set("scenario", "web") }, wantErr: "підпис"},
+		{name: "other action", now: issued, change: func(q url.Values) { q.Set("action", "allowlist") }, wantErr: "підпис"},
+		{name: "shifted field boundary", now: issued, change: func(q url.Values) {
+			q.Set("scenario", "ssh203.0.113.7")
+			q.Set("ip", "")
+		}, wantErr: "підпис"},
+		{name: "missing signature", now: issued, change: func(q url.Values) { q.Del("sig") }, wantErr: "підпис"},
+		{name: "malformed signature", now: issued, change: func(q url.Values) { q.Set("sig", "zz") }, wantErr: "підпис"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := approvalQuery(t, a, value, issued)
+			if tt.change != nil {
+				tt.change(q)
+			}
+			got, err := a.Verify(q, tt.now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if got != value {
+					t.Errorf("Verify() = %+v, want %+v", got, value)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApprovalLinksOtherSecret(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	a := NewApprovalLinks(config.ApprovalConfig{BaseURL: "https://setmaster.example.com", Secret: "s3cret"})
+	other := NewApprovalLinks(config.ApprovalConfig{BaseURL: "https://setmaster.example.com", Secret: "other"})
+	q := approvalQuery(t, other, ActionValue{Scenario: "ssh", IP: "203.0.113.7", IncidentID: "a1b2c3d4", Action: "all"}, issued)
+	if _, err := a.Verify(q, issued); err == nil {
+		t.Error("link signed with another secret accepted")
+	}
+	// Термін дії за замовчуванням - година
+	q = approvalQuery(t, a, ActionValue{Scenario: "ssh", IP: "203.0.113.7", Action: "all"}, issued)
+	if _, err := a.Verify(q, issued.Add(59*time.Minute)); err != nil {
+		t.Errorf("default TTL: %v", err)
+	}
+	if _, err := a.Verify(q, issued.Add(61*time.Minute)); err == nil {
+		t.Error("default TTL: expired link accepted")
+	}
+}
+
+func TestApprovalLinksNotConfigured(t *testing.T) {
+	a := NewApprovalLinks(config.ApprovalConfig{BaseURL: "https://setmaster.example.com"})
+	if a != nil {
+		t.Fatal("links without secret must be disabled")
+	}
+	if link := a.URL(ActionValue{Scenario: "ssh", IP: "203.0.113.7", Action: "all"}, time.Now()); link != "" {
+		t.Errorf("URL() = %q, want empty", link)
+	}
+	if _, err := a.Verify(url.Values{"scenario": {"ssh"}}, time.Now()); err == nil {
+		t.Error("Verify() accepted a link without configured secret")
+	}
+}
@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Порт SMTP за замовчуванням (submission зі STARTTLS)
+const defaultSMTPPort = 587
+
+// Функція надсилання листа (smtp.SendMail); замінюється для перевірки без SMTP-сервера
+type SendMailFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// Сповіщення електронною поштою. Варіанти дій передаються підписаними посиланнями,
+// оновлення надсилаються відповіддю в тому ж ланцюжку листів
+type EmailNotifier struct {
+	cfg      config.EmailConfig // Налаштування SMTP
+	links    *ApprovalLinks     // Підписані посилання для дій
+	sendMail SendMailFunc       // Надсилання листа
+}
+
+// Новий екземпляр EmailNotifier
+func NewEmailNotifier(cfg config.EmailConfig, links *ApprovalLinks) *EmailNotifier {
+	return NewEmailNotifierWithSender(cfg, links, smtp.SendMail)
+}
+
+// Новий екземпляр EmailNotifier з власною функцією надсилання
+func NewEmailNotifierWithSender(cfg config.EmailConfig, links *ApprovalLinks, send SendMailFunc) *EmailNotifier {
+	if cfg.Port == 0 {
+		cfg.Port = defaultSMTPPort
+	}
+	return &EmailNotifier{cfg: cfg, links: links, sendMail: send}
+}
+
+// Надсилання листа з посиланнями на дії; повертає Message-ID листа
+func (e *EmailNotifier) Send(msg Message) (string, error) {
+	var body strings.Builder
+	body.WriteString(msg.Text + "\r\n")
+	now := time.Now()
+	var links []string
+	for _, button := range msg.Buttons {
+		if link := e.links.URL(msg.Value(button.Action), now); link != "" {
+			links = append(links, fmt.Sprintf("  %s: %s", button.Label, link))
+		}
+	}
+	if len(links) > 0 {
+		body.WriteString("\r\nОберіть дію:\r\n" + strings.Join(links, "\r\n") + "\r\n")
+	}
+
+	messageID := fmt.Sprintf("<%s.%d@setmaster>", msg.IncidentID, now.UnixNano())
+	subject := fmt.Sprintf("SETMaster: сценарій %s для IP %s", msg.Scenario, msg.IP)
+	if err := e.send(subject, messageID, "", body.String()); err != nil {
+		return "", err
+	}
+	log.Printf("Лист про інцидент %s успішно надіслано", msg.IncidentID)
+	return messageID, nil
+}
+
+// Оновлення: лист-відповідь у ланцюжку початкового повідомлення
+func (e *EmailNotifier) Update(ref, text string) error {
+	messageID := fmt.Sprintf("<update.%d@setmaster>", time.Now().UnixNano())
+	return e.send("Re: SETMaster", messageID, ref, text+"\r\n")
+}
+
+// Формування та надсилання листа
+func (e *EmailNotifier) send(subject, messageID, inReplyTo, body string) error {
+	if e.cfg.Host == "" || e.cfg.From == "" || len(e.cfg.To) == 0 {
+		return errors.New("notifier.email: потрібно вказати host, from та to")
+	}
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", e.cfg.From},
+		{"To", strings.Join(e.cfg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	if inReplyTo != "" {
+		headers = append(headers, [2]string{"In-Reply-To", inReplyTo}, [2]string{"References", inReplyTo})
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n" + body)
+
+	// smtp.SendMail використовує STARTTLS, якщо сервер його підтримує
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+	}
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	return e.sendMail(addr, auth, e.cfg.From, e.cfg.To, msg.Bytes())
+}
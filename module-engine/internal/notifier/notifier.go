@@ -0,0 +1,105 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Інтерфейс системи сповіщень. Кожна реалізація надсилає повідомлення з варіантами дій
+// (кнопки Slack, inline-клавіатура Telegram, підписані посилання для Teams, пошти та вебхука)
+// та оновлює його, коли дію обрано або виконано автоматично
+type Notifier interface {
+	// Надсилання сповіщення; повертає ідентифікатор повідомлення для подальшого оновлення
+	Send(msg Message) (string, error)
+	// Оновлення надісланого повідомлення (або надсилання продовження, якщо редагування неможливе)
+	Update(ref, text string) error
+}
+
+// Нотифікатор, що може публікувати подальші події інциденту відповідями в гілці
+// початкового повідомлення (результати діячів, розблокування, повторні блокування)
+type Replier interface {
+	Reply(ref, text string) error
+}
+
+// Варіант дії у сповіщенні
+type Button struct {
+	Label  string // Текст кнопки
+	Action string // Назва діяча або all
+	Style  string // Стиль кнопки: primary, danger або порожній
+}
+
+// Сповіщення про спрацювання сценарію
+type Message struct {
+	Scenario   string   // Сценарій, що спрацював
+	IP         string   // Суб'єкт сценарію
+	IncidentID string   // Інцидент, для якого обирається дія
+	Text       string   // Текст повідомлення
+	Buttons    []Button // Варіанти дій
+}
+
+// Вміст кнопки для обраної дії
+func (m Message) Value(action string) ActionValue {
+	return ActionValue{Scenario: m.Scenario, IP: m.IP, IncidentID: m.IncidentID, Action: action}
+}
+
+// Вміст кнопки дії: сценарій, IP, інцидент та обрана дія
+type ActionValue struct {
+	Scenario   string `json:"scenario"` // Сценарій, що спрацював
+	IP         string `json:"ip"`       // Суб'єкт сценарію
+	IncidentID string `json:"incident"` // Інцидент, для якого надіслано повідомлення
+	Action     string `json:"action"`   // Назва діяча або all
+}
+
+// Кодування вмісту кнопки у JSON
+func (v ActionValue) Encode() string {
+	data, _ := json.Marshal(v) // Структура з рядками завжди кодується без помилок
+	return string(data)
+}
+
+// Розбір вмісту кнопки, закодованого ActionValue.Encode
+func ParseActionValue(value string) (ActionValue, error) {
+	var v ActionValue
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return v, fmt.Errorf("невірний вміст кнопки: %w", err)
+	}
+	if v.Scenario == "" || v.IP == "" || v.Action == "" {
+		return v, fmt.Errorf("неповний вміст кнопки: %s", value)
+	}
+	return v, nil
+}
+
+// HTTP-клієнт для сповіщень за замовчуванням
+var defaultClient = &http.Client{Timeout: 15 * time.Second}
+
+// Надсилання JSON методом POST; відповідь зі статусом поза 2xx вважається помилкою
+func postJSON(client *http.Client, url string, headers map[string]string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, fmt.Errorf("статус відповіді %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
@@ -3,11 +3,29 @@ package notifier
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 )
 
+// Префікс callback_id кнопок у повідомленнях з legacy attachments
+const actionCallbackPrefix = "scenario_action"
+
+// Розбір callback_id повідомлень з legacy attachments ("scenario_action|сценарій|IP"),
+// надісланих до переходу на Block Kit
+func ParseActionCallbackID(callbackID string) (scenario, ip string, ok bool) {
+	parts := strings.SplitN(callbackID, "|", 3)
+	if len(parts) != 3 || parts[0] != actionCallbackPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// Ідентифікатор блоку з кнопками дій сценарію
+const ActionsBlockID = "scenario_actions"
+
 // Структуру для надсилання повідомлень у Slack
 type SlackNotifier struct {
 	WebhookURL  string // URL вебхука для надсилання повідомлень
@@ -16,25 +34,32 @@ type SlackNotifier struct {
 	Channel     string // Канал Slack, куди надсилатимуться повідомлення
 }
 
-// Структура для опису кнопки
-type SlackButton struct {
-	Name  string `json:"name"`  // Назва кнопки
-	Value string `json:"value"` // Значення, яке повертається при натисканні
+// Текстовий об'єкт Block Kit
+type slackText struct {
+	Type string `json:"type"` // plain_text або mrkdwn
+	Text string `json:"text"`
+}
+
+// Елемент блоку actions (кнопка)
+type slackElement struct {
+	Type     string     `json:"type"`            // Тип елемента (button)
+	Text     *slackText `json:"text"`            // Текст на кнопці
+	ActionID string     `json:"action_id"`       // Ідентифікатор дії, унікальний у блоці
+	Value    string     `json:"value"`           // Значення, що повертається при натисканні
+	Style    string     `json:"style,omitempty"` // Стиль кнопки
 }
 
-// Структура для опису дії
-type SlackAction struct {
-	Name  string `json:"name"`  // Унікальне ім'я дії
-	Text  string `json:"text"`  // Текст, що відображається на кнопці
-	Type  string `json:"type"`  // Тип дії (наприклад, "button")
-	Value string `json:"value"` // Значення, асоційоване з дією
+// Блок повідомлення Block Kit
+type slackBlock struct {
+	Type     string         `json:"type"`               // section або actions
+	BlockID  string         `json:"block_id,omitempty"` // Ідентифікатор блоку
+	Text     *slackText     `json:"text,omitempty"`     // Текст секції
+	Elements []slackElement `json:"elements,omitempty"` // Кнопки блоку actions
 }
 
-// Структура для опису вкладень повідомлення
-type SlackAttachment struct {
-	Text       string        `json:"text"`        // Текст вкладення
-	CallbackID string        `json:"callback_id"` // Ідентифікатор для обробки callback
-	Actions    []SlackAction `json:"actions"`     // Список дій (кнопок)
+// Блок з текстом у форматі mrkdwn
+func textBlock(text string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}}
 }
 
 // Новий екземпляр SlackNotifier
@@ -47,134 +72,134 @@ func NewSlackNotifier(webhookURL, callbackURL, botToken, channel string) *SlackN
 	}
 }
 
-// Надсилання повідомлення з кнопками в Slack
-func (s *SlackNotifier) SendMessageWithButtons(text string, buttons []SlackButton) (string, error) {
-	log.Printf("Sending Slack message with %d buttons: %+v", len(buttons), buttons)
-	// Перетворюємо кнопки у формат SlackAction
-	var slackActions []SlackAction
-	for _, button := range buttons {
-		slackActions = append(slackActions, SlackAction{
-			Name:  button.Name,
-			Text:  button.Name,
-			Type:  "button",
-			Value: button.Value,
+// Надсилання повідомлення з кнопками в Slack (Block Kit).
+// Кожна кнопка містить у value сценарій, IP, інцидент та дію у форматі JSON
+func (s *SlackNotifier) Send(msg Message) (string, error) {
+	log.Printf("Sending Slack message with %d buttons: %+v", len(msg.Buttons), msg.Buttons)
+	text := msg.Text
+	// Перетворюємо кнопки в елементи блоку actions
+	var elements []slackElement
+	for i, button := range msg.Buttons {
+		elements = append(elements, slackElement{
+			Type:     "button",
+			Text:     &slackText{Type: "plain_text", Text: button.Label},
+			ActionID: fmt.Sprintf("action_%d", i), // Значення кнопки може повторюватися, номер - ні
+			Value:    msg.Value(button.Action).Encode(),
+			Style:    button.Style,
 		})
 	}
-	// Створюємо структуру даних для відправки в Slack
+	// Створюємо структуру даних для відправки в Slack; text використовується у сповіщеннях клієнтів
 	payload := struct {
-		Channel     string            `json:"channel"`     // Канал для надсилання
-		Text        string            `json:"text"`        // Основний текст повідомлення
-		Attachments []SlackAttachment `json:"attachments"` // Вкладення з кнопками
+		Channel string       `json:"channel"` // Канал для надсилання
+		Text    string       `json:"text"`    // Текст для сповіщень та клієнтів без Block Kit
+		Blocks  []slackBlock `json:"blocks"`  // Текст та кнопки повідомлення
 	}{
 		Channel: s.Channel,
 		Text:    text,
-		Attachments: []SlackAttachment{
-			{
-				Text:       "Оберіть дію:",    // Текст перед кнопками
-				CallbackID: "block_ip_action", // Ідентифікатор callback
-				Actions:    slackActions,      // Список кнопок
-			},
+		Blocks: []slackBlock{
+			textBlock(text),
+			{Type: "actions", BlockID: ActionsBlockID, Elements: elements},
 		},
 	}
-	// Перетворюємо дані в JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Помилка при обробці повідомлення Slack: %v", err)
-		return "", err
-	}
-	log.Printf("Дані для Slack: %s", string(jsonData))
-	// Створюємо HTTP-запит до API Slack
-	req, err := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Помилка при створенні запиту до Slack: %v", err)
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8") // Встановлюємо тип вмісту
-	req.Header.Set("Authorization", "Bearer "+s.BotToken)             // Додаємо токен авторизації
-	// Виконуємо запит
-	client := &http.Client{}
-	resp, err := client.Do(req)
+
+	result, err := s.callAPI("chat.postMessage", payload)
 	if err != nil {
 		log.Printf("Помилка при надсиланні повідомлення до Slack: %v", err)
 		return "", err
 	}
-	defer resp.Body.Close() // Закриваємо тіло відповіді після завершення
-	// Оброблюємо відповідь від Slack
-	var result struct {
-		Ok    bool   `json:"ok"`    // Успішність операції
-		Ts    string `json:"ts"`    // Часова мітка повідомлення
-		Error string `json:"error"` // Повідомлення про помилку, якщо є
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Printf("Помилка при декодуванні відповіді Slack: %v", err)
-		return "", err
-	}
-
-	log.Printf("Відповідь Slack: ok=%v, ts=%s, error=%s", result.Ok, result.Ts, result.Error)
-	if !result.Ok {
-		log.Printf("Помилка API Slack: %s", result.Error)
-		return "", fmt.Errorf("помилка API Slack: %s", result.Error)
-	}
-
 	log.Printf("Повідомлення Slack успішно надіслано з ts: %s", result.Ts)
 	return result.Ts, nil // Повертаємо часову мітку повідомлення
 }
 
-// Оновлення існуючого повідомлення в Slack
-func (s *SlackNotifier) UpdateMessage(ts, newText string) error {
+// Оновлення існуючого повідомлення в Slack: кнопки замінюються новим текстом
+func (s *SlackNotifier) Update(ts, newText string) error {
 	// Структура даних для оновлення повідомлення
 	payload := struct {
-		Channel     string            `json:"channel"`     // Канал, де знаходиться повідомлення
-		Ts          string            `json:"ts"`          // Часова мітка повідомлення
-		Text        string            `json Uran:"text"`   // Новий текст повідомлення
-		Attachments []SlackAttachment `json:"attachments"` // Вказуємо порожній список вкладень
+		Channel     string        `json:"channel"`     // Канал, де знаходиться повідомлення
+		Ts          string        `json:"ts"`          // Часова мітка повідомлення
+		Text        string        `json:"text"`        // Новий текст повідомлення
+		Blocks      []slackBlock  `json:"blocks"`      // Блоки без кнопок
+		Attachments []interface{} `json:"attachments"` // Порожній список прибирає кнопки legacy-повідомлень
 	}{
 		Channel:     s.Channel,
 		Ts:          ts,
 		Text:        newText,
-		Attachments: []SlackAttachment{}, // Очищаємо вкладення
+		Blocks:      []slackBlock{textBlock(newText)},
+		Attachments: []interface{}{},
 	}
 
+	if ts == "" {
+		return errors.New("повідомлення Slack не було надіслано")
+	}
+	if _, err := s.callAPI("chat.update", payload); err != nil {
+		log.Printf("Помилка при оновленні повідомлення Slack: %v", err)
+		return err
+	}
+	log.Printf("Повідомлення Slack успішно оновлено для ts: %s", ts)
+	return nil // Повертаємо nil у разі успіху
+}
+
+// Відповідь у гілці повідомлення ts: подія інциденту залишається в хронології під сповіщенням
+func (s *SlackNotifier) Reply(ts, text string) error {
+	if ts == "" {
+		return errors.New("повідомлення Slack не було надіслано")
+	}
+	payload := struct {
+		Channel  string `json:"channel"`   // Канал початкового повідомлення
+		ThreadTs string `json:"thread_ts"` // Часова мітка початкового повідомлення
+		Text     string `json:"text"`      // Текст відповіді
+	}{
+		Channel:  s.Channel,
+		ThreadTs: ts,
+		Text:     text,
+	}
+	if _, err := s.callAPI("chat.postMessage", payload); err != nil {
+		log.Printf("Помилка при надсиланні відповіді Slack: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Відповідь методу Slack Web API
+type slackAPIResult struct {
+	Ok    bool   `json:"ok"`    // Успішність операції
+	Ts    string `json:"ts"`    // Часова мітка повідомлення
+	Error string `json:"error"` // Повідомлення про помилку, якщо є
+}
+
+// Виклик методу Slack Web API з JSON-тілом
+func (s *SlackNotifier) callAPI(method string, payload interface{}) (*slackAPIResult, error) {
+	// Перетворюємо дані в JSON
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Помилка при виконанні оновлення Slack: %v", err)
-		return fmt.Errorf("помилка при виконанні оновлення Slack: %v", err)
+		return nil, fmt.Errorf("помилка при обробці запиту Slack: %v", err)
 	}
-	log.Printf("Дані для оновлення Slack: %s", string(jsonData))
+	log.Printf("Дані для Slack (%s): %s", method, string(jsonData))
 
-	// Створюємо запит для оновлення повідомлення
-	req, err := http.NewRequest("POST", "https://slack.com/api/chat.update", bytes.NewBuffer(jsonData))
+	// Створюємо HTTP-запит до API Slack
+	req, err := http.NewRequest("POST", "https://slack.com/api/"+method, bytes.NewBuffer(jsonData))
 	if err != nil {
-		log.Printf("Помилка при створенні запиту на оновлення Slack: %v", err)
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json; charset=utf-8") // Встановлюємо тип вмісту
 	req.Header.Set("Authorization", "Bearer "+s.BotToken)             // Додаємо токен авторизації
 
+	// Виконуємо запит
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Помилка при оновленні повідомлення Slack: %v", err)
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close() // Закриваємо тіло відповіді
+	defer resp.Body.Close() // Закриваємо тіло відповіді після завершення
 
-	// Оброблюємо відповідь на оновлення
-	var result struct {
-		Ok    bool   `json:"ok"`    // Успішність операції
-		Error string `json:"error"` // Повідомлення про помилку, якщо є
-	}
+	// Оброблюємо відповідь від Slack
+	var result slackAPIResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Printf("Помилка при декодуванні відповіді на оновлення Slack: %v", err)
-		return err
+		return nil, fmt.Errorf("помилка при декодуванні відповіді Slack: %v", err)
 	}
-
-	log.Printf("Відповідь на оновлення Slack: ok=%v, error=%s", result.Ok, result.Error)
+	log.Printf("Відповідь Slack (%s): ok=%v, ts=%s, error=%s", method, result.Ok, result.Ts, result.Error)
 	if !result.Ok {
-		log.Printf("Помилка оновлення API Slack: %s", result.Error)
-		return fmt.Errorf("помилка оновлення API Slack: %s", result.Error)
+		return nil, fmt.Errorf("помилка API Slack: %s", result.Error)
 	}
-
-	log.Printf("Повідомлення Slack успішно оновлено для ts: %s", ts)
-	return nil // Повертаємо nil у разі успіху
+	return &result, nil
 }
@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки підпису запитів Slack
+const (
+	slackSignatureHeader = "X-Slack-Signature"
+	slackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// Версія схеми підпису Slack
+const slackSignatureVersion = "v0"
+
+// Максимальна різниця між часом запиту та поточним часом (захист від повторного надсилання)
+const slackReplayWindow = 5 * time.Minute
+
+// Перевірка підпису запиту від Slack (https://api.slack.com/authentication/verifying-requests-from-slack).
+// Підписується рядок v0:<timestamp>:<тіло запиту> секретом підпису застосунку
+func VerifySlackSignature(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	if signingSecret == "" {
+		return errors.New("signing_secret не налаштовано")
+	}
+	timestamp := header.Get(slackTimestampHeader)
+	signature := header.Get(slackSignatureHeader)
+	if timestamp == "" || signature == "" {
+		return errors.New("запит не підписано")
+	}
+
+	// Застарілі запити відхиляються навіть з коректним підписом
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("невірний час запиту %q", timestamp)
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > slackReplayWindow || age < -slackReplayWindow {
+		return fmt.Errorf("час запиту %s поза вікном %s", time.Unix(ts, 0).UTC().Format(time.RFC3339), slackReplayWindow)
+	}
+
+	sig, ok := strings.CutPrefix(signature, slackSignatureVersion+"=")
+	if !ok {
+		return errors.New("невідома версія підпису")
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return errors.New("невірний формат підпису")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "%s:%s:", slackSignatureVersion, timestamp)
+	mac.Write(body)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return errors.New("невірний підпис")
+	}
+	return nil
+}
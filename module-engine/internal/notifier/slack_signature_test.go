@@ -0,0 +1,91 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Записаний запит Slack з відомим підписом
+type slackFixture struct {
+	SigningSecret string            `json:"signing_secret"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body"`
+}
+
+func loadSlackFixture(t *testing.T) (slackFixture, http.Header, time.Time) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/slack_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f slackFixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	for k, v := range f.Headers {
+		header.Set(k, v)
+	}
+	ts, err := strconv.ParseInt(f.Headers[slackTimestampHeader], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, header, time.Unix(ts, 0)
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	f, recorded, sent := loadSlackFixture(t)
+	tests := []struct {
+		name    string
+		secret  string
+		header  func(h http.Header)
+		body    string
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "recorded request", now: sent.Add(30 * time.Second)},
+		{name: "clock skew inside window", now: sent.Add(-4 * time.Minute)},
+		{name: "tampered body", body: f.Body + "&text=unblock", now: sent, wantErr: true},
+		{name: "wrong secret", secret: "other-secret", now: sent, wantErr: true},
+		{name: "expired timestamp", now: sent.Add(5*time.Minute + time.Second), wantErr: true},
+		{name: "timestamp from the future", now: sent.Add(-6 * time.Minute), wantErr: true},
+		{name: "replayed with new timestamp", now: sent.Add(time.Hour), header: func(h http.Header) {
+			h.Set(slackTimestampHeader, strconv.FormatInt(sent.Add(time.Hour).Unix(), 10))
+		}, wantErr: true},
+		{name: "missing signature header", now: sent, header: func(h http.Header) { h.Del(slackSignatureHeader) }, wantErr: true},
+		{name: "missing timestamp header", now: sent, header: func(h http.Header) { h.Del(slackTimestampHeader) }, wantErr: true},
+		{name: "unknown signature version", now: sent, header: func(h http.Header) {
+			h.Set(slackSignatureHeader, "v1="+h.Get(slackSignatureHeader)[3:])
+		}, wantErr: true},
+		{name: "malformed signature", now: sent, header: func(h http.Header) { h.Set(slackSignatureHeader, "v0=zz") }, wantErr: true},
+		{name: "signing secret not configured", secret: "-", now: sent, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := f.SigningSecret
+			switch tt.secret {
+			case "":
+			case "-":
+				secret = ""
+			default:
+				secret = tt.secret
+			}
+			header := recorded.Clone()
+			if tt.header != nil {
+				tt.header(header)
+			}
+			body := f.Body
+			if tt.body != "" {
+				body = tt.body
+			}
+			err := VerifySlackSignature(secret, header, []byte(body), tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySlackSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package notifier
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Сповіщення Microsoft Teams через вхідний вебхук (Adaptive Card).
+// Вебхук не підтримує зворотних викликів та редагування: кнопки відкривають підписані
+// посилання на сторінку підтвердження, а оновлення надсилаються окремими повідомленнями
+type TeamsNotifier struct {
+	cfg    config.TeamsConfig // Налаштування вебхука
+	links  *ApprovalLinks     // Підписані посилання для кнопок
+	client *http.Client       // HTTP-клієнт
+}
+
+// Новий екземпляр TeamsNotifier
+func NewTeamsNotifier(cfg config.TeamsConfig, links *ApprovalLinks) *TeamsNotifier {
+	return &TeamsNotifier{cfg: cfg, links: links, client: defaultClient}
+}
+
+// Елемент Adaptive Card (текстовий блок або дія)
+type teamsElement struct {
+	Type  string `json:"type"`            // TextBlock або Action.OpenUrl
+	Text  string `json:"text,omitempty"`  // Текст блоку
+	Wrap  bool   `json:"wrap,omitempty"`  // Перенесення рядків
+	Title string `json:"title,omitempty"` // Текст кнопки
+	URL   string `json:"url,omitempty"`   // Посилання кнопки
+}
+
+// Надсилання картки з кнопками-посиланнями
+func (t *TeamsNotifier) Send(msg Message) (string, error) {
+	var actions []teamsElement
+	now := time.Now()
+	for _, button := range msg.Buttons {
+		if link := t.links.URL(msg.Value(button.Action), now); link != "" {
+			actions = append(actions, teamsElement{Type: "Action.OpenUrl", Title: button.Label, URL: link})
+		}
+	}
+	if len(msg.Buttons) > 0 && len(actions) == 0 {
+		log.Printf("Підписані посилання не налаштовано, повідомлення Teams надсилається без кнопок")
+	}
+	return msg.IncidentID, t.post(msg.Text, actions)
+}
+
+// Оновлення: вхідний вебхук не редагує повідомлення, тому надсилається нове
+func (t *TeamsNotifier) Update(ref, text string) error {
+	return t.post(text, nil)
+}
+
+// Надсилання Adaptive Card у вебхук
+func (t *TeamsNotifier) post(text string, actions []teamsElement) error {
+	if t.cfg.WebhookURL == "" {
+		return errors.New("notifier.teams.webhook_url не налаштовано")
+	}
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    []teamsElement{{Type: "TextBlock", Text: text, Wrap: true}},
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+	payload := map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+	if _, err := postJSON(t.client, t.cfg.WebhookURL, nil, payload); err != nil {
+		return err
+	}
+	log.Printf("Повідомлення Teams успішно надіслано")
+	return nil
+}
@@ -0,0 +1,155 @@
+package notifier
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Шлях вебхука бота Telegram за замовчуванням
+const DefaultTelegramCallbackPath = "/telegram/callback"
+
+// Заголовок із secret_token, вказаним у setWebhook
+const telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Адреса Telegram Bot API
+const telegramAPIURL = "https://api.telegram.org"
+
+// Сповіщення Telegram з inline-клавіатурою. callback_data обмежено 64 байтами, тому кнопка
+// містить лише інцидент та дію ("інцидент|дія"); сценарій та IP визначаються за інцидентом
+type TelegramNotifier struct {
+	cfg    config.TelegramConfig // Налаштування бота
+	apiURL string                // Адреса Bot API
+	client *http.Client          // HTTP-клієнт
+}
+
+// Новий екземпляр TelegramNotifier
+func NewTelegramNotifier(cfg config.TelegramConfig) *TelegramNotifier {
+	return &TelegramNotifier{cfg: cfg, apiURL: telegramAPIURL, client: defaultClient}
+}
+
+// Шлях вебхука для натискань кнопок
+func (t *TelegramNotifier) CallbackPath() string {
+	if t.cfg.CallbackPath == "" {
+		return DefaultTelegramCallbackPath
+	}
+	return t.cfg.CallbackPath
+}
+
+// Кнопка inline-клавіатури
+type telegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// Формування callback_data кнопки
+func TelegramCallbackData(incidentID, action string) string {
+	return incidentID + "|" + action
+}
+
+// Розбір callback_data, сформованого TelegramCallbackData
+func ParseTelegramCallbackData(data string) (incidentID, action string, ok bool) {
+	incidentID, action, ok = strings.Cut(data, "|")
+	return incidentID, action, ok && incidentID != "" && action != ""
+}
+
+// Перевірка secret_token у запиті вебхука бота
+func VerifyTelegramSecret(secret string, header http.Header) error {
+	if secret == "" {
+		return errors.New("webhook_secret не налаштовано")
+	}
+	if subtle.ConstantTimeCompare([]byte(header.Get(telegramSecretHeader)), []byte(secret)) != 1 {
+		return errors.New("невірний secret_token")
+	}
+	return nil
+}
+
+// Надсилання повідомлення з кнопками; повертає message_id
+func (t *TelegramNotifier) Send(msg Message) (string, error) {
+	// Кожна кнопка в окремому рядку клавіатури
+	var keyboard [][]telegramButton
+	for _, button := range msg.Buttons {
+		keyboard = append(keyboard, []telegramButton{{Text: button.Label, CallbackData: TelegramCallbackData(msg.IncidentID, button.Action)}})
+	}
+	payload := map[string]interface{}{
+		"chat_id": t.cfg.ChatID,
+		"text":    msg.Text,
+	}
+	if len(keyboard) > 0 {
+		payload["reply_markup"] = map[string]interface{}{"inline_keyboard": keyboard}
+	}
+
+	var result struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := t.call("sendMessage", payload, &result); err != nil {
+		return "", err
+	}
+	log.Printf("Повідомлення Telegram успішно надіслано з message_id: %d", result.MessageID)
+	return strconv.FormatInt(result.MessageID, 10), nil
+}
+
+// Оновлення тексту повідомлення; клавіатура прибирається
+func (t *TelegramNotifier) Update(ref, text string) error {
+	if ref == "" {
+		return errors.New("повідомлення Telegram не було надіслано")
+	}
+	payload := map[string]interface{}{
+		"chat_id":    t.cfg.ChatID,
+		"message_id": ref,
+		"text":       text,
+	}
+	return t.call("editMessageText", payload, nil)
+}
+
+// Відповідь на повідомлення ref з подією інциденту
+func (t *TelegramNotifier) Reply(ref, text string) error {
+	if ref == "" {
+		return errors.New("повідомлення Telegram не було надіслано")
+	}
+	payload := map[string]interface{}{
+		"chat_id":             t.cfg.ChatID,
+		"text":                text,
+		"reply_to_message_id": ref,
+	}
+	return t.call("sendMessage", payload, nil)
+}
+
+// Відповідь на натискання кнопки (прибирає індикатор завантаження в клієнті)
+func (t *TelegramNotifier) AnswerCallback(callbackID, text string) error {
+	return t.call("answerCallbackQuery", map[string]interface{}{"callback_query_id": callbackID, "text": text}, nil)
+}
+
+// Виклик методу Bot API
+func (t *TelegramNotifier) call(method string, payload interface{}, result interface{}) error {
+	if t.cfg.BotToken == "" {
+		return errors.New("notifier.telegram.bot_token не налаштовано")
+	}
+	body, err := postJSON(t.client, fmt.Sprintf("%s/bot%s/%s", t.apiURL, t.cfg.BotToken, method), nil, payload)
+	// Bot API повертає опис помилки і для статусів поза 2xx
+	var resp struct {
+		Ok          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if jsonErr := json.Unmarshal(body, &resp); jsonErr != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("помилка при декодуванні відповіді Telegram: %v", jsonErr)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("помилка Telegram API (%s): %s", method, resp.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Заголовок з підписом тіла вихідного вебхука
+const webhookSignatureHeader = "X-Signature"
+
+// Сповіщення довільним вихідним вебхуком. Отримувач може виконати дію, відкривши
+// підписане посилання з поля url відповідної дії
+type WebhookNotifier struct {
+	cfg    config.WebhookConfig // Налаштування вебхука
+	links  *ApprovalLinks       // Підписані посилання для дій
+	client *http.Client         // HTTP-клієнт
+}
+
+// Новий екземпляр WebhookNotifier
+func NewWebhookNotifier(cfg config.WebhookConfig, links *ApprovalLinks) *WebhookNotifier {
+	return &WebhookNotifier{cfg: cfg, links: links, client: defaultClient}
+}
+
+// Варіант дії у тілі вебхука
+type webhookAction struct {
+	Label  string `json:"label"`         // Текст кнопки
+	Action string `json:"action"`        // Назва діяча або all
+	URL    string `json:"url,omitempty"` // Підписане посилання для виконання
+}
+
+// Тіло вебхука
+type webhookPayload struct {
+	Event      string          `json:"event"`              // incident або update
+	Ref        string          `json:"ref"`                // Ідентифікатор сповіщення
+	Scenario   string          `json:"scenario,omitempty"` // Сценарій, що спрацював
+	IP         string          `json:"ip,omitempty"`       // Суб'єкт сценарію
+	IncidentID string          `json:"incident,omitempty"` // Інцидент
+	Text       string          `json:"text"`               // Текст повідомлення
+	Actions    []webhookAction `json:"actions,omitempty"`  // Варіанти дій
+	Time       int64           `json:"time"`               // Час надсилання (Unix)
+}
+
+// Надсилання сповіщення про інцидент
+func (h *WebhookNotifier) Send(msg Message) (string, error) {
+	now := time.Now()
+	payload := webhookPayload{
+		Event:      "incident",
+		Ref:        msg.IncidentID,
+		Scenario:   msg.Scenario,
+		IP:         msg.IP,
+		IncidentID: msg.IncidentID,
+		Text:       msg.Text,
+		Time:       now.Unix(),
+	}
+	for _, button := range msg.Buttons {
+		payload.Actions = append(payload.Actions, webhookAction{
+			Label:  button.Label,
+			Action: button.Action,
+			URL:    h.links.URL(msg.Value(button.Action), now),
+		})
+	}
+	if err := h.post(payload); err != nil {
+		return "", err
+	}
+	log.Printf("Вебхук про інцидент %s успішно надіслано", msg.IncidentID)
+	return payload.Ref, nil
+}
+
+// Надсилання оновлення сповіщення
+func (h *WebhookNotifier) Update(ref, text string) error {
+	return h.post(webhookPayload{Event: "update", Ref: ref, Text: text, Time: time.Now().Unix()})
+}
+
+// Надсилання тіла з підписом HMAC-SHA256, якщо вказано секрет
+func (h *WebhookNotifier) post(payload webhookPayload) error {
+	if h.cfg.URL == "" {
+		return errors.New("notifier.webhook.url не налаштовано")
+	}
+	headers := make(map[string]string, len(h.cfg.Headers)+1)
+	for name, value := range h.cfg.Headers {
+		headers[name] = value
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if h.cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.cfg.Secret))
+		mac.Write(data)
+		headers[webhookSignatureHeader] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	// Тіло передається вже закодованим, щоб підпис відповідав надісланим байтам
+	_, err = postJSON(h.client, h.cfg.URL, headers, json.RawMessage(data))
+	return err
+}
@@ -0,0 +1,223 @@
+package scenario
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Значення за замовчуванням для об'єднання блокувань
+const (
+	defaultAggregateWindow   = 3600 // Вікно підрахунку блокувань (в секундах)
+	defaultAggregatePrefixV4 = 24   // Мережа IPv4
+	defaultAggregatePrefixV6 = 48   // Мережа IPv6
+)
+
+// Мережа, до якої належить адреса; false, якщо об'єднання вимкнено або суб'єкт не є IP-адресою
+func networkOf(cfg config.AggregateConfig, subject string) (netip.Prefix, bool) {
+	if cfg.Threshold <= 0 {
+		return netip.Prefix{}, false
+	}
+	addr, err := netip.ParseAddr(subject)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	bits := defaultAggregatePrefixV4
+	if cfg.PrefixV4 > 0 {
+		bits = cfg.PrefixV4
+	}
+	if addr.Is6() {
+		bits = defaultAggregatePrefixV6
+		if cfg.PrefixV6 > 0 {
+			bits = cfg.PrefixV6
+		}
+	}
+	network, err := addr.Prefix(bits)
+	return network, err == nil
+}
+
+// Чи є суб'єкт записом блокування мережі
+func isNetwork(subject string) bool {
+	return strings.Contains(subject, "/")
+}
+
+// Час блокування суб'єкта в хвилинах: для мережі - aggregate.unblock_after, якщо його вказано
+func (m *Manager) unblockMinutes(scenarioName, subject string) int {
+	scenario := m.cfg.Scenarios[scenarioName]
+	if isNetwork(subject) && scenario.Aggregate.UnblockAfter > 0 {
+		return scenario.Aggregate.UnblockAfter
+	}
+	return scenario.Params.UnblockAfter
+}
+
+// Перевірка, чи адресу вже охоплює активне блокування її мережі; окремі дії для неї не виконуються
+func (m *Manager) covered(scenarioName, ip string) bool {
+	network, ok := networkOf(m.cfg.Scenarios[scenarioName].Aggregate, ip)
+	if !ok {
+		return false
+	}
+	records, err := m.db.GetRecordsByIP(network.String())
+	if err != nil {
+		log.Printf("Не вдалося перевірити блокування мережі %s: %v", network, err)
+		return false
+	}
+	for _, record := range records {
+		if record.Scenario == scenarioName && record.BlockedAt > 0 {
+			log.Printf("IP %s входить до заблокованої мережі %s (сценарій %s), окремі дії пропущено", ip, network, scenarioName)
+			return true
+		}
+	}
+	return false
+}
+
+// Об'єднання блокувань після блокування адреси ip (виконується у фоні без захоплених блокувань):
+// якщо в мережі адреси за вікно заблоковано threshold адрес, окремі правила адрес скасовуються
+// і блокується вся мережа. ref - сповіщення, у гілці якого публікується подія
+func (m *Manager) aggregate(scenarioName, ip, ref string) {
+	cfg := m.cfg.Scenarios[scenarioName].Aggregate
+	network, ok := networkOf(cfg, ip)
+	if !ok {
+		return
+	}
+	window := int64(cfg.Window)
+	if window <= 0 {
+		window = defaultAggregateWindow
+	}
+	records, err := m.db.GetBlockedRecords(scenarioName, time.Now().Unix()-window)
+	if err != nil {
+		log.Printf("Не вдалося отримати блокування мережі %s: %v", network, err)
+		return
+	}
+	var members []string // Заблоковані адреси мережі
+	for _, record := range records {
+		if addr, err := netip.ParseAddr(record.IP); err == nil && network.Contains(addr) {
+			members = append(members, record.IP)
+		}
+	}
+	if len(members) < cfg.Threshold {
+		return
+	}
+
+	// Блокування мережі - окремий запис із власним розкладом розблокування
+	subject := network.String()
+	unlock := m.locks.Lock(recordKey(scenarioName, subject))
+	defer unlock()
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, subject)
+	if err != nil {
+		log.Printf("Помилка при роботі з базою даних для мережі %s: %v", subject, err)
+		return
+	}
+	if record.BlockedAt > 0 {
+		return // Мережу вже заблоковано іншим об'єднанням
+	}
+	log.Printf("У мережі %s заблоковано %d адрес за %d с, блокуємо мережу (сценарій %s)", subject, len(members), window, scenarioName)
+
+	// Окремі правила адрес знімаються до блокування мережі: набір з flags interval не приймає
+	// мережу, що перетинається з уже доданими адресами
+	var folded []models.BlockRecord // Стан знятих блокувань для відновлення
+	for _, member := range members {
+		if prev, ok := m.fold(scenarioName, member, subject); ok {
+			folded = append(folded, prev)
+		}
+	}
+	if err := m.executeAction(scenarioName, ActionAll, subject); err != nil {
+		log.Printf("Не вдалося заблокувати мережу %s: %v", subject, err)
+	}
+
+	record, err = m.db.GetOrCreateBlockRecord(scenarioName, subject)
+	if err == nil && record.BlockedAt > 0 {
+		m.timeline(scenarioName, ref, fmt.Sprintf("Мережу %s заблоковано замість окремих адрес: %s", subject, strings.Join(members, ", ")))
+		return
+	}
+	if err != nil {
+		log.Printf("Помилка при роботі з базою даних для мережі %s: %v", subject, err)
+	}
+	log.Printf("Мережу %s не заблоковано, відновлюємо окремі блокування адрес", subject)
+	for _, prev := range folded {
+		m.restore(scenarioName, prev)
+	}
+}
+
+// Скасування окремого блокування адреси, що увійде до заблокованої мережі.
+// Повертає стан запису до скасування; false, якщо адресу вже розблоковано або скасування не вдалося
+func (m *Manager) fold(scenarioName, ip, network string) (models.BlockRecord, bool) {
+	key := recordKey(scenarioName, ip)
+	unlock := m.locks.Lock(key)
+	defer unlock()
+
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip)
+	if err != nil || record.BlockedAt == 0 {
+		return models.BlockRecord{}, false // Адресу вже розблоковано
+	}
+	m.stopTimer(m.unblockCancel, key)
+	log.Printf("Блокування IP %s замінюється блокуванням мережі %s", ip, network)
+	if err := m.unblock(scenarioName, ip, false); err != nil {
+		log.Printf("Не вдалося скасувати окреме блокування IP %s: %v", ip, err)
+		m.startUnblockTimer(scenarioName, ip, record.UnblockAfter) // Запис залишився заблокованим
+		return models.BlockRecord{}, false
+	}
+	return *record, true
+}
+
+// Відновлення окремого блокування адреси, якщо мережу заблокувати не вдалося:
+// діячі виконуються повторно, а запис отримує попередній час розблокування
+func (m *Manager) restore(scenarioName string, prev models.BlockRecord) {
+	ip := prev.IP
+	key := recordKey(scenarioName, ip)
+	unlock := m.locks.Lock(key)
+	defer unlock()
+
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip)
+	if err != nil {
+		log.Printf("Помилка при роботі з базою даних для IP %s: %v", ip, err)
+		return
+	}
+	if record.BlockedAt > 0 {
+		return // Адресу вже заблоковано новою подією
+	}
+	unlockScopes := m.lockScopes(ip, prev.Actioners)
+	defer unlockScopes()
+
+	var restored []string                                                      // Діячі, що знову заблокували адресу
+	incident := actioner.Incident{Scenario: scenarioName, ID: prev.IncidentID} // Контекст для опису правил діячів
+	for _, actName := range prev.Actioners {
+		act, ok := m.actioners[actName]
+		if !ok {
+			continue
+		}
+		if err := runActioner(act, ip, incident); err != nil {
+			log.Printf("Не вдалося відновити блокування IP %s діячем %s: %v", ip, actName, err)
+			continue
+		}
+		restored = append(restored, actName)
+	}
+	if !m.hasReverter(restored) {
+		m.timeline(scenarioName, prev.MessageTS, fmt.Sprintf("Не вдалося відновити блокування IP %s", ip))
+		return
+	}
+	_, err = m.db.UpdateRecord(scenarioName, ip, func(record *models.BlockRecord) error {
+		for _, actName := range restored {
+			if !containsActioner(record.Actioners, actName) {
+				record.Actioners = append(record.Actioners, actName)
+			}
+		}
+		record.BlockedAt = prev.BlockedAt       // Блокування триває з попереднього часу
+		record.UnblockAfter = prev.UnblockAfter // і знімається за попереднім розкладом
+		record.ActionTaken = true
+		record.IncidentID = prev.IncidentID
+		return nil
+	})
+	if err != nil {
+		log.Printf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+		return
+	}
+	log.Printf("Окреме блокування IP %s відновлено", ip)
+	m.timeline(scenarioName, prev.MessageTS, fmt.Sprintf("IP %s знову заблоковано окремо: мережу заблокувати не вдалося", ip))
+	m.startUnblockTimer(scenarioName, ip, prev.UnblockAfter)
+}
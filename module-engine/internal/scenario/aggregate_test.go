@@ -0,0 +1,237 @@
+package scenario
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Набір з flags interval без auto-merge: як і nft, відхиляє елемент, що перетинається з доданим
+type intervalSet struct {
+	mu       sync.Mutex
+	elements map[netip.Prefix]bool
+	fail     map[string]bool // Суб'єкти, блокування яких завершується помилкою
+}
+
+func newIntervalSet() *intervalSet {
+	return &intervalSet{elements: map[netip.Prefix]bool{}, fail: map[string]bool{}}
+}
+
+func (s *intervalSet) Name() string { return "interval_set" }
+
+func element(subject string) netip.Prefix {
+	if prefix, err := netip.ParsePrefix(subject); err == nil {
+		return prefix.Masked()
+	}
+	addr := netip.MustParseAddr(subject)
+	return netip.PrefixFrom(addr, addr.BitLen())
+}
+
+func (s *intervalSet) Execute(subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[subject] {
+		return fmt.Errorf("set is full")
+	}
+	add := element(subject)
+	for existing := range s.elements {
+		if existing != add && existing.Overlaps(add) {
+			return fmt.Errorf("conflicting intervals specified: %s and %s", existing, add)
+		}
+	}
+	s.elements[add] = true
+	return nil
+}
+
+func (s *intervalSet) Revert(subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.elements, element(subject))
+	return nil
+}
+
+// Чи є суб'єкт окремим елементом набору
+func (s *intervalSet) has(subject string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.elements[element(subject)]
+}
+
+func TestNetworkOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.AggregateConfig
+		subject string
+		want    string // Порожній рядок - об'єднання не застосовується
+	}{
+		{"disabled", config.AggregateConfig{}, "203.0.113.7", ""},
+		{"not an address", config.AggregateConfig{Threshold: 3}, "host.example.com", ""},
+		{"network subject", config.AggregateConfig{Threshold: 3}, "203.0.113.0/24", ""},
+		{"default ipv4", config.AggregateConfig{Threshold: 3}, "203.0.113.7", "203.0.113.0/24"},
+		{"custom ipv4", config.AggregateConfig{Threshold: 3, PrefixV4: 16}, "203.0.113.7", "203.0.0.0/16"},
+		{"default ipv6", config.AggregateConfig{Threshold: 3}, "2001:db8:1:2::7", "2001:db8:1::/48"},
+		{"custom ipv6", config.AggregateConfig{Threshold: 3, PrefixV4: 16, PrefixV6: 64}, "2001:db8:1:2::7", "2001:db8:1:2::/64"},
+		{"invalid prefix", config.AggregateConfig{Threshold: 3, PrefixV4: 40}, "203.0.113.7", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, ok := networkOf(tt.cfg, tt.subject)
+			got := ""
+			if ok {
+				got = network.String()
+			}
+			if got != tt.want {
+				t.Errorf("networkOf(%s) = %q, want %q", tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+// Сценарій ssh з об'єднанням трьох блокувань мережі за 10 хвилин і сценарій plain без об'єднання
+func aggregateManager(t *testing.T, set *intervalSet) (*Manager, func(string) models.BlockRecord) {
+	t.Helper()
+	ssh := blockScenario(scopeRule, 1, "interval_set")
+	ssh.Aggregate = config.AggregateConfig{Threshold: 3, Window: 600, UnblockAfter: 30}
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{
+		"ssh":   ssh,
+		"plain": blockScenario("Other Rule", 1, "interval_set"),
+	}}
+	m, store := newTestManager(t, cfg, set)
+	record := func(subject string) models.BlockRecord {
+		t.Helper()
+		r, err := store.GetOrCreateBlockRecord("ssh", subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *r
+	}
+	return m, record
+}
+
+// Блокування адреси з наступною перевіркою об'єднання (у фоні вона вже могла виконатися)
+func blockAndAggregate(m *Manager, ip string) {
+	m.Dispatch(models.Event{IP: ip, Rule: scopeRule})
+	m.aggregate("ssh", ip, "")
+}
+
+func TestAggregateThresholdAndWindow(t *testing.T) {
+	set := newIntervalSet()
+	m, record := aggregateManager(t, set)
+
+	// Давнє блокування поза вікном та блокування іншої мережі не враховуються
+	if _, err := m.db.UpdateRecord("ssh", "203.0.113.50", func(r *models.BlockRecord) error {
+		r.BlockedAt = time.Now().Add(-time.Hour).Unix()
+		r.UnblockAfter = time.Now().Add(time.Hour).Unix()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	blockAndAggregate(m, "198.51.100.1")
+	blockAndAggregate(m, "203.0.113.1")
+	blockAndAggregate(m, "203.0.113.2")
+	if r := record("203.0.113.0/24"); r.BlockedAt != 0 {
+		t.Fatalf("network blocked below threshold: %+v", r)
+	}
+	if !set.has("203.0.113.1") || !set.has("203.0.113.2") {
+		t.Fatal("addresses below threshold not blocked individually")
+	}
+
+	blockAndAggregate(m, "203.0.113.3")
+	network := record("203.0.113.0/24")
+	if network.BlockedAt == 0 || !set.has("203.0.113.0/24") {
+		t.Fatalf("network not blocked at threshold: %+v, elements %v", network, set.elements)
+	}
+	if got := network.UnblockAfter - network.BlockedAt; got != 30*60 {
+		t.Errorf("network blocked for %d s, want aggregate.unblock_after", got)
+	}
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		if r := record(ip); r.BlockedAt != 0 || set.has(ip) {
+			t.Errorf("member %s not folded into the network: %+v", ip, r)
+		}
+	}
+	if r := record("203.0.113.50"); r.BlockedAt == 0 {
+		t.Error("block outside the window folded")
+	}
+	if !set.has("198.51.100.1") {
+		t.Error("address of another network unblocked")
+	}
+}
+
+func TestCovered(t *testing.T) {
+	set := newIntervalSet()
+	m, record := aggregateManager(t, set)
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		blockAndAggregate(m, ip)
+	}
+
+	if !m.covered("ssh", "203.0.113.9") {
+		t.Error("address of the blocked network not covered")
+	}
+	if m.covered("ssh", "198.51.100.7") {
+		t.Error("address of another network covered")
+	}
+	if m.covered("plain", "203.0.113.9") {
+		t.Error("scenario without aggregation covered by the network of another scenario")
+	}
+
+	// Нова подія для адреси мережі не додає окремого елемента
+	m.Dispatch(models.Event{IP: "203.0.113.9", Rule: scopeRule})
+	if r := record("203.0.113.9"); r.BlockedAt != 0 || r.ActionTaken {
+		t.Errorf("covered address blocked individually: %+v", r)
+	}
+
+	// Після розблокування мережі адреси знову блокуються окремо
+	if err := m.ManualUnblock("ssh", "203.0.113.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if m.covered("ssh", "203.0.113.9") {
+		t.Error("address covered by an unblocked network")
+	}
+	m.Dispatch(models.Event{IP: "203.0.113.9", Rule: scopeRule})
+	if r := record("203.0.113.9"); r.BlockedAt == 0 || !set.has("203.0.113.9") {
+		t.Errorf("address not blocked after the network was unblocked: %+v", r)
+	}
+}
+
+// Якщо мережу заблокувати не вдалося, окремі блокування адрес відновлюються з попереднім розкладом
+func TestAggregateRestoresMembers(t *testing.T) {
+	set := newIntervalSet()
+	set.fail["203.0.113.0/24"] = true
+	m, record := aggregateManager(t, set)
+
+	before := map[string]models.BlockRecord{}
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		m.Dispatch(models.Event{IP: ip, Rule: scopeRule})
+		before[ip] = record(ip)
+	}
+	m.aggregate("ssh", "203.0.113.3", "")
+
+	if r := record("203.0.113.0/24"); r.BlockedAt != 0 {
+		t.Fatalf("network record blocked: %+v", r)
+	}
+	for ip, prev := range before {
+		r := record(ip)
+		if !set.has(ip) {
+			t.Errorf("element of %s not restored", ip)
+		}
+		if r.BlockedAt != prev.BlockedAt || r.UnblockAfter != prev.UnblockAfter || r.BlockCount != prev.BlockCount {
+			t.Errorf("%s restored as %+v, was %+v", ip, r, prev)
+		}
+		if len(r.Actioners) != 1 || r.Actioners[0] != "interval_set" {
+			t.Errorf("%s actioners = %v", ip, r.Actioners)
+		}
+	}
+
+	// Відновлені адреси розблоковуються як звичайно
+	if err := m.ManualUnblock("ssh", "203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+	if set.has("203.0.113.1") {
+		t.Error("restored element not reverted on unblock")
+	}
+}
@@ -0,0 +1,30 @@
+package scenario
+
+import (
+	"expvar"
+	"log"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
+)
+
+// Кількість подій та дій, пропущених через список дозволених, за сценаріями (доступно на /debug/vars дашборда)
+var suppressedEvents = expvar.NewMap("allowlist_suppressed")
+
+// Перевірка суб'єкта за списком дозволених; пропуск логується та враховується в лічильнику
+func (m *Manager) suppressed(scenarioName, subject string) bool {
+	if m.allowlist == nil {
+		return false
+	}
+	entry, ok := m.allowlist.Match(subject)
+	if !ok {
+		return false
+	}
+	suppressedEvents.Add(scenarioName, 1)
+	log.Printf("IP %s відповідає запису %s списку дозволених, сценарій %s пропущено", subject, entry, scenarioName)
+	return true
+}
+
+// Список дозволених для відображення та редагування на дашборді
+func (m *Manager) Allowlist() *allowlist.List {
+	return m.allowlist
+}
@@ -0,0 +1,132 @@
+package scenario
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Дії сповіщення, крім окремих діячів
+const (
+	ActionAll       = "all"       // Виконати всі дії сценарію
+	ActionDismiss   = "dismiss"   // Хибне спрацювання: скинути лічильники
+	ActionSnooze    = "snooze"    // Відкласти сценарій для IP на кілька хвилин
+	ActionAllowlist = "allowlist" // Назавжди додати IP до списку дозволених
+)
+
+// Час, на який відкладається сценарій за замовчуванням (у хвилинах)
+const defaultSnooze = 60
+
+// Тривалість відкладання сценарію кнопкою snooze
+func (m *Manager) snoozeMinutes(scenarioName string) int {
+	if minutes := m.cfg.Scenarios[scenarioName].Action.Notifier.Snooze; minutes > 0 {
+		return minutes
+	}
+	return defaultSnooze
+}
+
+// Назва дії для кнопок та оновлення сповіщення
+func (m *Manager) ActionLabel(scenarioName, action string) string {
+	switch action {
+	case ActionAll:
+		return "Виконати всі дії"
+	case ActionDismiss:
+		return "Хибне спрацювання"
+	case ActionSnooze:
+		return fmt.Sprintf("Відкласти на %d хв", m.snoozeMinutes(scenarioName))
+	case ActionAllowlist:
+		return "Додати до дозволених"
+	}
+	return action
+}
+
+// Кнопки сповіщення: окремі діячі, усі дії та рішення без виконання дій
+func (m *Manager) buttons(scenarioName string) []notifier.Button {
+	var buttons []notifier.Button
+	for _, actName := range m.cfg.Scenarios[scenarioName].Action.Actioners {
+		buttons = append(buttons, notifier.Button{Label: actName, Action: actName}) // Кнопка для кожного actioner
+	}
+	buttons = append(buttons, notifier.Button{Label: m.ActionLabel(scenarioName, ActionAll), Action: ActionAll, Style: "primary"})
+	buttons = append(buttons, notifier.Button{Label: m.ActionLabel(scenarioName, ActionDismiss), Action: ActionDismiss})
+	buttons = append(buttons, notifier.Button{Label: m.ActionLabel(scenarioName, ActionSnooze), Action: ActionSnooze})
+	buttons = append(buttons, notifier.Button{Label: m.ActionLabel(scenarioName, ActionAllowlist), Action: ActionAllowlist, Style: "danger"})
+	return buttons
+}
+
+// Перевірка, чи є дія рішенням без виконання діячів
+func isResolution(action string) bool {
+	return action == ActionDismiss || action == ActionSnooze || action == ActionAllowlist
+}
+
+// Закриття інциденту без виконання дій (з захопленим блокуванням пари сценарій/IP):
+// лічильник скидається, а для snooze нові події не враховуються до кінця відкладання
+func (m *Manager) resolve(scenarioName, action, ip, user string) error {
+	key := recordKey(scenarioName, ip)
+	if m.stopTimer(m.cancel, key) {
+		log.Printf("Скасовано таймаут сповіщення для IP %s через рішення %s", ip, action)
+	}
+
+	now := time.Now().Unix()
+	if action == ActionAllowlist {
+		entry := models.AllowlistEntry{
+			Value:   ip,
+			Comment: fmt.Sprintf("Сценарій %s", scenarioName),
+			AddedBy: user,
+			Time:    now,
+		}
+		if m.allowlist == nil {
+			return fmt.Errorf("список дозволених не налаштовано, IP %s не додано", ip)
+		}
+		if err := m.allowlist.Add(entry); err != nil {
+			return fmt.Errorf("Не вдалося додати IP %s до списку дозволених: %v", ip, err)
+		}
+		log.Printf("IP %s додано до списку дозволених (користувач %s)", ip, user)
+	}
+
+	// Хибне спрацювання знімає блокування, якщо дію вже було виконано
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip)
+	if err != nil {
+		return fmt.Errorf("Не вдалося отримати запис блокування для IP %s: %v", ip, err)
+	}
+	if record.BlockedAt > 0 {
+		m.stopTimer(m.unblockCancel, key)
+		if err := m.unblock(scenarioName, ip, false); err != nil {
+			m.startUnblockTimer(scenarioName, ip, record.UnblockAfter) // Запис залишився заблокованим
+			return fmt.Errorf("Не вдалося розблокувати IP %s: %v", ip, err)
+		}
+	}
+
+	_, err = m.db.UpdateRecord(scenarioName, ip, func(record *models.BlockRecord) error {
+		record.TriggerCount = 0    // Скидаємо лічильник подій
+		record.ResetAt = now       // Події до рішення більше не враховуються
+		record.NotifiedAt = 0      // Сповіщення більше не очікує на вибір дії
+		record.ActionTaken = false // Дію не виконано
+		record.IncidentID = ""     // Інцидент закрито, інші кнопки повідомлення більше не діють
+		if action == ActionSnooze {
+			record.ResetAt = now + int64(m.snoozeMinutes(scenarioName))*60 // Події до кінця відкладання не враховуються
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+	}
+	return nil
+}
+
+// Збереження рішення з автором для історії інцидентів
+func (m *Manager) recordDecision(scenarioName, action, ip, incidentID, user string) {
+	decision := models.Decision{
+		IncidentID: incidentID,
+		Scenario:   scenarioName,
+		IP:         ip,
+		Action:     action,
+		User:       user,
+		Time:       time.Now().Unix(),
+	}
+	if err := m.db.RecordDecision(decision); err != nil {
+		log.Printf("Не вдалося зберегти рішення %s для IP %s: %v", action, ip, err)
+	}
+}
@@ -0,0 +1,211 @@
+package scenario
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Нотифікатор, що запам'ятовує надіслані сповіщення
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []notifier.Message
+}
+
+func (f *fakeNotifier) Send(msg notifier.Message) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+	return "ts-1", nil
+}
+
+func (f *fakeNotifier) Update(ref, text string) error { return nil }
+
+// Менеджер зі сценарієм ssh, що очікує рішення у сповіщенні, та відкритим інцидентом для ip
+func notifiedIncident(t *testing.T, ip string) (*Manager, *db.SQLiteDB, *fakeActioner, string) {
+	t.Helper()
+	const rule = "Detect Failed SSH Login Attempts"
+	fw := newFakeActioner("fake_firewall")
+	sc := blockScenario(rule, 1, "fake_firewall")
+	sc.Action.Notifier = config.NotifierConfig{Enabled: true, Name: "fake", Timeout: 10}
+	m, store := newTestManager(t, &config.Config{Scenarios: map[string]config.Scenario{"ssh": sc}}, fw)
+	n := &fakeNotifier{}
+	m.notifiers["fake"] = n
+
+	m.Dispatch(models.Event{IP: ip, Rule: rule})
+	if len(n.sent) != 1 || n.sent[0].IncidentID == "" {
+		t.Fatalf("notification not sent: %+v", n.sent)
+	}
+	return m, store, fw, n.sent[0].IncidentID
+}
+
+// Повторний вибір дії для того самого інциденту не виконує її вдруге
+func TestExecuteActionOnce(t *testing.T) {
+	ip := "203.0.113.7"
+	m, store, fw, incident := notifiedIncident(t, ip)
+
+	if err := m.ExecuteAction("ssh", ActionAll, ip, incident, "alice"); err != nil {
+		t.Fatalf("ExecuteAction() error = %v", err)
+	}
+	// Повторне натискання, пересланий лист або інше рішення для того самого інциденту
+	for _, action := range []string{ActionAll, ActionAll, "fake_firewall", ActionDismiss} {
+		if err := m.ExecuteAction("ssh", action, ip, incident, "mallory"); !errors.Is(err, ErrDecided) {
+			t.Errorf("replayed %s: error = %v, want ErrDecided", action, err)
+		}
+	}
+
+	if n := fw.executions(ip); n != 1 {
+		t.Errorf("executed %d times, want 1", n)
+	}
+	r := findRecord(t, store, "ssh", ip)
+	if r.BlockCount != 1 || r.BlockedAt == 0 {
+		t.Errorf("BlockCount = %d, BlockedAt = %d, want one active block", r.BlockCount, r.BlockedAt)
+	}
+	decisions, err := store.GetDecisionsByIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].User != "alice" || decisions[0].Action != ActionAll {
+		t.Errorf("decisions = %+v, want only alice's", decisions)
+	}
+}
+
+// Одночасні натискання кнопки: виконується лише одне рішення
+func TestExecuteActionConcurrentReplays(t *testing.T) {
+	ip := "203.0.113.8"
+	m, store, fw, incident := notifiedIncident(t, ip)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.ExecuteAction("ssh", ActionAll, ip, incident, "alice")
+			if err != nil && !errors.Is(err, ErrDecided) {
+				t.Errorf("ExecuteAction() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				accepted++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("%d decisions accepted, want 1", accepted)
+	}
+	if n := fw.executions(ip); n != 1 {
+		t.Errorf("executed %d times, want 1", n)
+	}
+	if r := findRecord(t, store, "ssh", ip); r.BlockCount != 1 {
+		t.Errorf("BlockCount = %d, want 1", r.BlockCount)
+	}
+}
+
+// Рішення для старого інциденту не впливає на новий
+func TestExecuteActionStaleIncident(t *testing.T) {
+	ip := "203.0.113.9"
+	m, _, fw, incident := notifiedIncident(t, ip)
+
+	if err := m.ExecuteAction("ssh", ActionAll, ip, "0000000000000000", "alice"); !errors.Is(err, ErrStaleIncident) {
+		t.Errorf("unknown incident: error = %v, want ErrStaleIncident", err)
+	}
+	if err := m.ExecuteAction("ssh", ActionDismiss, ip, incident, "alice"); err != nil {
+		t.Fatalf("dismiss: %v", err)
+	}
+	// Після закриття інциденту кнопки його повідомлення не діють
+	if err := m.ExecuteAction("ssh", ActionAll, ip, incident, "alice"); !errors.Is(err, ErrStaleIncident) {
+		t.Errorf("closed incident: error = %v, want ErrStaleIncident", err)
+	}
+	if n := fw.executions(ip); n != 0 {
+		t.Errorf("executed %d times, want 0", n)
+	}
+}
+
+// Дія, яку не вдалося виконати, не закриває інцидент: рішення не зберігається і його можна обрати повторно
+func TestExecuteActionFailure(t *testing.T) {
+	ip := "203.0.113.10"
+	m, store, fw, incident := notifiedIncident(t, ip)
+
+	fw.fail(errors.New("permission denied"), nil)
+	for _, action := range []string{ActionAll, "fake_firewall"} {
+		if err := m.ExecuteAction("ssh", action, ip, incident, "alice"); err == nil || errors.Is(err, ErrDecided) {
+			t.Errorf("%s with a failing actioner: error = %v", action, err)
+		}
+	}
+	if err := m.ExecuteAction("ssh", "unknown", ip, incident, "alice"); err == nil {
+		t.Error("unknown action accepted")
+	}
+	decisions, err := store.GetDecisionsByIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 0 {
+		t.Fatalf("decisions after failures = %+v, want none", decisions)
+	}
+	if r := findRecord(t, store, "ssh", ip); r.BlockedAt != 0 || r.ActionTaken || r.IncidentID != incident {
+		t.Errorf("record after failures = %+v", r)
+	}
+
+	fw.fail(nil, nil)
+	if err := m.ExecuteAction("ssh", ActionAll, ip, incident, "bob"); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if n := fw.executions(ip); n != 1 {
+		t.Errorf("executed %d times, want 1", n)
+	}
+	decisions, err = store.GetDecisionsByIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].User != "bob" {
+		t.Errorf("decisions = %+v, want only bob's", decisions)
+	}
+}
+
+// Чи запущено таймер розблокування запису
+func hasUnblockTimer(m *Manager, scenarioName, ip string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.unblockCancel[recordKey(scenarioName, ip)]
+	return ok
+}
+
+// Якщо рішення не зняло блокування, запис розблоковується за розкладом
+func TestResolveRevertFailureKeepsTimer(t *testing.T) {
+	ip := "203.0.113.11"
+	m, store, fw, incident := notifiedIncident(t, ip)
+	if err := m.ExecuteAction("ssh", ActionAll, ip, incident, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	fw.fail(nil, errors.New("rule is locked"))
+	for _, action := range []string{ActionDismiss, ActionSnooze} {
+		if err := m.ExecuteAction("ssh", action, ip, "", "bob"); err == nil {
+			t.Fatalf("%s with a failing revert succeeded", action)
+		}
+		if r := findRecord(t, store, "ssh", ip); r.BlockedAt == 0 {
+			t.Fatalf("%s: record unblocked although the revert failed: %+v", action, r)
+		}
+		if !hasUnblockTimer(m, "ssh", ip) {
+			t.Errorf("%s: unblock timer not restarted", action)
+		}
+	}
+
+	fw.fail(nil, nil)
+	if err := m.ExecuteAction("ssh", ActionDismiss, ip, "", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if hasUnblockTimer(m, "ssh", ip) {
+		t.Error("unblock timer left after the record was unblocked")
+	}
+}
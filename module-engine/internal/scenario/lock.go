@@ -0,0 +1,42 @@
+package scenario
+
+import "sync"
+
+// Набір м'ютексів за ключем: операції над однією парою сценарій/IP виконуються послідовно,
+// а різні пари обробляються паралельно
+type keyedMutex struct {
+	mu    sync.Mutex            // Захист мапи locks
+	locks map[string]*keyedLock // Активні блокування за ключем
+}
+
+// М'ютекс ключа з лічильником очікувачів для видалення з мапи
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Захоплення блокування для ключа; повертає функцію для його звільнення
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key) // Ніхто більше не чекає на ключ
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,98 @@
+package scenario
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Перевірка, чи відповідає подія умовам сценарію
+func matchScenario(scenario config.Scenario, event models.Event) bool {
+	// Правило є обов'язковою умовою
+	if event.Rule != scenario.Rule {
+		return false
+	}
+	// Джерело порівнюється без урахування регістру
+	if scenario.Source != "" && !strings.EqualFold(scenario.Source, event.Source) {
+		return false
+	}
+	// Пріоритет події має бути не нижчим за вказаний у сценарії (значення сценарію перевірено при завантаженні)
+	if scenario.Priority != "" {
+		required, ok := config.PriorityLevel(scenario.Priority)
+		if !ok {
+			return false
+		}
+		actual, ok := config.PriorityLevel(event.Priority)
+		if !ok || actual < required {
+			return false
+		}
+	}
+	// Подія має містити всі теги сценарію
+	for _, tag := range scenario.Tags {
+		if !hasTag(event.Tags, tag) {
+			return false
+		}
+	}
+	// Поля події (наприклад, username або command для Cowrie) мають відповідати шаблонам сценарію
+	for name, pattern := range scenario.Fields {
+		value, ok := event.Fields[name]
+		if !ok || !wildcardMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Порівняння значення з шаблоном, у якому * означає будь-яку послідовність символів
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	// Перша та остання частини прив'язані до початку та кінця значення
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return strings.HasSuffix(value, last)
+}
+
+// Пошук тегу у списку тегів події
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Суб'єкт події для сценарію: значення поля subject_field (IP-адреса, ім'я пода, користувач тощо)
+func subjectOf(scenario config.Scenario, event models.Event) string {
+	if scenario.SubjectField == "" || scenario.SubjectField == models.DefaultSubjectField {
+		return normalizeSubject(event.IP)
+	}
+	return normalizeSubject(event.Field(scenario.SubjectField))
+}
+
+// Канонічний запис IP-адреси, щоб різні записи однієї адреси (2001:DB8::1 та 2001:db8:0::1,
+// ::ffff:203.0.113.7 та 203.0.113.7, [::1]) мали один стан і одні правила блокування.
+// Значення, що не є IP-адресою, не змінюються
+func normalizeSubject(value string) string {
+	value = strings.TrimSpace(value)
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return value
+	}
+	return addr.Unmap().WithZone("").String()
+}
@@ -1,11 +1,18 @@
 package scenario
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
@@ -17,238 +24,653 @@ type Manager struct {
 	cfg           *config.Config               // Конфігурація системи
 	actioners     map[string]actioner.Actioner // Мапа доступних actioners для виконання дій
 	db            *db.SQLiteDB                 // Підключення до бази даних SQLite
-	notifier      *notifier.SlackNotifier      // Система сповіщень через Slack
-	cancel        map[string]chan struct{}     // Для скасування notifier timeout
-	unblockCancel map[string]chan struct{}     // Для скасування unblock таймерів
+	notifiers     map[string]notifier.Notifier // Системи сповіщень за назвою (slack, teams, telegram, email, webhook)
+	allowlist     *allowlist.List              // Адреси, для яких діячі ніколи не виконуються
+	locks         keyedMutex                   // Послідовна обробка подій і дій для кожної пари сценарій/IP
+	scopes        keyedMutex                   // Послідовні блокування та скасування для кожного об'єкта діяча
+	mu            sync.Mutex                   // Захист мап cancel та unblockCancel
+	cancel        map[string]chan struct{}     // Для скасування notifier timeout (ключ - сценарій та IP)
+	unblockCancel map[string]chan struct{}     // Для скасування unblock таймерів (ключ - сценарій та IP)
+}
+
+// Ключ стану для пари сценарій/IP у мапах таймерів
+func recordKey(scenarioName, ip string) string {
+	return scenarioName + "|" + ip
 }
 
 // Створення нового менеджера сценаріїв
-func NewManager(cfg *config.Config, actioners map[string]actioner.Actioner, db *db.SQLiteDB, notifier *notifier.SlackNotifier) *Manager {
+func NewManager(cfg *config.Config, actioners map[string]actioner.Actioner, db *db.SQLiteDB, notifiers map[string]notifier.Notifier, allow *allowlist.List) *Manager {
 	return &Manager{
 		cfg:           cfg,                            // Ініціалізація конфігурації
 		actioners:     actioners,                      // Ініціалізація actioners
 		db:            db,                             // Ініціалізація бази даних
-		notifier:      notifier,                       // Ініціалізація сповіщень
+		notifiers:     notifiers,                      // Ініціалізація сповіщень
+		allowlist:     allow,                          // Ініціалізація списку дозволених
 		cancel:        make(map[string]chan struct{}), // Ініціалізація мапи для скасування таймаутів сповіщень
 		unblockCancel: make(map[string]chan struct{}), // Ініціалізація мапи для скасування таймерів розблокування
 	}
 }
 
+// Передача події всім сценаріям, умови яких вона задовольняє
+func (m *Manager) Dispatch(event models.Event) int {
+	// Сортуємо назви сценаріїв для детермінованого порядку обробки
+	names := make([]string, 0, len(m.cfg.Scenarios))
+	for name := range m.cfg.Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matched := 0 // Кількість сценаріїв, що відповідають події
+	for _, name := range names {
+		if !matchScenario(m.cfg.Scenarios[name], event) {
+			continue
+		}
+		matched++
+		m.HandleEvent(name, event)
+	}
+	if matched == 0 {
+		log.Printf("Жоден сценарій не відповідає правилу %s (подія %s)", event.Rule, event.UUID)
+	}
+	return matched
+}
+
 // Обробка вхідної події
 func (m *Manager) HandleEvent(scenarioName string, event models.Event) {
-	log.Printf("Обробка події для IP %s, сценарій %s", event.IP, scenarioName)
 	scenario, exists := m.cfg.Scenarios[scenarioName]
 	if !exists {
 		log.Printf("Сценарій %s не знайдено в конфігурації", scenarioName)
 		return
 	}
-	// Перевірка відповідності правила події правилу сценарію
-	if event.Rule != scenario.Rule {
-		log.Printf("Правило події %s не відповідає правилу сценарію %s для IP %s", event.Rule, scenario.Rule, event.IP)
+	// Перевірка відповідності події умовам сценарію
+	if !matchScenario(scenario, event) {
+		log.Printf("Подія з правилом %s не відповідає умовам сценарію %s для IP %s", event.Rule, scenarioName, event.IP)
 		return
 	}
-	// Отримання або створення запису про блокування для IP
-	record, err := m.db.GetOrCreateBlockRecord(event.IP) // Отримуємо або створюємо запис у базі даних
-	if err != nil {
-		log.Printf("Помилка при роботі з базою даних для IP %s: %v", event.IP, err)
+	// Суб'єкт події (IP-адреса або інше значення) визначається полем, вказаним у сценарії
+	subject := subjectOf(scenario, event)
+	if subject == "" {
+		log.Printf("Подія %s не містить поля %s, потрібного сценарію %s", event.Rule, scenario.SubjectField, scenarioName)
 		return
 	}
-	currentTime := time.Now().Unix() // Поточний час у секундах з початку епохи Unix
-	// Онулення лічильника спрацьовувань
-	if record.BlockedAt == 0 && record.TriggerCount > 0 && (currentTime-record.LastEventTime) > int64(scenario.Params.TriggerWindow*60) {
-		log.Printf("Онулення TriggerCount для IP %s", event.IP)
-		record.TriggerCount = 0    // Скидаємо лічильник подій
-		record.ActionTaken = false // Позначаємо, що дія ще не виконана
-	}
-
-	// Перевіряємо, чи сценарій уже активний або повідомлення вже відправлено
-	if record.ActionTaken {
-		log.Printf("Сценарій уже активовано для IP %s, пропускаємо виконання", event.IP)
+	event.IP = subject
+	// Суб'єкти зі списку дозволених не активують сценаріїв
+	if m.suppressed(scenarioName, subject) {
 		return
 	}
-
-	record.TriggerCount++              // Збільшуємо лічильник подій
-	record.LastEventTime = currentTime // Оновлюємо час останньої події
-	log.Printf("IP %s: TriggerCount = %d, необхідний = %d", event.IP, record.TriggerCount, scenario.Params.TriggerCount)
-
+	log.Printf("Обробка події для IP %s, сценарій %s", event.IP, scenarioName)
 	if scenario.Params.TriggerCount <= 0 {
 		log.Printf("Некоректне значення trigger_count %d для сценарію %s, встановлюємо за замовчуванням 1", scenario.Params.TriggerCount, scenarioName)
 		scenario.Params.TriggerCount = 1 // Встановлюємо значення за замовчуванням, якщо параметр некоректний
 	}
 
-	// Викликаємо сценарій лише коли TriggerCount вперше досягає межі
-	if record.TriggerCount == scenario.Params.TriggerCount {
-		log.Printf("Trigger threshold reached for IP %s, executing scenario", event.IP)
-		m.executeScenario(scenarioName, event.IP, record) // Виконуємо сценарій
+	// Події для однієї пари сценарій/IP обробляються послідовно
+	unlock := m.locks.Lock(recordKey(scenarioName, event.IP))
+	defer unlock()
+
+	triggered := false               // Чи досягнуто межі спрацьовувань цією подією
+	incidentID := ""                 // Інцидент, відкритий цією подією
+	currentTime := time.Now().Unix() // Поточний час у секундах з початку епохи Unix
+	window := int64(scenario.Params.TriggerWindow)
+	// Збереження події та підрахунок подій у ковзному вікні в одній транзакції
+	_, err := m.db.RecordEvent(scenarioName, event, currentTime, window, func(record *models.BlockRecord, recent int) error {
+		// Дія без блокування (наприклад, лише запис логів) знімається, коли вікно минуло без нових подій
+		if record.BlockedAt == 0 && record.ActionTaken && (currentTime-record.LastEventTime) > window {
+			log.Printf("Онулення стану сценарію %s для IP %s", scenarioName, event.IP)
+			record.ActionTaken = false // Позначаємо, що дія ще не виконана
+		}
+		record.TriggerCount = recent       // Кількість подій за останні trigger_window секунд
+		record.LastEventTime = currentTime // Оновлюємо час останньої події
+
+		// Перевіряємо, чи сценарій уже активний або повідомлення вже відправлено
+		if record.ActionTaken || record.NotifiedAt > 0 {
+			log.Printf("Сценарій уже активовано для IP %s, пропускаємо виконання", event.IP)
+			return nil
+		}
+		if record.ResetAt > currentTime {
+			log.Printf("Сценарій %s для IP %s відкладено до %s", scenarioName, event.IP, time.Unix(record.ResetAt, 0).Format("2006-01-02 15:04:05"))
+			return nil
+		}
+		log.Printf("IP %s: TriggerCount = %d за %d с, необхідний = %d", event.IP, recent, window, scenario.Params.TriggerCount)
+
+		// Викликаємо сценарій, коли кількість подій у вікні досягає межі
+		triggered = recent >= scenario.Params.TriggerCount
+		if triggered {
+			// Кожне спрацювання відкриває новий інцидент; кнопки сповіщень посилаються на нього
+			incidentID = newIncidentID()
+			record.IncidentID = incidentID
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Помилка при роботі з базою даних для IP %s: %v", event.IP, err)
+		return
 	}
 
-	if err := m.db.UpdateBlockRecord(record); err != nil {
-		log.Printf("Не вдалося оновити запис у базі даних для IP %s: %v", event.IP, err)
+	if triggered {
+		log.Printf("Trigger threshold reached for IP %s, executing scenario", event.IP)
+		m.executeScenario(scenarioName, event.IP, incidentID) // Виконуємо сценарій
 	}
 }
 
-// Виконання сценарію
-func (m *Manager) executeScenario(scenarioName, ip string, record *models.BlockRecord) {
+// Виконання сценарію (викликається з захопленим блокуванням пари сценарій/IP)
+func (m *Manager) executeScenario(scenarioName, ip, incidentID string) {
 	scenario := m.cfg.Scenarios[scenarioName] // Отримуємо конфігурацію сценарію
-	log.Printf("Виконання сценарію %s для IP %s", scenarioName, ip)
+	log.Printf("Виконання сценарію %s для IP %s (інцидент %s)", scenarioName, ip, incidentID)
+	if m.covered(scenarioName, ip) {
+		return // Мережу адреси вже заблоковано, сповіщення не потрібне
+	}
 
-	if scenario.Action.Notifier.Enabled && scenario.Action.Notifier.Name == "slack" {
-		buttons := []notifier.SlackButton{} // Список кнопок для повідомлення в Slack
-		for _, actName := range scenario.Action.Actioners {
-			buttons = append(buttons, notifier.SlackButton{Name: actName, Value: actName}) // Додаємо кнопку для кожного actioner
+	n, known := m.notifiers[scenario.Action.Notifier.Name]
+	if scenario.Action.Notifier.Enabled && !known {
+		log.Printf("Невідомий нотифікатор %q у сценарії %s", scenario.Action.Notifier.Name, scenarioName)
+	}
+	if scenario.Action.Notifier.Enabled && known {
+		// Кожна кнопка відповідає сценарію, IP та інциденту, для яких надіслано повідомлення
+		msg := notifier.Message{
+			Scenario:   scenarioName,
+			IP:         ip,
+			IncidentID: incidentID,
+			Text:       fmt.Sprintf("Для ІР %s активовано сценарій %s (інцидент %s)", ip, scenarioName, incidentID), // Формуємо текст повідомлення
 		}
-		buttons = append(buttons, notifier.SlackButton{Name: "Виконати всі дії", Value: "all"}) // Додаємо кнопку для виконання всіх дій
+		msg.Buttons = m.buttons(scenarioName) // Кнопки діячів, усіх дій та рішень без дій
 
-		message := fmt.Sprintf("Для ІР %s активовано сценарій %s", ip, scenarioName) // Формуємо текст повідомлення
-		ts, err := m.notifier.SendMessageWithButtons(message, buttons)               // Відправляємо повідомлення з кнопками
+		ts, err := n.Send(msg) // Відправляємо повідомлення з кнопками
 		if err != nil {
-			log.Printf("Не вдалося відправити повідомлення в Slack для IP %s: %v", ip, err)
+			log.Printf("Не вдалося відправити повідомлення %s для IP %s: %v", scenario.Action.Notifier.Name, ip, err)
 		} else {
-			log.Printf("Повідомлення в Slack успішно відправлено для IP %s з ts: %s", ip, ts)
+			log.Printf("Повідомлення %s успішно відправлено для IP %s з ідентифікатором: %s", scenario.Action.Notifier.Name, ip, ts)
 		}
 
-		cancelChan := make(chan struct{}) // Канал для скасування таймауту
-		m.cancel[ip] = cancelChan         // Зберігаємо канал у мапі
+		// Зберігаємо час сповіщення для відновлення таймауту після перезапуску та ts для оновлення повідомлення
+		_, err = m.db.UpdateRecord(scenarioName, ip, func(record *models.BlockRecord) error {
+			record.NotifiedAt = time.Now().Unix()
+			record.MessageTS = ts
+			return nil
+		})
+		if err != nil {
+			log.Printf("Не вдалося зберегти стан сповіщення для IP %s: %v", ip, err)
+		}
 
+		timeout := time.Duration(scenario.Action.Notifier.Timeout) * time.Minute
 		log.Printf("Встановлення таймауту сповіщення на %d хвилин для IP %s", scenario.Action.Notifier.Timeout, ip)
-		time.AfterFunc(time.Duration(scenario.Action.Notifier.Timeout)*time.Minute, func() { // Запускаємо таймер
-			select {
-			case <-cancelChan:
-				log.Printf("Таймаут сповіщення скасовано для IP %s", ip)
-				return
-			default:
-				updatedRecord, _ := m.db.GetOrCreateBlockRecord(ip) // Оновлюємо запис для перевірки
-				if !updatedRecord.ActionTaken {
-					log.Printf("Жодної дії не обрано протягом таймауту для IP %s, виконуємо всі дії", ip)
-					m.ExecuteAction("all", ip) // Виконуємо всі дії автоматично
-					if err := m.notifier.UpdateMessage(ts, fmt.Sprintf("Автоматично виконано всі дії для IP %s", ip)); err != nil {
-						log.Printf("Не вдалося оновити повідомлення в Slack для IP %s: %v", ip, err)
-					} else {
-						log.Printf("Повідомлення в Slack оновлено для IP %s після автоматичного виконання", ip)
-					}
-				} else {
-					log.Printf("Дія вже виконана для IP %s протягом таймауту", ip)
-				}
-			}
-			delete(m.cancel, ip) // Видаляємо канал із мапи після завершення
-		})
+		m.startNotifierTimeout(scenarioName, ip, ts, timeout)
 	} else {
 		log.Printf("Сповіщення відключено для сценарію %s, виконуємо всі actioners для IP %s", scenarioName, ip)
-		m.ExecuteAction("all", ip) // Виконуємо всі дії, якщо сповіщення відключені
+		if err := m.executeAction(scenarioName, ActionAll, ip); err != nil { // Виконуємо всі дії, якщо сповіщення відключені
+			log.Printf("Не вдалося виконати дії сценарію %s для IP %s: %v", scenarioName, ip, err)
+		}
 	}
 }
 
-// Виконання конкретної дії для IP-адреси
-func (m *Manager) ExecuteAction(action, ip string) {
-	scenario := m.cfg.Scenarios["block_ip"]      // Отримуємо сценарій блокування IP
-	record, _ := m.db.GetOrCreateBlockRecord(ip) // Отримуємо запис для IP
+// Оновлення сповіщення сценарію нотифікатором, яким його було надіслано
+func (m *Manager) UpdateNotification(scenarioName, ref, text string) error {
+	name := m.cfg.Scenarios[scenarioName].Action.Notifier.Name
+	n, ok := m.notifiers[name]
+	if !ok {
+		return fmt.Errorf("невідомий нотифікатор %q", name)
+	}
+	return n.Update(ref, text)
+}
 
-	if record.BlockedAt > 0 && action != "all" {
-		log.Printf("IP %s уже заблоковано, пропускаємо дію %s", ip, action)
+// Публікація події інциденту відповіддю в гілці сповіщення ref, якщо нотифікатор сценарію це підтримує
+func (m *Manager) timeline(scenarioName, ref, text string) {
+	if ref == "" {
+		return // Сповіщення не надсилалося
+	}
+	name := m.cfg.Scenarios[scenarioName].Action.Notifier.Name
+	replier, ok := m.notifiers[name].(notifier.Replier)
+	if !ok {
 		return
 	}
+	if err := replier.Reply(ref, text); err != nil {
+		log.Printf("Не вдалося додати подію до гілки сповіщення %s: %v", ref, err)
+	}
+}
+
+// Новий випадковий ідентифікатор інциденту
+func newIncidentID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano()) // Запасний варіант, якщо генератор недоступний
+	}
+	return hex.EncodeToString(b)
+}
+
+// Запуск таймауту сповіщення: якщо до його завершення не обрано дію, виконуються всі дії сценарію
+func (m *Manager) startNotifierTimeout(scenarioName, ip, ts string, timeout time.Duration) {
+	key := recordKey(scenarioName, ip)
+	cancelChan := make(chan struct{}) // Канал для скасування таймауту
+	m.setTimer(m.cancel, key, cancelChan)
+
+	time.AfterFunc(timeout, func() { // Запускаємо таймер
+		defer m.clearTimer(m.cancel, key, cancelChan) // Видаляємо канал із мапи після завершення
+
+		unlock := m.locks.Lock(key)
+		select {
+		case <-cancelChan:
+			unlock()
+			log.Printf("Таймаут сповіщення скасовано для IP %s", ip)
+			return
+		default:
+		}
+		updatedRecord, err := m.db.GetOrCreateBlockRecord(scenarioName, ip) // Оновлюємо запис для перевірки
+		if err != nil || updatedRecord.ActionTaken {
+			unlock()
+			log.Printf("Дія вже виконана для IP %s протягом таймауту", ip)
+			return
+		}
+		log.Printf("Жодної дії не обрано протягом таймауту для IP %s, виконуємо всі дії", ip)
+		text := fmt.Sprintf("Автоматично виконано всі дії для IP %s", ip)
+		if err := m.executeAction(scenarioName, ActionAll, ip); err != nil { // Виконуємо всі дії сценарію автоматично
+			log.Printf("Не вдалося автоматично виконати дії сценарію %s для IP %s: %v", scenarioName, ip, err)
+			text = fmt.Sprintf("Не вдалося автоматично виконати дії для IP %s: %v", ip, err)
+		}
+		unlock()
+
+		if err := m.UpdateNotification(scenarioName, ts, text); err != nil {
+			log.Printf("Не вдалося оновити сповіщення для IP %s: %v", ip, err)
+		} else {
+			log.Printf("Сповіщення оновлено для IP %s після автоматичного виконання", ip)
+		}
+	})
+}
+
+// Інтервал запуску очищення старих подій
+const pruneInterval = 10 * time.Minute
+
+// Час зберігання подій за замовчуванням (7 днів)
+const defaultEventRetention = 7 * 24 * 60 * 60
+
+// Запуск фонового очищення подій, старших за час зберігання
+func (m *Manager) StartRetention() {
+	retention := int64(m.cfg.Events.Retention)
+	if retention <= 0 {
+		retention = defaultEventRetention
+	}
+	// Події мають зберігатися щонайменше протягом найбільшого вікна спрацьовувань
+	for _, scenario := range m.cfg.Scenarios {
+		if window := int64(scenario.Params.TriggerWindow); window > retention {
+			retention = window
+		}
+	}
+	log.Printf("Очищення подій старших за %d секунд кожні %s", retention, pruneInterval)
 
-	if action == "all" {
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			deleted, err := m.db.PruneEvents(time.Now().Unix() - retention)
+			if err != nil {
+				log.Printf("Не вдалося очистити старі події: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Видалено %d старих подій", deleted)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Відновлення таймерів після перезапуску: розблокування та таймаути сповіщень зберігаються лише в базі даних
+func (m *Manager) Reconcile() error {
+	records, err := m.db.GetPendingRecords() // Заблоковані IP та сповіщення без обраної дії
+	if err != nil {
+		return fmt.Errorf("Не вдалося отримати записи для відновлення таймерів: %v", err)
+	}
+	now := time.Now()
+	for _, record := range records {
+		if record.BlockedAt > 0 {
+			if record.UnblockAfter <= now.Unix() {
+				log.Printf("Час розблокування IP %s (сценарій %s) минув під час простою, розблоковуємо", record.IP, record.Scenario)
+			} else {
+				log.Printf("Відновлено таймер розблокування IP %s (сценарій %s) до %s", record.IP, record.Scenario, time.Unix(record.UnblockAfter, 0).Format("2006-01-02 15:04:05"))
+			}
+			m.startUnblockTimer(record.Scenario, record.IP, record.UnblockAfter) // Таймер з минулим часом спрацьовує одразу
+			continue
+		}
+
+		scenario, exists := m.cfg.Scenarios[record.Scenario]
+		if !exists {
+			log.Printf("Сценарій %s для IP %s більше не існує, таймаут сповіщення не відновлено", record.Scenario, record.IP)
+			continue
+		}
+		deadline := time.Unix(record.NotifiedAt, 0).Add(time.Duration(scenario.Action.Notifier.Timeout) * time.Minute)
+		log.Printf("Відновлено таймаут сповіщення для IP %s (сценарій %s) до %s", record.IP, record.Scenario, deadline.Format("2006-01-02 15:04:05"))
+		m.startNotifierTimeout(record.Scenario, record.IP, record.MessageTS, time.Until(deadline))
+	}
+	return nil
+}
+
+// Помилка вибору дії для інциденту, який уже закрито або замінено новим
+var ErrStaleIncident = errors.New("інцидент уже неактуальний")
+
+// Помилка повторного вибору дії для інциденту, для якого рішення вже прийнято
+var ErrDecided = errors.New("рішення для інциденту вже прийнято")
+
+// Виконання конкретної дії сценарію для IP-адреси або рішення dismiss, snooze чи allowlist.
+// Якщо вказано incidentID, дія виконується лише для поточного інциденту і лише один раз: кнопки старих
+// повідомлень та повторно відкриті посилання не впливають на стан. Рішення зберігається разом із користувачем user
+func (m *Manager) ExecuteAction(scenarioName, action, ip, incidentID, user string) error {
+	unlock := m.locks.Lock(recordKey(scenarioName, ip))
+	defer unlock()
+	if incidentID != "" {
+		record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip)
+		if err != nil {
+			return err
+		}
+		if record.IncidentID != incidentID {
+			log.Printf("Дію %s для IP %s пропущено: інцидент %s неактуальний (поточний %q)", action, ip, incidentID, record.IncidentID)
+			return ErrStaleIncident
+		}
+		decision, err := m.db.GetDecisionByIncident(incidentID)
+		if err != nil {
+			return err
+		}
+		if decision != nil {
+			log.Printf("Дію %s для IP %s пропущено: для інциденту %s уже прийнято рішення %s (користувач %s)", action, ip, incidentID, decision.Action, decision.User)
+			return fmt.Errorf("%w: «%s», користувач %s", ErrDecided, m.ActionLabel(scenarioName, decision.Action), decision.User)
+		}
+	}
+	if isResolution(action) {
+		if err := m.resolve(scenarioName, action, ip, user); err != nil {
+			return err
+		}
+	} else if err := m.executeAction(scenarioName, action, ip); err != nil {
+		return err // Рішення не зберігається: дію можна обрати повторно
+	}
+	m.recordDecision(scenarioName, action, ip, incidentID, user)
+	return nil
+}
+
+// Виконання дії сценарію з уже захопленим блокуванням пари сценарій/IP.
+// Повертає помилку, якщо жоден діяч не виконався або стан запису не збережено;
+// пропуск дії для дозволеної, уже заблокованої чи покритої мережею адреси помилкою не є
+func (m *Manager) executeAction(scenarioName, action, ip string) error {
+	scenario, exists := m.cfg.Scenarios[scenarioName] // Отримуємо налаштування сценарію
+	if !exists {
+		return fmt.Errorf("сценарій %s не знайдено в конфігурації", scenarioName)
+	}
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip) // Отримуємо запис для IP
+	if err != nil {
+		return fmt.Errorf("Помилка при роботі з базою даних для IP %s: %v", ip, err)
+	}
+	key := recordKey(scenarioName, ip)
+
+	// Остання перевірка перед діячами: запис міг з'явитися після надсилання сповіщення
+	if m.suppressed(scenarioName, ip) || m.covered(scenarioName, ip) {
+		return nil
+	}
+
+	if record.BlockedAt > 0 && action != ActionAll {
+		log.Printf("IP %s уже заблоковано, пропускаємо дію %s", ip, action)
+		return nil
+	}
+
+	names := scenario.Action.Actioners
+	if action != ActionAll {
+		names = []string{action}
+	}
+	unlockScopes := m.lockScopes(ip, names) // Об'єкти блокування можуть бути спільними з іншими IP
+	defer unlockScopes()
+
+	var executed []string                                                        // Діячі, що були успішно виконані
+	incident := actioner.Incident{Scenario: scenarioName, ID: record.IncidentID} // Контекст для опису правил діячів
+	if action == ActionAll {
 		for _, actName := range scenario.Action.Actioners {
+			act, ok := m.actioners[actName]
+			if !ok {
+				log.Printf("Actioner %s не знайдено для IP %s", actName, ip)
+				continue
+			}
 			log.Printf("Виконання actioner %s для IP %s", actName, ip)
-			if err := m.actioners[actName].Execute(ip); err != nil { // Виконуємо кожен actioner
+			if err := runActioner(act, ip, incident); err != nil { // Виконуємо кожен actioner
 				log.Printf("Не вдалося виконати actioner %s для IP %s: %v", actName, ip, err)
+				m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("Actioner %s для IP %s: помилка: %v", actName, ip, err))
+				continue
 			}
+			m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("Actioner %s для IP %s: виконано", actName, ip))
+			executed = append(executed, actName)
 		}
-	} else if actioner, ok := m.actioners[action]; ok {
+	} else if actioner, ok := m.actioners[action]; ok && containsActioner(scenario.Action.Actioners, action) {
 		log.Printf("Виконання actioner %s для IP %s", action, ip)
-		if err := actioner.Execute(ip); err != nil { // Виконуємо конкретний actioner
+		if err := runActioner(actioner, ip, incident); err != nil { // Виконуємо конкретний actioner
 			log.Printf("Не вдалося виконати actioner %s для IP %s: %v", action, ip, err)
-			return
+			m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("Actioner %s для IP %s: помилка: %v", action, ip, err))
+			return fmt.Errorf("не вдалося виконати actioner %s: %v", action, err)
 		}
+		m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("Actioner %s для IP %s: виконано", action, ip))
+		executed = append(executed, action)
 	} else {
-		log.Printf("Unknown дія %s для IP %s", action, ip)
-		return
+		return fmt.Errorf("невідома дія %s у сценарії %s", action, scenarioName)
+	}
+	if len(executed) == 0 && len(scenario.Action.Actioners) > 0 {
+		return fmt.Errorf("жоден actioner сценарію %s не виконано для IP %s", scenarioName, ip)
 	}
 
-	record.ActionTaken = true // Позначаємо, що дія виконана
-	if action == "gcp_firewall" || action == "all" {
-		baseUnblockAfter := int64(scenario.Params.UnblockAfter * 60)          // Базовий час у секундах
-		multiplier := int64(record.BlockCount + 1)                            // Збільшуємо на основі кількості попередніх блокувань
-		record.BlockedAt = time.Now().Unix()                                  // Час блокування
-		record.UnblockAfter = time.Now().Unix() + baseUnblockAfter*multiplier // Час розблокування
-		record.BlockCount++                                                   // Збільшуємо лічильник блокувань
-		if cancelChan, ok := m.cancel[ip]; ok {
-			close(cancelChan) // Закриваємо канал таймауту
-			delete(m.cancel, ip)
+	// Блокування з таймером встановлюється, якщо хоча б одну з виконаних дій можна скасувати
+	blocked := m.hasReverter(executed)
+	record, err = m.db.UpdateRecord(scenarioName, ip, func(record *models.BlockRecord) error {
+		record.ActionTaken = true // Позначаємо, що дія виконана
+		record.NotifiedAt = 0     // Сповіщення більше не очікує на вибір дії
+		for _, actName := range executed {
+			if !containsActioner(record.Actioners, actName) {
+				record.Actioners = append(record.Actioners, actName) // Запам'ятовуємо діяча для подальшого скасування
+			}
+		}
+		if blocked {
+			baseUnblockAfter := int64(m.unblockMinutes(scenarioName, ip) * 60)    // Базовий час у секундах
+			multiplier := int64(record.BlockCount + 1)                            // Збільшуємо на основі кількості попередніх блокувань
+			record.BlockedAt = time.Now().Unix()                                  // Час блокування
+			record.UnblockAfter = time.Now().Unix() + baseUnblockAfter*multiplier // Час розблокування
+			record.BlockCount++                                                   // Збільшуємо лічильник блокувань
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+	}
+	if blocked {
+		if m.stopTimer(m.cancel, key) {
 			log.Printf("Скасовано таймаут сповіщення для IP %s через виконання дії", ip)
 		}
-		unblockCancelChan := make(chan struct{}) // Канал для скасування розблокування
-		m.unblockCancel[ip] = unblockCancelChan  // Зберігаємо канал у мапі
-		log.Printf("IP %s заблоковано, розблокування через %d секунд (BlockCount: %d)", ip, baseUnblockAfter*multiplier, record.BlockCount)
-		go m.scheduleUnblock(ip, record, unblockCancelChan) // Запускаємо горутину для розблокування
+		log.Printf("IP %s заблоковано, розблокування через %d секунд (BlockCount: %d)", ip, record.UnblockAfter-record.BlockedAt, record.BlockCount)
+		text := fmt.Sprintf("IP %s заблоковано, розблокування о %s", ip, time.Unix(record.UnblockAfter, 0).Format("2006-01-02 15:04:05"))
+		if record.BlockCount > 1 {
+			// Кожне повторне блокування триває довше: unblock_after множиться на номер блокування
+			text = fmt.Sprintf("IP %s заблоковано повторно (блокування №%d, тривалість x%d), розблокування о %s",
+				ip, record.BlockCount, record.BlockCount, time.Unix(record.UnblockAfter, 0).Format("2006-01-02 15:04:05"))
+		}
+		m.timeline(scenarioName, record.MessageTS, text)
+		m.startUnblockTimer(scenarioName, ip, record.UnblockAfter) // Запускаємо таймер розблокування
+		go m.aggregate(scenarioName, ip, record.MessageTS)         // Перевіряємо, чи не час блокувати всю мережу
+	}
+	return nil
+}
+
+// Виконання діяча з контекстом інциденту, якщо діяч його приймає
+func runActioner(act actioner.Actioner, ip string, incident actioner.Incident) error {
+	if e, ok := act.(actioner.IncidentExecutor); ok {
+		return e.ExecuteIncident(ip, incident)
 	}
-	if err := m.db.UpdateBlockRecord(record); err != nil {
-		log.Printf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+	return act.Execute(ip)
+}
+
+// Перевірка, чи реалізує хоча б один із діячів інтерфейс Reverter
+func (m *Manager) hasReverter(names []string) bool {
+	for _, name := range names {
+		if _, ok := m.actioners[name].(actioner.Reverter); ok {
+			return true
+		}
 	}
+	return false
 }
 
-func (m *Manager) scheduleUnblock(ip string, record *models.BlockRecord, cancelChan chan struct{}) {
-	select {
-	case <-time.After(time.Until(time.Unix(record.UnblockAfter, 0))): // Чекаємо до часу розблокування
-		log.Printf("Розблокування IP %s", ip)
-		if firewall, ok := m.actioners["gcp_firewall"].(*actioner.GCPFirewall); ok {
-			if err := firewall.Unblock(ip); err != nil { // Виконуємо розблокування через GCP Firewall
-				log.Printf("Не вдалося розблокувати IP %s: %v", ip, err)
-			}
+// Скасування дій усіх діячів, що виконувалися для запису, у зворотному порядку.
+// Дія не скасовується, якщо її об'єкт блокування спільний із іншим заблокованим записом.
+// Повертає діячів, дію яких не вдалося скасувати
+func (m *Manager) revertActions(scenarioName, ip string, actioners []string) ([]string, error) {
+	var errs []error
+	var failed []string // Діячі, дію яких не вдалося скасувати
+	for i := len(actioners) - 1; i >= 0; i-- {
+		name := actioners[i]
+		reverter, ok := m.actioners[name].(actioner.Reverter)
+		if !ok {
+			continue // Дію цього діяча скасувати неможливо
+		}
+		if holder, shared := m.sharedScope(scenarioName, ip, name); shared {
+			log.Printf("Дію actioner %s для IP %s не скасовано: той самий об'єкт блокування використовує %s", name, ip, holder)
+			continue
 		}
-		record.BlockedAt = 0       // Скидаємо час блокування
-		record.TriggerCount = 0    // Скидаємо лічильник подій
-		record.ActionTaken = false // Позначаємо, що дія завершена
-		if err := m.db.UpdateBlockRecord(record); err != nil {
-			log.Printf("Не вдалося оновити запис блокування для IP %s після розблокування: %v", ip, err)
+		log.Printf("Скасування дії actioner %s для IP %s", name, ip)
+		if err := reverter.Revert(ip); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			failed = append([]string{name}, failed...)
 		}
+	}
+	return failed, errors.Join(errs...)
+}
+
+// Перевірка, чи входить actioner до списку дій сценарію
+func containsActioner(actioners []string, name string) bool {
+	for _, a := range actioners {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Збереження каналу скасування таймера; попередній таймер для ключа зупиняється
+func (m *Manager) setTimer(timers map[string]chan struct{}, key string, ch chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := timers[key]; ok {
+		close(old)
+	}
+	timers[key] = ch
+}
+
+// Зупинка таймера для ключа; повертає true, якщо таймер існував
+func (m *Manager) stopTimer(timers map[string]chan struct{}, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch, ok := timers[key]
+	if ok {
+		close(ch)
+		delete(timers, key)
+	}
+	return ok
+}
+
+// Видалення завершеного таймера, якщо його ще не замінено новим
+func (m *Manager) clearTimer(timers map[string]chan struct{}, key string, ch chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timers[key] == ch {
+		delete(timers, key)
+	}
+}
+
+// Запуск горутини, що розблокує IP у вказаний час
+func (m *Manager) startUnblockTimer(scenarioName, ip string, unblockAfter int64) {
+	unblockCancelChan := make(chan struct{}) // Канал для скасування розблокування
+	m.setTimer(m.unblockCancel, recordKey(scenarioName, ip), unblockCancelChan)
+	go m.scheduleUnblock(scenarioName, ip, unblockAfter, unblockCancelChan) // Запускаємо горутину для розблокування
+}
+
+func (m *Manager) scheduleUnblock(scenarioName, ip string, unblockAfter int64, cancelChan chan struct{}) {
+	key := recordKey(scenarioName, ip)
+	defer m.clearTimer(m.unblockCancel, key, cancelChan) // Видаляємо канал із мапи після завершення
+
+	select {
+	case <-time.After(time.Until(time.Unix(unblockAfter, 0))): // Чекаємо до часу розблокування
+	case <-cancelChan:
+		log.Printf("Таймер розблокування скасовано для IP %s", ip)
+		return
+	}
+
+	unlock := m.locks.Lock(key)
+	defer unlock()
+	// Таймер міг бути скасований, поки очікувалося блокування
+	select {
 	case <-cancelChan:
 		log.Printf("Таймер розблокування скасовано для IP %s", ip)
+		return
+	default:
+	}
+
+	log.Printf("Розблокування IP %s", ip)
+	if err := m.unblock(scenarioName, ip, true); err != nil {
+		log.Printf("Не вдалося розблокувати IP %s: %v", ip, err)
+	}
+}
+
+// Скасування дій діячів та скидання стану блокування (з захопленим блокуванням пари сценарій/IP).
+// Якщо force = false, при помилці скасування запис залишається заблокованим
+func (m *Manager) unblock(scenarioName, ip string, force bool) error {
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip) // Отримуємо актуальний запис
+	if err != nil {
+		return fmt.Errorf("Не вдалося отримати запис блокування для IP %s: %v", ip, err)
+	}
+	unlockScopes := m.lockScopes(ip, record.Actioners) // Скасування та оновлення запису під блокуванням об'єктів
+	defer unlockScopes()
+	failed, revertErr := m.revertActions(scenarioName, ip, record.Actioners) // Скасовуємо дії всіх діячів, що виконувалися
+
+	_, err = m.db.UpdateRecord(scenarioName, ip, func(record *models.BlockRecord) error {
+		record.Actioners = failed // Залишаємо лише діячів, скасування яких потрібно повторити
+		if revertErr != nil && !force {
+			return nil
+		}
+		record.BlockedAt = 0               // Скидаємо час блокування
+		record.TriggerCount = 0            // Скидаємо лічильник подій
+		record.ResetAt = time.Now().Unix() // Події до розблокування більше не враховуються
+		record.ActionTaken = false         // Позначаємо, що дія завершена
+		record.IncidentID = ""             // Інцидент закрито, кнопки його повідомлення більше не діють
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+	}
+	if revertErr != nil {
+		m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("Не вдалося скасувати дії %s для IP %s: %v", strings.Join(failed, ", "), ip, revertErr))
+	}
+	if revertErr == nil || force {
+		m.timeline(scenarioName, record.MessageTS, fmt.Sprintf("IP %s розблоковано", ip))
 	}
-	delete(m.unblockCancel, ip) // Видаляємо канал із мапи після завершення
+	return revertErr
 }
 
 // Ручне розблокування через веб-сторінку
-func (m *Manager) ManualUnblock(ip string) error {
-	record, err := m.db.GetOrCreateBlockRecord(ip) // Отримуємо запис для IP
+func (m *Manager) ManualUnblock(scenarioName, ip string) error {
+	key := recordKey(scenarioName, ip)
+	unlock := m.locks.Lock(key)
+	defer unlock()
+
+	record, err := m.db.GetOrCreateBlockRecord(scenarioName, ip) // Отримуємо запис для сценарію та IP
 	if err != nil {
 		return fmt.Errorf("Не вдалося отримати запис блокування для IP %s: %v", ip, err)
 	}
 
 	if record.BlockedAt == 0 {
-		log.Printf("IP %s не заблоковано, дії не потрібні", ip)
+		log.Printf("IP %s не заблоковано в сценарії %s, дії не потрібні", ip, scenarioName)
 		return nil
 	}
 
 	// Скасовуємо таймер notifier, якщо він є
-	if cancelChan, ok := m.cancel[ip]; ok {
-		close(cancelChan)
-		delete(m.cancel, ip)
+	if m.stopTimer(m.cancel, key) {
 		log.Printf("Скасовано таймаут сповіщення для IP %s через ручне розблокування", ip)
 	}
 
 	// Скасовуємо таймер розблокування, якщо він є
-	if unblockCancelChan, ok := m.unblockCancel[ip]; ok {
-		close(unblockCancelChan)
-		delete(m.unblockCancel, ip)
+	if m.stopTimer(m.unblockCancel, key) {
 		log.Printf("Скасовано таймер розблокування для IP %s через ручне розблокування", ip)
 	}
 
-	// Виконуємо розблокування
-	if firewall, ok := m.actioners["gcp_firewall"].(*actioner.GCPFirewall); ok {
-		if err := firewall.Unblock(ip); err != nil {
-			return fmt.Errorf("Не вдалося розблокувати IP %s: %v", ip, err)
-		}
-	}
-
-	record.BlockedAt = 0       // Скидаємо час блокування
-	record.TriggerCount = 0    // Скидаємо лічильник подій
-	record.ActionTaken = false // Позначаємо, що дія завершена
-	if err := m.db.UpdateBlockRecord(record); err != nil {
-		return fmt.Errorf("Не вдалося оновити запис блокування для IP %s: %v", ip, err)
+	// Виконуємо розблокування, скасовуючи дії всіх діячів
+	if err := m.unblock(scenarioName, ip, false); err != nil {
+		m.startUnblockTimer(scenarioName, ip, record.UnblockAfter) // Запис залишився заблокованим
+		return fmt.Errorf("Не вдалося розблокувати IP %s: %v", ip, err)
 	}
 
-	log.Printf("Успішно розблоковано IP %s вручну", ip)
+	log.Printf("Успішно розблоковано IP %s вручну (сценарій %s)", ip, scenarioName)
 	return nil
 }
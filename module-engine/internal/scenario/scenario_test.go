@@ -0,0 +1,263 @@
+package scenario
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard) // Журнал менеджера занадто детальний для тестів
+	os.Exit(m.Run())
+}
+
+// Діяч, що рахує виконання та скасування для кожного суб'єкта
+type fakeActioner struct {
+	name      string
+	delay     time.Duration // Затримка виконання, що розширює вікно для гонок
+	mu        sync.Mutex
+	executed  map[string]int
+	reverted  map[string]int
+	execErr   error // Помилка, якою завершується виконання
+	revertErr error // Помилка, якою завершується скасування
+}
+
+func newFakeActioner(name string) *fakeActioner {
+	return &fakeActioner{name: name, executed: map[string]int{}, reverted: map[string]int{}}
+}
+
+func (f *fakeActioner) Name() string { return f.name }
+
+func (f *fakeActioner) Execute(ip string) error {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.execErr != nil {
+		return f.execErr
+	}
+	f.executed[ip]++
+	return nil
+}
+
+func (f *fakeActioner) Revert(ip string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.revertErr != nil {
+		return f.revertErr
+	}
+	f.reverted[ip]++
+	return nil
+}
+
+// Налаштування помилок виконання та скасування
+func (f *fakeActioner) fail(execErr, revertErr error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.execErr, f.revertErr = execErr, revertErr
+}
+
+// Кількість виконань для суб'єкта
+func (f *fakeActioner) executions(ip string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.executed[ip]
+}
+
+// Кількість скасувань для суб'єкта
+func (f *fakeActioner) reverts(ip string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reverted[ip]
+}
+
+// Менеджер з тимчасовою базою SQLite та заданими сценаріями і діячами
+func newTestManager(t *testing.T, cfg *config.Config, actioners ...actioner.Actioner) (*Manager, *db.SQLiteDB) {
+	t.Helper()
+	store, err := db.NewSQLiteDB(filepath.Join(t.TempDir(), "blocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := allowlist.New(cfg.Allowlist, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acts := map[string]actioner.Actioner{}
+	for _, a := range actioners {
+		acts[a.Name()] = a
+	}
+	return NewManager(cfg, acts, store, map[string]notifier.Notifier{}, allow), store
+}
+
+// Сценарій без сповіщень, що блокує суб'єкт діячами після trigger подій за хвилину
+func blockScenario(rule string, trigger int, actioners ...string) config.Scenario {
+	return config.Scenario{
+		Rule:   rule,
+		Params: config.ScenarioParams{TriggerCount: trigger, TriggerWindow: 60, UnblockAfter: 10},
+		Action: config.ScenarioAction{Actioners: actioners},
+	}
+}
+
+// Запис блокування без створення нового
+func findRecord(t *testing.T, store *db.SQLiteDB, scenarioName, ip string) models.BlockRecord {
+	t.Helper()
+	records, err := store.GetRecordsByIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.Scenario == scenarioName {
+			return r
+		}
+	}
+	t.Fatalf("no record for %s in scenario %s", ip, scenarioName)
+	return models.BlockRecord{}
+}
+
+// Паралельна обробка тисяч подій для одного та для різних суб'єктів: кожен суб'єкт
+// блокується рівно один раз, а лічильники відповідають кількості подій (запускати з -race)
+func TestDispatchConcurrentEvents(t *testing.T) {
+	const (
+		rule      = "Detect Failed SSH Login Attempts"
+		hot       = "203.0.113.7" // Суб'єкт, для якого події надходять одночасно
+		hotEvents = 1000
+		subjects  = 20 // Різні суб'єкти
+		perIP     = 100
+	)
+	fw := newFakeActioner("fake_firewall")
+	fw.delay = time.Millisecond
+	logs := newFakeActioner("fake_logs")
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{
+		"ssh":       blockScenario(rule, 3, "fake_firewall"),
+		"ssh_audit": blockScenario(rule, 5, "fake_logs"), // Друга гілка для тієї ж події
+	}}
+	m, store := newTestManager(t, cfg, fw, logs)
+
+	ips := []string{}
+	for i := 0; i < subjects; i++ {
+		ips = append(ips, fmt.Sprintf("198.51.100.%d", i+1))
+	}
+	var wg sync.WaitGroup
+	send := func(ip string, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if matched := m.Dispatch(models.Event{IP: ip, Rule: rule}); matched != 2 {
+					t.Errorf("Dispatch matched %d scenarios, want 2", matched)
+				}
+			}()
+		}
+	}
+	send(hot, hotEvents)
+	for _, ip := range ips {
+		send(ip, perIP)
+	}
+	wg.Wait()
+
+	check := func(ip string, events int) {
+		t.Helper()
+		if n := fw.executions(ip); n != 1 {
+			t.Errorf("%s: fake_firewall executed %d times, want 1", ip, n)
+		}
+		if n := logs.executions(ip); n != 1 {
+			t.Errorf("%s: fake_logs executed %d times, want 1", ip, n)
+		}
+		for _, name := range []string{"ssh", "ssh_audit"} {
+			r := findRecord(t, store, name, ip)
+			if r.TriggerCount != events {
+				t.Errorf("%s/%s: TriggerCount = %d, want %d", name, ip, r.TriggerCount, events)
+			}
+			if r.BlockCount != 1 || r.BlockedAt == 0 {
+				t.Errorf("%s/%s: BlockCount = %d, BlockedAt = %d, want one active block", name, ip, r.BlockCount, r.BlockedAt)
+			}
+		}
+		stored, err := store.GetEventsByIP(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2*events {
+			t.Errorf("%s: %d stored events, want %d", ip, len(stored), 2*events)
+		}
+	}
+	check(hot, hotEvents)
+	for _, ip := range ips {
+		check(ip, perIP)
+	}
+}
+
+// Ручне розблокування під час потоку подій: повторне блокування збільшує BlockCount
+func TestManualUnblockDuringEvents(t *testing.T) {
+	const rule = "Detect Failed SSH Login Attempts"
+	fw := newFakeActioner("fake_firewall")
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{"ssh": blockScenario(rule, 1, "fake_firewall")}}
+	m, store := newTestManager(t, cfg, fw)
+	ip := "203.0.113.9"
+
+	m.Dispatch(models.Event{IP: ip, Rule: rule})
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Dispatch(models.Event{IP: ip, Rule: rule})
+		}()
+	}
+	if err := m.ManualUnblock("ssh", ip); err != nil {
+		t.Fatalf("ManualUnblock: %v", err)
+	}
+	wg.Wait()
+
+	if n := fw.reverts(ip); n != 1 {
+		t.Errorf("reverted %d times, want 1", n)
+	}
+	r := findRecord(t, store, "ssh", ip)
+	// Після розблокування подія знову блокує IP, якщо вона надійшла після нього
+	if fw.executions(ip) != r.BlockCount {
+		t.Errorf("executions %d != BlockCount %d", fw.executions(ip), r.BlockCount)
+	}
+	if r.BlockCount > 2 {
+		t.Errorf("BlockCount = %d, want at most 2", r.BlockCount)
+	}
+}
+
+// Невдале ручне розблокування залишає запис заблокованим із таймером розблокування
+func TestManualUnblockRevertFailure(t *testing.T) {
+	const rule = "Detect Failed SSH Login Attempts"
+	fw := newFakeActioner("fake_firewall")
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{"ssh": blockScenario(rule, 1, "fake_firewall")}}
+	m, store := newTestManager(t, cfg, fw)
+	ip := "203.0.113.12"
+	m.Dispatch(models.Event{IP: ip, Rule: rule})
+	blocked := findRecord(t, store, "ssh", ip)
+
+	fw.fail(nil, fmt.Errorf("rule is locked"))
+	if err := m.ManualUnblock("ssh", ip); err == nil {
+		t.Fatal("ManualUnblock succeeded although the revert failed")
+	}
+	if r := findRecord(t, store, "ssh", ip); r.BlockedAt == 0 || r.UnblockAfter != blocked.UnblockAfter {
+		t.Errorf("record after a failed unblock = %+v, was %+v", r, blocked)
+	}
+	if !hasUnblockTimer(m, "ssh", ip) {
+		t.Error("unblock timer not restarted")
+	}
+
+	fw.fail(nil, nil)
+	if err := m.ManualUnblock("ssh", ip); err != nil {
+		t.Fatal(err)
+	}
+	if r := findRecord(t, store, "ssh", ip); r.BlockedAt != 0 || hasUnblockTimer(m, "ssh", ip) {
+		t.Errorf("record after unblock = %+v, timer %v", r, hasUnblockTimer(m, "ssh", ip))
+	}
+}
@@ -0,0 +1,62 @@
+package scenario
+
+import (
+	"log"
+	"sort"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+)
+
+// Ключ об'єкта блокування діяча (правила, елемента набору, політики) для IP
+func (m *Manager) scopeKey(name, ip string) string {
+	act, ok := m.actioners[name]
+	if !ok {
+		return name + "|" + ip
+	}
+	return name + "|" + actioner.BlockScope(act, ip)
+}
+
+// Захоплення блокувань об'єктів діячів names для IP. Виконання дій і скасування разом зі збереженням
+// запису виконуються під цими блокуваннями, тому перевірка спільних об'єктів у sharedScope бачить
+// актуальний стан інших записів. Ключі захоплюються в сортованому порядку, щоб уникнути взаємоблокувань
+func (m *Manager) lockScopes(ip string, names []string) func() {
+	keys := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := m.scopeKey(name, ip)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	unlocks := make([]func(), 0, len(keys))
+	for _, key := range keys {
+		unlocks = append(unlocks, m.scopes.Lock(key))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// Пошук іншого заблокованого запису (будь-якого сценарію), для якого діяч name виконав дію
+// з тим самим об'єктом блокування, що й для IP. Скасування для IP зняло б і його блокування
+func (m *Manager) sharedScope(scenarioName, ip, name string) (string, bool) {
+	records, err := m.db.GetActiveBlocks()
+	if err != nil {
+		log.Printf("Не вдалося перевірити спільні блокування для IP %s: %v", ip, err)
+		return "", false
+	}
+	key := m.scopeKey(name, ip)
+	for _, r := range records {
+		if r.Scenario == scenarioName && r.IP == ip {
+			continue
+		}
+		if containsActioner(r.Actioners, name) && m.scopeKey(name, r.IP) == key {
+			return r.IP + " (сценарій " + r.Scenario + ")", true
+		}
+	}
+	return "", false
+}
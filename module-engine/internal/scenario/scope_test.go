@@ -0,0 +1,169 @@
+package scenario
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Брандмауер, що блокує мережу /24 адреси одним елементом (як prefix_v4: 24)
+type prefixFirewall struct {
+	mu       sync.Mutex
+	present  map[string]bool // Встановлені елементи
+	executed int
+	reverted int
+}
+
+func newPrefixFirewall() *prefixFirewall {
+	return &prefixFirewall{present: map[string]bool{}}
+}
+
+func (p *prefixFirewall) Name() string { return "prefix_firewall" }
+
+func (p *prefixFirewall) BlockScope(ip string) string {
+	return netip.PrefixFrom(netip.MustParseAddr(ip), 24).Masked().String()
+}
+
+func (p *prefixFirewall) Execute(ip string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.executed++
+	p.present[p.BlockScope(ip)] = true
+	return nil
+}
+
+func (p *prefixFirewall) Revert(ip string) error {
+	time.Sleep(time.Millisecond) // Вікно, у якому інша адреса мережі може заблокуватися
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reverted++
+	delete(p.present, p.BlockScope(ip))
+	return nil
+}
+
+// Чи встановлено елемент, що блокує IP
+func (p *prefixFirewall) blocks(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.present[p.BlockScope(ip)]
+}
+
+// Заблоковані записи, для яких елемент брандмауера відсутній
+func unprotected(t *testing.T, m *Manager, fw *prefixFirewall) []string {
+	t.Helper()
+	records, err := m.db.GetActiveBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var missing []string
+	for _, r := range records {
+		if !fw.blocks(r.IP) {
+			missing = append(missing, r.Scenario+"/"+r.IP)
+		}
+	}
+	return missing
+}
+
+const scopeRule = "Detect Failed SSH Login Attempts"
+
+func TestRevertKeepsSharedPrefix(t *testing.T) {
+	fw := newPrefixFirewall()
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{"ssh": blockScenario(scopeRule, 1, "prefix_firewall")}}
+	m, store := newTestManager(t, cfg, fw)
+
+	m.Dispatch(models.Event{IP: "203.0.113.7", Rule: scopeRule})
+	m.Dispatch(models.Event{IP: "203.0.113.8", Rule: scopeRule})
+	m.Dispatch(models.Event{IP: "198.51.100.1", Rule: scopeRule})
+
+	// Розблокування першої адреси не знімає блокування мережі, поки заблоковано другу
+	if err := m.ManualUnblock("ssh", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if fw.reverted != 0 || !fw.blocks("203.0.113.8") {
+		t.Fatalf("shared element reverted: reverted=%d present=%v", fw.reverted, fw.present)
+	}
+	if r := findRecord(t, store, "ssh", "203.0.113.7"); r.BlockedAt != 0 || len(r.Actioners) != 0 {
+		t.Errorf("unblocked record = %+v", r)
+	}
+	if r := findRecord(t, store, "ssh", "203.0.113.8"); r.BlockedAt == 0 {
+		t.Error("second record lost its block")
+	}
+
+	// Остання адреса мережі знімає елемент
+	if err := m.ManualUnblock("ssh", "203.0.113.8"); err != nil {
+		t.Fatal(err)
+	}
+	if fw.reverted != 1 || fw.blocks("203.0.113.8") {
+		t.Errorf("element not reverted after last unblock: reverted=%d", fw.reverted)
+	}
+	if !fw.blocks("198.51.100.1") {
+		t.Error("unrelated network unblocked")
+	}
+}
+
+// Той самий IP у двох сценаріях з одним діячем блокується одним елементом
+func TestRevertKeepsBlockOfOtherScenario(t *testing.T) {
+	fw := newPrefixFirewall()
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{
+		"ssh":     blockScenario(scopeRule, 1, "prefix_firewall"),
+		"ssh_bad": blockScenario(scopeRule, 1, "prefix_firewall"),
+	}}
+	m, _ := newTestManager(t, cfg, fw)
+	m.Dispatch(models.Event{IP: "203.0.113.7", Rule: scopeRule})
+
+	if err := m.ManualUnblock("ssh", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if fw.reverted != 0 {
+		t.Error("block of the other scenario reverted")
+	}
+	if err := m.ManualUnblock("ssh_bad", "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if fw.reverted != 1 {
+		t.Errorf("reverted %d times, want 1", fw.reverted)
+	}
+}
+
+// Одночасні розблокування та нові блокування адрес однієї мережі: кожен заблокований запис
+// залишається захищеним елементом брандмауера, а після розблокування всіх елемент знято
+func TestConcurrentSharedPrefix(t *testing.T) {
+	fw := newPrefixFirewall()
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{"ssh": blockScenario(scopeRule, 1, "prefix_firewall")}}
+	m, _ := newTestManager(t, cfg, fw)
+
+	for round := 0; round < 20; round++ {
+		var wg sync.WaitGroup
+		for i := 1; i <= 10; i++ {
+			ip := fmt.Sprintf("203.0.113.%d", i)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				m.Dispatch(models.Event{IP: ip, Rule: scopeRule})
+			}()
+			go func() {
+				defer wg.Done()
+				if err := m.ManualUnblock("ssh", ip); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if missing := unprotected(t, m, fw); len(missing) > 0 {
+			t.Fatalf("round %d: blocked records without firewall element: %v", round, missing)
+		}
+		for i := 1; i <= 10; i++ {
+			if err := m.ManualUnblock("ssh", fmt.Sprintf("203.0.113.%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if fw.blocks("203.0.113.1") {
+			t.Fatalf("round %d: element left after all addresses were unblocked", round)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Режими автентифікації запитів з подіями
+const (
+	authNone   = "none"   // Без автентифікації
+	authBearer = "bearer" // Спільний токен у заголовку Authorization
+	authHMAC   = "hmac"   // Підпис тіла запиту HMAC-SHA256
+	authMTLS   = "mtls"   // Клієнтський сертифікат, підписаний довіреним CA
+)
+
+// Заголовки підпису HMAC за замовчуванням
+const (
+	defaultSignatureHeader = "X-Signature" // Підпис
+	defaultTimestampHeader = "X-Timestamp" // Час підпису (секунди Unix)
+)
+
+// Максимальна різниця між часом підпису та поточним часом (захист від повторного надсилання)
+const hmacReplayWindow = 5 * time.Minute
+
+// Кількість відхилених запитів за псевдонімом та режимом (/debug/vars на дашборді)
+var rejectedRequests = expvar.NewMap("ingest_rejected_requests")
+
+// Перевірка автентифікації запитів до одного псевдоніма
+type authenticator struct {
+	alias string           // Назва псевдоніма
+	auth  config.AliasAuth // Налаштування автентифікації
+	now   func() time.Time // Поточний час для перевірки часу підпису
+}
+
+// Створення перевірки з валідацією налаштувань псевдоніма
+func newAuthenticator(alias string, auth config.AliasAuth, mtlsEnabled bool) (*authenticator, error) {
+	switch auth.Mode {
+	case "", authNone:
+		auth.Mode = authNone
+	case authBearer:
+		if auth.Token == "" {
+			return nil, errors.New("для режиму bearer потрібно вказати token")
+		}
+	case authHMAC:
+		if auth.Secret == "" {
+			return nil, errors.New("для режиму hmac потрібно вказати secret")
+		}
+		if auth.Header == "" {
+			auth.Header = defaultSignatureHeader
+		}
+		if auth.TimestampHeader == "" {
+			auth.TimestampHeader = defaultTimestampHeader
+		}
+	case authMTLS:
+		if !mtlsEnabled {
+			return nil, errors.New("для режиму mtls потрібно налаштувати server.tls з client_ca_file")
+		}
+	default:
+		return nil, fmt.Errorf("невідомий режим автентифікації %q", auth.Mode)
+	}
+	return &authenticator{alias: alias, auth: auth, now: time.Now}, nil
+}
+
+// Обгортка обробника перевіркою автентифікації; відхилені запити рахуються та журналюються
+func (a *authenticator) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if a.auth.Mode == authNone {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := a.check(r); err != nil {
+			rejectedRequests.Add(a.alias+"/"+a.auth.Mode, 1)
+			log.Printf("Відхилено запит до аліасу %s від %s (%s): %v", a.alias, r.RemoteAddr, a.auth.Mode, err)
+			if a.auth.Mode == authBearer {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			http.Error(w, "Неавторизований запит", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Перевірка запиту відповідно до режиму автентифікації
+func (a *authenticator) check(r *http.Request) error {
+	switch a.auth.Mode {
+	case authBearer:
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return errors.New("відсутній токен")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.auth.Token)) != 1 {
+			return errors.New("невірний токен")
+		}
+	case authHMAC:
+		return a.checkSignature(r)
+	case authMTLS:
+		return a.checkCertificate(r)
+	}
+	return nil
+}
+
+// Перевірка підпису HMAC-SHA256 рядка <timestamp>.<тіло запиту>; тіло відновлюється для подальшої обробки.
+// Підпис передається у hex, з префіксом sha256= або без нього, а час підпису - у заголовку timestamp_header.
+// Запити з часом поза вікном відхиляються, тому перехоплений запит не можна надіслати повторно пізніше
+func (a *authenticator) checkSignature(r *http.Request) error {
+	header := r.Header.Get(a.auth.Header)
+	if header == "" {
+		return errors.New("відсутній підпис")
+	}
+	timestamp := r.Header.Get(a.auth.TimestampHeader)
+	if timestamp == "" {
+		return errors.New("відсутній час підпису")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("невірний час підпису %q", timestamp)
+	}
+	age := a.now().Sub(time.Unix(ts, 0))
+	if age > hmacReplayWindow || age < -hmacReplayWindow {
+		return fmt.Errorf("час підпису %s поза вікном %s", time.Unix(ts, 0).UTC().Format(time.RFC3339), hmacReplayWindow)
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return errors.New("невірний формат підпису")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEventBody+1))
+	if err != nil {
+		return fmt.Errorf("не вдалося прочитати тіло: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !hmac.Equal(signature, signBody(a.auth.Secret, timestamp, body)) {
+		return errors.New("невірний підпис")
+	}
+	return nil
+}
+
+// Підпис HMAC-SHA256 рядка <timestamp>.<тіло запиту>
+func signBody(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Перевірка клієнтського сертифіката: ланцюжок має бути перевірений TLS-сервером,
+// а за наявності списку client_names - CN або DNS-ім'я сертифіката має бути в ньому
+func (a *authenticator) checkCertificate(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return errors.New("відсутній перевірений клієнтський сертифікат")
+	}
+	if len(a.auth.ClientNames) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, name := range names {
+		for _, allowed := range a.auth.ClientNames {
+			if name == allowed {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("сертифікат %q не входить до дозволених клієнтів", cert.Subject.CommonName)
+}
+
+// Налаштування TLS основного сервера. Клієнтські сертифікати перевіряються, якщо їх надано:
+// псевдоніми без mtls (та зворотний виклик Slack) працюють і без сертифіката
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("файл %s не містить сертифікатів CA", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Фіксований час перевірки підписів
+var authNow = time.Unix(1700000000, 0)
+
+// Запит з підписом HMAC тіла та часу
+func signedRequest(secret, body string, at time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/monitoring", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set("X-Timestamp", timestamp)
+	r.Header.Set("X-Signature", "sha256="+hex.EncodeToString(signBody(secret, timestamp, []byte(body))))
+	return r
+}
+
+// Запит з перевіреним клієнтським сертифікатом
+func certRequest(cn string, dnsNames ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+// Значення лічильника відхилених запитів
+func rejectedCount(key string) int64 {
+	if v, ok := rejectedRequests.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestAuthenticatorWrap(t *testing.T) {
+	const secret = "change-me"
+	const body = `{"rule":"Hubble flow"}`
+	tests := []struct {
+		name    string
+		auth    config.AliasAuth
+		request func() *http.Request
+		wantOK  bool
+	}{
+		{"none", config.AliasAuth{}, func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+		}, true},
+
+		{"bearer valid", config.AliasAuth{Mode: "bearer", Token: "t0ken"}, func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+			r.Header.Set("Authorization", "Bearer t0ken")
+			return r
+		}, true},
+		{"bearer bad token", config.AliasAuth{Mode: "bearer", Token: "t0ken"}, func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+			r.Header.Set("Authorization", "Bearer guess")
+			return r
+		}, false},
+		{"bearer missing header", config.AliasAuth{Mode: "bearer", Token: "t0ken"}, func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+		}, false},
+		{"bearer wrong scheme", config.AliasAuth{Mode: "bearer", Token: "t0ken"}, func() *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+			r.Header.Set("Authorization", "Basic t0ken")
+			return r
+		}, false},
+
+		{"hmac valid", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			return signedRequest(secret, body, authNow.Add(-time.Minute))
+		}, true},
+		{"hmac valid without prefix", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Header.Set("X-Signature", strings.TrimPrefix(r.Header.Get("X-Signature"), "sha256="))
+			return r
+		}, true},
+		{"hmac custom headers", config.AliasAuth{Mode: "hmac", Secret: secret, Header: "X-Hub-Signature", TimestampHeader: "X-Hub-Time"}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Header.Set("X-Hub-Signature", r.Header.Get("X-Signature"))
+			r.Header.Set("X-Hub-Time", r.Header.Get("X-Timestamp"))
+			return r
+		}, true},
+		{"hmac bad signature", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			return signedRequest("other-secret", body, authNow)
+		}, false},
+		{"hmac tampered body", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Body = io.NopCloser(strings.NewReader(`{"rule":"other"}`))
+			return r
+		}, false},
+		{"hmac timestamp changed", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow.Add(-time.Hour))
+			r.Header.Set("X-Timestamp", strconv.FormatInt(authNow.Unix(), 10)) // Оновлений час без нового підпису
+			return r
+		}, false},
+		{"hmac replayed after window", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			return signedRequest(secret, body, authNow.Add(-6*time.Minute))
+		}, false},
+		{"hmac timestamp in future", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			return signedRequest(secret, body, authNow.Add(6*time.Minute))
+		}, false},
+		{"hmac missing signature", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Header.Del("X-Signature")
+			return r
+		}, false},
+		{"hmac missing timestamp", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Header.Del("X-Timestamp")
+			return r
+		}, false},
+		{"hmac malformed signature", config.AliasAuth{Mode: "hmac", Secret: secret}, func() *http.Request {
+			r := signedRequest(secret, body, authNow)
+			r.Header.Set("X-Signature", "sha256=zz")
+			return r
+		}, false},
+
+		{"mtls any verified client", config.AliasAuth{Mode: "mtls"}, func() *http.Request {
+			return certRequest("falco-sidekick")
+		}, true},
+		{"mtls allowed CN", config.AliasAuth{Mode: "mtls", ClientNames: []string{"falco-sidekick"}}, func() *http.Request {
+			return certRequest("falco-sidekick")
+		}, true},
+		{"mtls allowed DNS name", config.AliasAuth{Mode: "mtls", ClientNames: []string{"falco.example.com"}}, func() *http.Request {
+			return certRequest("node-1", "falco.example.com")
+		}, true},
+		{"mtls wrong CN", config.AliasAuth{Mode: "mtls", ClientNames: []string{"falco-sidekick"}}, func() *http.Request {
+			return certRequest("attacker")
+		}, false},
+		{"mtls missing certificate", config.AliasAuth{Mode: "mtls"}, func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("{}"))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alias := "alias-" + strings.ReplaceAll(tt.name, " ", "-")
+			a, err := newAuthenticator(alias, tt.auth, true)
+			if err != nil {
+				t.Fatalf("newAuthenticator: %v", err)
+			}
+			a.now = func() time.Time { return authNow }
+
+			var gotBody string
+			called := false
+			handler := a.wrap(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				data, _ := io.ReadAll(r.Body)
+				gotBody = string(data)
+			})
+			req := tt.request()
+			want, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(strings.NewReader(string(want)))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			key := alias + "/" + a.auth.Mode
+			if tt.wantOK {
+				if !called || rec.Code != http.StatusOK {
+					t.Fatalf("request rejected: %d %s", rec.Code, rec.Body.String())
+				}
+				// Обробник отримує тіло, прочитане під час перевірки підпису
+				if gotBody != string(want) {
+					t.Errorf("handler body = %q, want %q", gotBody, want)
+				}
+				if n := rejectedCount(key); n != 0 {
+					t.Errorf("rejected counter = %d, want 0", n)
+				}
+				return
+			}
+			if called || rec.Code != http.StatusUnauthorized {
+				t.Fatalf("request accepted: %d", rec.Code)
+			}
+			if n := rejectedCount(key); n != 1 {
+				t.Errorf("rejected counter %s = %d, want 1", key, n)
+			}
+			if tt.auth.Mode == "bearer" && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		auth config.AliasAuth
+		mtls bool
+	}{
+		{"bearer without token", config.AliasAuth{Mode: "bearer"}, false},
+		{"hmac without secret", config.AliasAuth{Mode: "hmac"}, false},
+		{"mtls without client CA", config.AliasAuth{Mode: "mtls"}, false},
+		{"unknown mode", config.AliasAuth{Mode: "basic"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newAuthenticator("falco", tt.auth, tt.mtls); err == nil {
+				t.Error("newAuthenticator() accepted invalid settings")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/scenario"
+)
+
+// Сторінка підтвердження дії за підписаним посиланням. Дія виконується лише після POST:
+// попередній перегляд посилань у пошті чи месенджерах (GET) нічого не змінює
+var approvalPage = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>SETMaster</title></head>
+<body>
+{{if .Error}}<p>Помилка: {{.Error}}</p>
+{{else if .Done}}<p>{{.Result}}</p>
+{{else}}<p>Прийняти рішення <b>{{.Label}}</b> для сценарію <b>{{.Value.Scenario}}</b> для IP <b>{{.Value.IP}}</b> (інцидент {{.Value.IncidentID}})?</p>
+<form method="POST" action="{{.Action}}"><button type="submit">Підтвердити</button></form>
+{{end}}
+</body>
+</html>`))
+
+// Дані сторінки підтвердження
+type approvalView struct {
+	Value  notifier.ActionValue // Дія з посилання
+	Label  string               // Назва дії
+	Action string               // Адреса форми (те саме посилання)
+	Done   bool                 // Дію виконано
+	Result string               // Результат виконання
+	Error  string               // Причина відмови
+}
+
+// Обробка підписаних посилань з Teams, пошти та вебхука
+func (s *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	view := approvalView{Action: r.URL.RequestURI()}
+	value, err := s.approvals.Verify(r.URL.Query(), time.Now())
+	view.Value = value
+	view.Label = s.scenarios.ActionLabel(value.Scenario, value.Action)
+	if err != nil {
+		log.Printf("Відхилено посилання підтвердження від %s: %v", r.RemoteAddr, err)
+		view.Error = err.Error()
+		w.WriteHeader(http.StatusForbidden)
+		renderApproval(w, view)
+		return
+	}
+
+	// Рішення приймається один раз: повторно відкрите посилання не пропонує його підтвердити
+	if decision, err := s.db.GetDecisionByIncident(value.IncidentID); err == nil && decision != nil {
+		view.Error = fmt.Sprintf("%v: «%s», користувач %s", scenario.ErrDecided, s.scenarios.ActionLabel(decision.Scenario, decision.Action), decision.User)
+		w.WriteHeader(http.StatusConflict)
+		renderApproval(w, view)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		renderApproval(w, view)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Метод не дозволений", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("Виконання дії %s сценарію %s для IP %s (інцидент %s) за посиланням від %s",
+		value.Action, value.Scenario, value.IP, value.IncidentID, r.RemoteAddr)
+	view.Done = true
+	// Автор посилання невідомий, тому рішення позначається адресою, з якої його підтверджено
+	view.Result = s.executeNotifiedAction(value, "", "посилання з "+clientHost(r))
+	renderApproval(w, view)
+}
+
+// Виведення сторінки підтвердження
+func renderApproval(w http.ResponseWriter, view approvalView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := approvalPage.Execute(w, view); err != nil {
+		log.Printf("Не вдалося сформувати сторінку підтвердження: %v", err)
+	}
+}
+
+// Виконання дії, обраної у сповіщенні, та оновлення сповіщення результатом.
+// ref - ідентифікатор повідомлення, якщо він відомий зі зворотного виклику, user - хто обрав дію
+func (s *Server) executeNotifiedAction(value notifier.ActionValue, ref, user string) string {
+	if ref == "" {
+		// Ідентифікатор повідомлення зберігається в записі інциденту
+		if record, err := s.db.GetRecordByIncident(value.IncidentID); err == nil && record != nil {
+			ref = record.MessageTS
+		}
+	}
+
+	by := ""
+	if user != "" {
+		by = fmt.Sprintf(", користувач %s", user)
+	}
+	// У повідомленні залишається рішення та його автор замість кнопок
+	label := s.scenarios.ActionLabel(value.Scenario, value.Action)
+	text := fmt.Sprintf("Сценарій %s, IP %s (інцидент %s): рішення «%s»%s.", value.Scenario, value.IP, value.IncidentID, label, by)
+	if err := s.scenarios.ExecuteAction(value.Scenario, value.Action, value.IP, value.IncidentID, user); err != nil {
+		log.Printf("Не вдалося виконати дію %s для IP %s: %v", value.Action, value.IP, err)
+		text = fmt.Sprintf("Сценарій %s, IP %s (інцидент %s): рішення «%s»%s не виконано: %v", value.Scenario, value.IP, value.IncidentID, label, by, err)
+		if errors.Is(err, scenario.ErrDecided) {
+			return text // Повідомлення вже містить перше рішення, повторне натискання його не змінює
+		}
+	}
+	// Повідомлення оновлюється і при помилці: кнопки прибираються, а причина видна всім
+	if err := s.scenarios.UpdateNotification(value.Scenario, ref, text); err != nil {
+		log.Printf("Не вдалося оновити сповіщення для IP %s: %v", value.IP, err)
+	}
+	return text
+}
+
+// Оновлення від Telegram Bot API з натисканням кнопки
+type telegramUpdate struct {
+	CallbackQuery *struct {
+		ID   string `json:"id"`
+		From struct {
+			ID       int64  `json:"id"`
+			Username string `json:"username"`
+		} `json:"from"`
+		Message struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"message"`
+		Data string `json:"data"`
+	} `json:"callback_query"`
+}
+
+// Обробка вебхука бота Telegram: натискання кнопок inline-клавіатури
+func (s *Server) handleTelegramCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не дозволений", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := notifier.VerifyTelegramSecret(s.cfg.Notifier.Telegram.WebhookSecret, r.Header); err != nil {
+		rejectedRequests.Add("telegram_callback/secret", 1)
+		log.Printf("Відхилено вебхук Telegram від %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Неавторизований запит", http.StatusUnauthorized)
+		return
+	}
+
+	var update telegramUpdate
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxEventBody)).Decode(&update); err != nil {
+		log.Printf("Не вдалося декодувати оновлення Telegram: %v", err)
+		http.Error(w, "Невірний JSON", http.StatusBadRequest)
+		return
+	}
+	// Інші типи оновлень (повідомлення в чаті тощо) ігноруються
+	query := update.CallbackQuery
+	if query == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user := query.From.Username
+	if user == "" {
+		user = strconv.FormatInt(query.From.ID, 10)
+	}
+	incidentID, action, ok := notifier.ParseTelegramCallbackData(query.Data)
+	record, err := s.db.GetRecordByIncident(incidentID)
+	if !ok || err != nil || record == nil {
+		log.Printf("Натискання кнопки Telegram для невідомого інциденту %q (користувач %s)", query.Data, user)
+		if err := s.telegram.AnswerCallback(query.ID, "Інцидент уже неактуальний"); err != nil {
+			log.Printf("Не вдалося відповісти на натискання кнопки Telegram: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	value := notifier.ActionValue{Scenario: record.Scenario, IP: record.IP, IncidentID: incidentID, Action: action}
+	log.Printf("Виконання дії %s сценарію %s для IP %s (інцидент %s, користувач %s) із Telegram",
+		value.Action, value.Scenario, value.IP, value.IncidentID, user)
+	if err := s.telegram.AnswerCallback(query.ID, "Виконується дія "+action); err != nil {
+		log.Printf("Не вдалося відповісти на натискання кнопки Telegram: %v", err)
+	}
+	ref := strconv.FormatInt(query.Message.MessageID, 10)
+	go s.executeNotifiedAction(value, ref, user)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Адреса клієнта без порту
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/scenario"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Діяч, що рахує блокування
+type countingActioner struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (c *countingActioner) Name() string { return "fake_firewall" }
+
+func (c *countingActioner) Execute(ip string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	return nil
+}
+
+func (c *countingActioner) Revert(ip string) error { return nil }
+
+// Сервер зі сценарієм ssh та відкритим інцидентом a1b2c3d4 для 203.0.113.7
+func approvalServer(t *testing.T) (*Server, *countingActioner) {
+	t.Helper()
+	store, err := db.NewSQLiteDB(filepath.Join(t.TempDir(), "blocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpdateRecord("ssh", "203.0.113.7", func(r *models.BlockRecord) error {
+		r.IncidentID = "a1b2c3d4"
+		r.NotifiedAt = time.Now().Unix()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Scenarios: map[string]config.Scenario{"ssh": {
+		Params: config.ScenarioParams{UnblockAfter: 10},
+		Action: config.ScenarioAction{Actioners: []string{"fake_firewall"}},
+	}}}
+	cfg.Notifier.Approval = config.ApprovalConfig{BaseURL: "https://setmaster.example.com", Secret: "s3cret"}
+	allow, err := allowlist.New(cfg.Allowlist, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw := &countingActioner{}
+	manager := scenario.NewManager(cfg, map[string]actioner.Actioner{"fake_firewall": fw}, store, map[string]notifier.Notifier{}, allow)
+	return &Server{cfg: cfg, db: store, scenarios: manager, approvals: notifier.NewApprovalLinks(cfg.Notifier.Approval)}, fw
+}
+
+// Адреса посилання відносно сервера
+func approvalTarget(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.RequestURI()
+}
+
+func TestApprovalOneShot(t *testing.T) {
+	s, fw := approvalServer(t)
+	value := notifier.ActionValue{Scenario: "ssh", IP: "203.0.113.7", IncidentID: "a1b2c3d4", Action: scenario.ActionAll}
+	target := approvalTarget(t, s.approvals.URL(value, time.Now()))
+	do := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleApproval(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	// Попередній перегляд посилання нічого не виконує
+	if rec := do(http.MethodGet); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<form") {
+		t.Fatalf("GET: %d %s", rec.Code, rec.Body.String())
+	}
+	if fw.count != 0 {
+		t.Fatal("GET executed the action")
+	}
+	if rec := do(http.MethodPost); rec.Code != http.StatusOK {
+		t.Fatalf("POST: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Повторне відкриття та підтвердження того самого посилання
+	for _, method := range []string{http.MethodPost, http.MethodGet, http.MethodPost} {
+		rec := do(method)
+		if rec.Code != http.StatusConflict || strings.Contains(rec.Body.String(), "<form") {
+			t.Errorf("replayed %s: %d %s", method, rec.Code, rec.Body.String())
+		}
+	}
+	// Інше рішення з того самого листа теж відхиляється
+	value.Action = scenario.ActionDismiss
+	rec := httptest.NewRecorder()
+	s.handleApproval(rec, httptest.NewRequest(http.MethodPost, approvalTarget(t, s.approvals.URL(value, time.Now())), nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second decision: %d", rec.Code)
+	}
+
+	if fw.count != 1 {
+		t.Errorf("executed %d times, want 1", fw.count)
+	}
+	record, err := s.db.GetRecordByIncident("a1b2c3d4")
+	if err != nil || record == nil {
+		t.Fatalf("record: %v", err)
+	}
+	if record.BlockCount != 1 {
+		t.Errorf("BlockCount = %d, want 1", record.BlockCount)
+	}
+}
+
+func TestApprovalRejectsInvalidLinks(t *testing.T) {
+	s, fw := approvalServer(t)
+	value := notifier.ActionValue{Scenario: "ssh", IP: "203.0.113.7", IncidentID: "a1b2c3d4", Action: scenario.ActionAll}
+	tests := []struct {
+		name   string
+		target func() string
+	}{
+		{"expired", func() string { return approvalTarget(t, s.approvals.URL(value, time.Now().Add(-2*time.Hour))) }},
+		{"tampered ip", func() string {
+			return strings.Replace(approvalTarget(t, s.approvals.URL(value, time.Now())), "203.0.113.7", "203.0.113.8", 1)
+		}},
+		{"wrong incident", func() string {
+			return strings.Replace(approvalTarget(t, s.approvals.URL(value, time.Now())), "a1b2c3d4", "e5f6a7b8", 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.handleApproval(rec, httptest.NewRequest(http.MethodPost, tt.target(), nil))
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+	if fw.count != 0 {
+		t.Errorf("executed %d times, want 0", fw.count)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Максимальний розмір тіла запиту з подіями (пакет falcosidekick або NDJSON)
+const maxEventBody = 10 << 20
+
+// Статуси обробки окремої події пакета
+const (
+	itemProcessed = "processed" // Подію передано сценаріям
+	itemFailed    = "failed"    // Подію не вдалося декодувати
+)
+
+// Результат обробки однієї події пакета
+type itemResult struct {
+	Index   int    `json:"index"`           // Позиція події в пакеті (з нуля)
+	UUID    string `json:"uuid,omitempty"`  // Ідентифікатор події
+	Rule    string `json:"rule,omitempty"`  // Правило події
+	Status  string `json:"status"`          // processed або failed
+	Matched int    `json:"matched"`         // Кількість сценаріїв, що відповідають події
+	Error   string `json:"error,omitempty"` // Причина помилки
+}
+
+// Звіт про обробку запиту з подіями
+type ingestReport struct {
+	Processed int          `json:"processed"` // Кількість оброблених подій
+	Failed    int          `json:"failed"`    // Кількість подій з помилками
+	Results   []itemResult `json:"results"`   // Результати для кожної події
+}
+
+// Обгортка CloudEvents у структурованому режимі (вихід cloudevents у falcosidekick)
+type cloudEvent struct {
+	SpecVersion string          `json:"specversion"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Розбиття тіла запиту на окремі події. Підтримуються:
+//   - один JSON-об'єкт (http_output Falco, вебхук falcosidekick);
+//   - JSON-масив подій;
+//   - NDJSON: по одній події в рядку.
+//
+// Некоректний рядок NDJSON не зупиняє обробку решти пакета: він повертається як є і
+// отримує помилку під час декодування
+func splitBatch(body []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, errors.New("порожнє тіло запиту")
+	}
+
+	// JSON-масив декодується цілком: без коректної структури масиву межі подій невідомі
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	// Один об'єкт, у тому числі відформатований у кілька рядків
+	if json.Valid(trimmed) {
+		return []json.RawMessage{trimmed}, nil
+	}
+
+	// NDJSON: порожні рядки пропускаються
+	var items []json.RawMessage
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(line))
+	}
+	return items, nil
+}
+
+// Вміст події без обгортки CloudEvents, якщо вона присутня
+func unwrapEvent(item json.RawMessage) json.RawMessage {
+	var ce cloudEvent
+	if err := json.Unmarshal(item, &ce); err != nil || ce.SpecVersion == "" || len(ce.Data) == 0 {
+		return item
+	}
+	return ce.Data
+}
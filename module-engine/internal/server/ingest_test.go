@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/source"
+)
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single object", body: `{"rule":"a"}`, want: []string{`{"rule":"a"}`}},
+		{name: "multiline object", body: "{\n  \"rule\": \"a\",\n  \"output\": \"x\"\n}\n", want: []string{"{\n  \"rule\": \"a\",\n  \"output\": \"x\"\n}"}},
+		{name: "array", body: ` [{"rule":"a"}, {"rule":"b"}] `, want: []string{`{"rule":"a"}`, `{"rule":"b"}`}},
+		{name: "empty array", body: `[]`, want: []string{}},
+		{name: "ndjson with blank lines", body: "{\"rule\":\"a\"}\n\n  \n{\"rule\":\"b\"}\r\n{\"rule\":\"c\"}\n", want: []string{`{"rule":"a"}`, `{"rule":"b"}`, `{"rule":"c"}`}},
+		{name: "ndjson with malformed line", body: "{\"rule\":\"a\"}\n{\"rule\":\n{\"rule\":\"c\"}", want: []string{`{"rule":"a"}`, `{"rule":`, `{"rule":"c"}`}},
+		{name: "empty body", body: " \n ", wantErr: true},
+		{name: "malformed array", body: `[{"rule":"a"},`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := splitBatch([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(items))
+			for _, item := range items {
+				got = append(got, string(item))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		item string
+		want string
+	}{
+		{
+			name: "structured cloudevent",
+			item: `{"specversion":"1.0","type":"falco.rule.output.v1","source":"falco.org","id":"42","datacontenttype":"application/json","data":{"rule":"Terminal shell in container","priority":"Notice"}}`,
+			want: `{"rule":"Terminal shell in container","priority":"Notice"}`,
+		},
+		{name: "plain event", item: `{"rule":"a","output":"x"}`, want: `{"rule":"a","output":"x"}`},
+		{name: "data without specversion", item: `{"data":{"rule":"a"}}`, want: `{"data":{"rule":"a"}}`},
+		{name: "specversion without data", item: `{"specversion":"1.0","id":"42"}`, want: `{"specversion":"1.0","id":"42"}`},
+		{name: "malformed", item: `{"specversion":`, want: `{"specversion":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(unwrapEvent(json.RawMessage(tt.item))); got != tt.want {
+				t.Errorf("unwrapEvent() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Звіт про пакет: некоректна подія не зупиняє обробку решти, запит невдалий, лише якщо не оброблено жодної
+func TestIngestReport(t *testing.T) {
+	s, _ := approvalServer(t)
+	decoder, err := source.New(config.Alias{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       []itemResult
+	}{
+		{
+			name:       "batch with a malformed item",
+			body:       "{\"uuid\":\"e1\",\"rule\":\"Terminal shell\"}\n{\"uuid\":\n\n{\"specversion\":\"1.0\",\"data\":{\"uuid\":\"e3\",\"rule\":\"Read sensitive file\"}}\n",
+			wantStatus: http.StatusOK,
+			want: []itemResult{
+				{Index: 0, UUID: "e1", Rule: "Terminal shell", Status: itemProcessed},
+				{Index: 1, Status: itemFailed},
+				{Index: 2, UUID: "e3", Rule: "Read sensitive file", Status: itemProcessed},
+			},
+		},
+		{
+			name:       "only malformed items",
+			body:       "{\"uuid\":\n[1\n",
+			wantStatus: http.StatusBadRequest,
+			want:       []itemResult{{Index: 0, Status: itemFailed}, {Index: 1, Status: itemFailed}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.ingest(rec, httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader(tt.body)), decoder)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var report ingestReport
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			for i := range report.Results {
+				if report.Results[i].Status == itemFailed && report.Results[i].Error == "" {
+					t.Errorf("item %d failed without a reason", i)
+				}
+				report.Results[i].Error = ""
+			}
+			if !reflect.DeepEqual(report.Results, tt.want) {
+				t.Errorf("results = %+v, want %+v", report.Results, tt.want)
+			}
+			processed := 0
+			for _, r := range tt.want {
+				if r.Status == itemProcessed {
+					processed++
+				}
+			}
+			if report.Processed != processed || report.Failed != len(tt.want)-processed {
+				t.Errorf("processed %d, failed %d", report.Processed, report.Failed)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	s.ingest(rec, httptest.NewRequest(http.MethodPost, "/falco", strings.NewReader("  ")), decoder)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty body: status = %d, want 400", rec.Code)
+	}
+}
@@ -1,19 +1,25 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/scenario"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/source"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/web"
-	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
 )
 
 // Структура сервера з усіма необхідними компонентами
@@ -22,7 +28,12 @@ type Server struct {
 	actioners map[string]actioner.Actioner // Мапа доступних діячів
 	db        *db.SQLiteDB                 // Підключення до бази даних SQLite
 	notifier  *notifier.SlackNotifier      // Система сповіщень через Slack
+	telegram  *notifier.TelegramNotifier   // Сповіщення Telegram (натискання кнопок приходять у вебхук бота)
+	approvals *notifier.ApprovalLinks      // Підписані посилання для вибору дії (nil - не налаштовано)
 	scenarios *scenario.Manager            // Менеджер сценаріїв
+	sources   map[string]source.Decoder    // Декодери подій за назвою псевдоніма
+	auth      map[string]*authenticator    // Автентифікація запитів за назвою псевдоніма
+	tls       *tls.Config                  // Налаштування TLS (nil - сервер без TLS)
 }
 
 // Створює новий екземпляр сервера з заданою конфігурацією
@@ -35,9 +46,11 @@ func NewServer(cfg *config.Config) (*Server, error) {
 
 	// Ініціалізація діячів для різних сервісів
 	actioners := map[string]actioner.Actioner{
-		"gcp_firewall": actioner.NewGCPFirewall(cfg.Actioners["gcp_firewall"]), // Діяч для GCP Firewall
-		"gcp_storage":  actioner.NewGCPStorage(cfg.Actioners["gcp_storage"]),   // Діяч для GCP Storage
-		"sigmahq":      actioner.NewSigmaHQActioner(cfg.Actioners["sigmahq"]),  // Діяч для SigmaHQ
+		"gcp_firewall":   actioner.NewGCPFirewall(cfg.Actioners["gcp_firewall"]),     // Діяч для GCP Firewall
+		"gcp_storage":    actioner.NewGCPStorage(cfg.Actioners["gcp_storage"]),       // Діяч для GCP Storage
+		"sigmahq":        actioner.NewSigmaHQActioner(cfg.Actioners["sigmahq"]),      // Діяч для SigmaHQ
+		"local_firewall": actioner.NewLocalFirewall(cfg.Actioners["local_firewall"]), // Діяч для nftables/iptables на локальному хості
+		"cilium_policy":  actioner.NewCiliumPolicy(cfg.Actioners["cilium_policy"]),   // Діяч для політик Cilium у кластері
 	}
 
 	// Ініціалізація сповіщень через Slack
@@ -48,11 +61,62 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		cfg.Notifier.Slack.Channel,     // Канал для сповіщень
 	)
 
+	// Інші системи сповіщень; Teams, пошта та вебхук пропонують дії підписаними посиланнями
+	approvals := notifier.NewApprovalLinks(cfg.Notifier.Approval)
+	telegramNotifier := notifier.NewTelegramNotifier(cfg.Notifier.Telegram)
+	notifiers := map[string]notifier.Notifier{
+		"slack":    slackNotifier,                                                // Slack з кнопками Block Kit
+		"teams":    notifier.NewTeamsNotifier(cfg.Notifier.Teams, approvals),     // Microsoft Teams
+		"telegram": telegramNotifier,                                             // Telegram з inline-клавіатурою
+		"email":    notifier.NewEmailNotifier(cfg.Notifier.Email, approvals),     // Електронна пошта через SMTP
+		"webhook":  notifier.NewWebhookNotifier(cfg.Notifier.Webhook, approvals), // Довільний вихідний вебхук
+	}
+
+	// Список дозволених: записи конфігурації та записи, додані через дашборд або сповіщення
+	allow, err := allowlist.New(cfg.Allowlist, db)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ініціалізація менеджера сценаріїв
-	scenarioMgr := scenario.NewManager(cfg, actioners, db, slackNotifier)
+	scenarioMgr := scenario.NewManager(cfg, actioners, db, notifiers, allow)
+
+	// Налаштування TLS, якщо вказано сертифікат сервера
+	var tlsConfig *tls.Config
+	if cfg.Server.TLS.CertFile != "" {
+		if tlsConfig, err = serverTLSConfig(cfg.Server.TLS.ClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	mtlsEnabled := tlsConfig != nil && tlsConfig.ClientCAs != nil
+
+	// Ініціалізація декодерів подій та автентифікації для кожного псевдоніма
+	sources := make(map[string]source.Decoder, len(cfg.Server.Aliases))
+	auth := make(map[string]*authenticator, len(cfg.Server.Aliases))
+	for name, alias := range cfg.Server.Aliases {
+		decoder, err := source.New(alias)
+		if err != nil {
+			return nil, fmt.Errorf("псевдонім %s: %w", name, err)
+		}
+		sources[name] = decoder
+		if auth[name], err = newAuthenticator(name, alias.Auth, mtlsEnabled); err != nil {
+			return nil, fmt.Errorf("псевдонім %s: %w", name, err)
+		}
+	}
 
 	// Повернення нового екземпляра сервера
-	return &Server{cfg, actioners, db, slackNotifier, scenarioMgr}, nil
+	return &Server{
+		cfg:       cfg,
+		actioners: actioners,
+		db:        db,
+		notifier:  slackNotifier,
+		telegram:  telegramNotifier,
+		approvals: approvals,
+		scenarios: scenarioMgr,
+		sources:   sources,
+		auth:      auth,
+		tls:       tlsConfig,
+	}, nil
 }
 
 // Запуск серверу
@@ -60,9 +124,16 @@ func (s *Server) Start() {
 	mux := http.NewServeMux() // Створення нового HTTP-мультиплексора
 
 	// Реєстрація аліасів для обробки подій
-	for alias, path := range s.cfg.Server.Aliases {
-		log.Printf("Реєстрація аліасу %s за адресою %s", alias, path)
-		mux.HandleFunc(path, s.handleEvent)
+	for name, alias := range s.cfg.Server.Aliases {
+		if alias.Path != "" {
+			log.Printf("Реєстрація аліасу %s (джерело %s) за адресою %s", name, sourceType(alias), alias.Path)
+			mux.HandleFunc(alias.Path, s.auth[name].wrap(s.handleEvent(s.sources[name])))
+		}
+		// Події джерела також можуть читатися з файлу журналу (наприклад, cowrie.json)
+		if alias.File != "" {
+			log.Printf("Читання аліасу %s (джерело %s) з файлу %s", name, sourceType(alias), alias.File)
+			go source.TailFile(context.Background(), alias.File, s.tailHandler(s.sources[name]))
+		}
 	}
 
 	// Парсинг URL зворотного виклику для Slack
@@ -77,59 +148,187 @@ func (s *Server) Start() {
 		callbackPath = "/callback" // Шлях за замовчуванням, якщо не вказано
 	}
 	log.Printf("Реєстрація зворотного виклику Slack за адресою %s", callbackPath)
+	if s.cfg.Notifier.Slack.SigningSecret == "" {
+		log.Printf("Увага: notifier.slack.signing_secret не налаштовано, зворотні виклики Slack відхилятимуться")
+	}
 	mux.HandleFunc(callbackPath, s.handleSlackCallback)
 
+	// Вебхук бота Telegram для натискань кнопок inline-клавіатури
+	if s.cfg.Notifier.Telegram.BotToken != "" {
+		log.Printf("Реєстрація вебхука Telegram за адресою %s", s.telegram.CallbackPath())
+		mux.HandleFunc(s.telegram.CallbackPath(), s.handleTelegramCallback)
+	}
+
+	// Сторінка підтвердження дії за підписаним посиланням
+	if s.approvals != nil {
+		log.Printf("Реєстрація сторінки підтвердження дій за адресою %s", notifier.ApprovalPath)
+		mux.HandleFunc(notifier.ApprovalPath, s.handleApproval)
+	}
+
+	// Відновлення таймерів розблокування та сповіщень, збережених у базі даних
+	if err := s.scenarios.Reconcile(); err != nil {
+		log.Printf("Помилка при відновленні таймерів: %v", err)
+	}
+
+	// Запуск періодичного очищення історії подій
+	s.scenarios.StartRetention()
+
 	// Запуск дашборду в окремій горутині
 	go web.StartDashboard(s.cfg.Server.DashboardPort, s.db, s.scenarios)
 
-	// Запуск HTTP-сервера
-	log.Printf("Сервер запускається на порту :%d", s.cfg.Server.Port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", s.cfg.Server.Port), mux))
+	// Запуск HTTP-сервера (HTTPS, якщо налаштовано TLS)
+	addr := fmt.Sprintf(":%d", s.cfg.Server.Port)
+	if s.tls != nil {
+		log.Printf("Сервер запускається на порту %s (TLS)", addr)
+		srv := &http.Server{Addr: addr, Handler: mux, TLSConfig: s.tls}
+		log.Fatal(srv.ListenAndServeTLS(s.cfg.Server.TLS.CertFile, s.cfg.Server.TLS.KeyFile))
+	}
+	log.Printf("Сервер запускається на порту %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// Тип джерела псевдоніма для журналу
+func sourceType(alias config.Alias) string {
+	if alias.Source == "" {
+		return source.TypeFalco
+	}
+	return alias.Source
+}
+
+// Обробник вхідних подій псевдоніма: одна подія, JSON-масив чи NDJSON.
+// Кожна подія пакета декодується джерелом псевдоніма та обробляється незалежно,
+// у відповідь повертається звіт по кожній події
+func (s *Server) handleEvent(decoder source.Decoder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.ingest(w, r, decoder)
+	}
 }
 
-// Обробка вхідних події від Falco
-func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
-	// Структура для декодування події Falco
-	var falcoEvent struct {
-		Rule         string `json:"rule"`
-		OutputFields struct {
-			RemoteIP string `json:"fd.rip"`  // Віддалена IP-адреса
-			Result   string `json:"evt.res"` // Результат події
-			SourceIP string `json:"fd.sip"`  // Серверна IP-адреса
-		} `json:"output_fields"`
-		Time string `json:"time"` // Час події
-	}
-
-	// Декодування JSON-запиту в структуру falcoEvent
-	if err := json.NewDecoder(r.Body).Decode(&falcoEvent); err != nil {
+// Прийом подій з тіла запиту
+func (s *Server) ingest(w http.ResponseWriter, r *http.Request, decoder source.Decoder) {
+	// Зчитування тіла запиту: повний JSON зберігається разом із подією
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBody))
+	if err != nil {
+		log.Printf("Не вдалося прочитати подію: %v", err)
+		http.Error(w, "Не вдалося прочитати запит", http.StatusBadRequest)
+		return
+	}
+
+	// Розбиття запиту на окремі події
+	items, err := splitBatch(body)
+	if err != nil {
 		log.Printf("Не вдалося декодувати подію: %v", err)
 		http.Error(w, "Невірний JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Отримання віддаленої IP-адреси з події
-	ip := falcoEvent.OutputFields.RemoteIP
-	if ip == "" {
-		log.Printf("Віддалена IP-адреса не знайдена в події")
-		http.Error(w, "Відсутня IP-адреса", http.StatusBadRequest)
-		return
+	report := ingestReport{Results: make([]itemResult, 0, len(items))}
+	for i, item := range items {
+		result := s.ingestEvent(decoder, unwrapEvent(item))
+		result.Index = i
+		if result.Status == itemProcessed {
+			report.Processed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
 	}
+	if len(items) > 1 {
+		log.Printf("Оброблено пакет з %d подій: успішно %d, з помилками %d", len(items), report.Processed, report.Failed)
+	}
+
+	// Запит вважається невдалим лише тоді, коли жодну подію не вдалося обробити
+	status := http.StatusOK
+	if report.Processed == 0 {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Не вдалося сформувати відповідь: %v", err)
+	}
+}
+
+// Обробник рядків файлу журналу: кожен рядок є окремою подією
+func (s *Server) tailHandler(decoder source.Decoder) func(line []byte) {
+	return func(line []byte) {
+		s.ingestEvent(decoder, line)
+	}
+}
+
+// Декодування та передача сценаріям однієї події
+func (s *Server) ingestEvent(decoder source.Decoder, item json.RawMessage) itemResult {
+	var result itemResult
+
+	// Декодування події форматом джерела; суб'єкт події визначає кожен сценарій
+	event, err := decoder.Decode(item)
+	if err != nil {
+		log.Printf("Не вдалося декодувати подію: %v", err)
+		result.Status = itemFailed
+		result.Error = err.Error()
+		return result
+	}
+	result.UUID = event.UUID
+	result.Rule = event.Rule
 
 	// Логування отриманої події для відстеження
-	log.Printf("Отримано подію для IP %s з правилом %s", ip, falcoEvent.Rule)
+	log.Printf("Отримано подію %s з правилом %s", event.UUID, event.Rule)
+
+	// Передача події всім відповідним сценаріям
+	result.Matched = s.scenarios.Dispatch(event)
+	result.Status = itemProcessed
+	return result
+}
+
+// Payload інтерактивного зворотного виклику Slack (block_actions та legacy interactive_message)
+type slackPayload struct {
+	Type       string `json:"type"`
+	CallbackID string `json:"callback_id"`
+	User       struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions []struct {
+		Name     string `json:"name"`
+		ActionID string `json:"action_id"`
+		BlockID  string `json:"block_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	Container struct {
+		MessageTS string `json:"message_ts"`
+	} `json:"container"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	OriginalMessage struct {
+		Text string `json:"text"`
+	} `json:"original_message"`
+}
+
+// Обробка натискання кнопки у повідомленні Block Kit. Slack очікує відповідь протягом 3 секунд,
+// тому дія виконується у фоні, а результат записується в повідомлення через chat.update
+func (s *Server) handleBlockActions(w http.ResponseWriter, payload slackPayload) {
+	for _, act := range payload.Actions {
+		if act.BlockID != notifier.ActionsBlockID {
+			continue
+		}
+		value, err := notifier.ParseActionValue(act.Value)
+		if err != nil {
+			log.Printf("Невірна кнопка у зворотному виклику Slack: %v", err)
+			http.Error(w, "Невірний вміст кнопки", http.StatusBadRequest)
+			return
+		}
+		ts := payload.Container.MessageTS
+		log.Printf("Виконання дії %s сценарію %s для IP %s (інцидент %s, користувач %s) із зворотного виклику Slack",
+			value.Action, value.Scenario, value.IP, value.IncidentID, payload.User.Username)
 
-	// Створення структури події для подальшої обробки
-	event := models.Event{
-		IP:       ip,
-		Rule:     falcoEvent.Rule,
-		Result:   falcoEvent.OutputFields.Result,
-		Time:     falcoEvent.Time,
-		SourceIP: falcoEvent.OutputFields.SourceIP,
+		go s.executeNotifiedAction(value, ts, payload.User.Username)
+		w.WriteHeader(http.StatusOK)
+		return
 	}
 
-	// Передача події в менеджер сценаріїв для обробки
-	s.scenarios.HandleEvent("block_ip", event)
-	w.WriteHeader(http.StatusOK) // Відправка успішної відповіді клієнту
+	log.Printf("Зворотний виклик Slack не містить дії сценарію: Actions=%+v", payload.Actions)
+	w.WriteHeader(http.StatusOK)
 }
 
 // Обробка зворотніх викликів від Slack
@@ -144,6 +343,21 @@ func (s *Server) handleSlackCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Перевірка підпису Slack: непідписані та застарілі запити відхиляються
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBody))
+	if err != nil {
+		log.Printf("Не вдалося прочитати зворотний виклик: %v", err)
+		http.Error(w, "Не вдалося прочитати запит", http.StatusBadRequest)
+		return
+	}
+	if err := notifier.VerifySlackSignature(s.cfg.Notifier.Slack.SigningSecret, r.Header, body, time.Now()); err != nil {
+		rejectedRequests.Add("slack_callback/signature", 1)
+		log.Printf("Відхилено зворотний виклик Slack від %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Неавторизований запит", http.StatusUnauthorized)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
 	// Парсинг даних форми з запиту
 	if err := r.ParseForm(); err != nil {
 		log.Printf("Не вдалося розпарсити форму: %v", err)
@@ -161,16 +375,7 @@ func (s *Server) handleSlackCallback(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Сирий payload зворотного виклику: %s", payloadRaw)
 
 	// Структура для декодування payload з JSON
-	var payload struct {
-		CallbackID string `json:"callback_id"`
-		Actions    []struct {
-			Name  string `json:"name"`
-			Value string `json:"value"`
-		} `json:"actions"`
-		OriginalMessage struct {
-			Text string `json:"text"`
-		} `json:"original_message"`
-	}
+	var payload slackPayload
 
 	// Декодування payload у визначену структуру
 	if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
@@ -180,26 +385,23 @@ func (s *Server) handleSlackCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Логування розпарсеного зворотного виклику для дебагу
-	log.Printf("Розпарсений зворотний виклик: CallbackID=%s, Actions=%+v, OriginalMessage=%s",
-		payload.CallbackID, payload.Actions, payload.OriginalMessage.Text)
+	log.Printf("Розпарсений зворотний виклик: Type=%s, CallbackID=%s, Actions=%+v, OriginalMessage=%s",
+		payload.Type, payload.CallbackID, payload.Actions, payload.OriginalMessage.Text)
 
-	// Обробка дії block_ip_action, якщо вона присутня
-	if payload.CallbackID == "block_ip_action" && len(payload.Actions) > 0 {
-		action := payload.Actions[0].Value
-		var ip string
-
-		// Витягування IP-адреси з тексту оригінального повідомлення
-		if _, err := fmt.Sscanf(payload.OriginalMessage.Text, "IP %s triggered scenario block_ip", &ip); err != nil {
-			log.Printf("Не вдалося витягти IP з повідомлення: %v", err)
-			http.Error(w, "Не вдається розпарсити IP", http.StatusBadRequest)
-			return
-		}
+	// Повідомлення Block Kit: сценарій, IP та інцидент передаються у value кнопки
+	if payload.Type == "block_actions" {
+		s.handleBlockActions(w, payload)
+		return
+	}
 
-		// Логування виконання дії для відстеження
-		log.Printf("Виконання дії %s для IP %s із зворотного виклику Slack", action, ip)
-		s.scenarios.ExecuteAction(action, ip)
+	// Повідомлення з legacy attachments надіслано до появи інцидентів: без інциденту неможливо перевірити,
+	// чи кнопка стосується поточного спрацювання і чи рішення ще не прийнято, тому дія не виконується
+	scenarioName, ip, ok := notifier.ParseActionCallbackID(payload.CallbackID)
+	if (ok || payload.CallbackID == "block_ip_action") && len(payload.Actions) > 0 {
+		action := payload.Actions[0].Value
+		log.Printf("Відхилено дію %s сценарію %s для IP %s із застарілого повідомлення Slack: повідомлення не містить інциденту", action, scenarioName, ip)
 
-		// Формування відповіді для Slack
+		// Відповідь замінює кнопки повідомлення причиною відмови
 		response := struct {
 			Text        string `json:"text"`
 			Attachments []struct {
@@ -211,7 +413,7 @@ func (s *Server) handleSlackCallback(w http.ResponseWriter, r *http.Request) {
 			Attachments: []struct {
 				Text string `json:"text"`
 			}{
-				{Text: fmt.Sprintf("Дію %s виконано для IP %s.", action, ip)},
+				{Text: fmt.Sprintf("Дію %s не виконано: застаріле повідомлення не містить інциденту, дочекайтеся нового сповіщення.", action)},
 			},
 			ReplaceOriginal: true,
 		}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+const slackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// Тіло зворотного виклику Slack з натисканням кнопки поза блоком дій сценарію
+var slackCallbackBody = url.Values{"payload": {`{"type":"block_actions","actions":[{"block_id":"other","value":"x"}]}`}}.Encode()
+
+func slackCallbackRequest() *http.Request {
+	return slackRequest(slackCallbackBody)
+}
+
+// Зворотний виклик Slack із заданим тілом форми
+func slackRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/slack/callback", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// Підпис запиту секретом застосунку Slack
+func signSlack(r *http.Request, secret string, at time.Time) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestSlackCallbackSignature(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Notifier.Slack.SigningSecret = slackSecret
+	s := &Server{cfg: cfg}
+
+	tests := []struct {
+		name    string
+		sign    func(r *http.Request)
+		want    int
+		counted bool
+	}{
+		{name: "signed", sign: func(r *http.Request) { signSlack(r, slackSecret, time.Now()) }, want: http.StatusOK},
+		{name: "unsigned", sign: func(*http.Request) {}, want: http.StatusUnauthorized, counted: true},
+		{name: "wrong secret", sign: func(r *http.Request) { signSlack(r, "other-secret", time.Now()) }, want: http.StatusUnauthorized, counted: true},
+		{name: "replayed", sign: func(r *http.Request) { signSlack(r, slackSecret, time.Now().Add(-10*time.Minute)) }, want: http.StatusUnauthorized, counted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := rejectedCount("slack_callback/signature")
+			r := slackCallbackRequest()
+			tt.sign(r)
+			rec := httptest.NewRecorder()
+			s.handleSlackCallback(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+			if got := rejectedCount("slack_callback/signature") - before; (got == 1) != tt.counted {
+				t.Errorf("rejected counter grew by %d", got)
+			}
+		})
+	}
+
+	// Без signing_secret зворотні виклики не приймаються взагалі
+	s = &Server{cfg: &config.Config{}}
+	r := slackCallbackRequest()
+	signSlack(r, slackSecret, time.Now())
+	rec := httptest.NewRecorder()
+	s.handleSlackCallback(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without signing_secret = %d, want 401", rec.Code)
+	}
+}
+
+// Кнопки legacy attachments не містять інциденту: дія не виконується, а відповідь повідомляє причину
+func TestSlackLegacyCallbackRejected(t *testing.T) {
+	s, fw := approvalServer(t)
+	s.cfg.Notifier.Slack.SigningSecret = slackSecret
+
+	payloads := []string{
+		`{"type":"interactive_message","callback_id":"scenario_action|ssh|203.0.113.7","actions":[{"name":"fake_firewall","value":"fake_firewall"}],"user":{"username":"alice"}}`,
+		`{"type":"interactive_message","callback_id":"block_ip_action","actions":[{"name":"all","value":"all"}],"user":{"username":"alice"},"original_message":{"text":"Для ІР 203.0.113.7 активовано сценарій ssh"}}`,
+	}
+	for _, payload := range payloads {
+		r := slackRequest(url.Values{"payload": {payload}}.Encode())
+		signSlack(r, slackSecret, time.Now())
+		rec := httptest.NewRecorder()
+		s.handleSlackCallback(rec, r)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "не виконано") {
+			t.Errorf("legacy callback: status %d, body %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if fw.count != 0 {
+		t.Errorf("legacy callbacks executed %d actions", fw.count)
+	}
+	if decision, err := s.db.GetDecisionByIncident("a1b2c3d4"); err != nil || decision != nil {
+		t.Errorf("decision = %+v, %v; want none", decision, err)
+	}
+}
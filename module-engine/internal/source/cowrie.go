@@ -0,0 +1,93 @@
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Події Cowrie, для яких заповнюються нормалізовані поля
+const (
+	cowrieLoginFailed   = "cowrie.login.failed"
+	cowrieLoginSuccess  = "cowrie.login.success"
+	cowrieCommandInput  = "cowrie.command.input"
+	cowrieFileDownload  = "cowrie.session.file_download"
+	cowrieEventIDPrefix = "cowrie."
+)
+
+// Пріоритет та теги відомих подій Cowrie
+var cowrieEvents = map[string]struct {
+	priority string
+	tag      string
+}{
+	cowrieLoginFailed:  {"notice", "login"},
+	cowrieLoginSuccess: {"critical", "login"},
+	cowrieCommandInput: {"warning", "command"},
+	cowrieFileDownload: {"error", "download"},
+}
+
+// Декодер JSON-лога Cowrie (output_jsonlog) та HTTP-виводу у форматі Splunk HEC.
+// Правилом події є її eventid (наприклад, cowrie.login.failed), IP-адресою - src_ip.
+// Поля username, password, command та hash заповнюються для входів, команд та завантажень
+type cowrieDecoder struct {
+	priority string // Пріоритет подій (перекриває пріоритет за типом події)
+}
+
+// Обгортка події у HTTP-виводі Cowrie (Splunk HEC): {"event": {...}, "sourcetype": ...}
+type cowrieEnvelope struct {
+	Event json.RawMessage `json:"event"`
+}
+
+// Декодування події Cowrie; всі поля верхнього рівня потрапляють у поля події під своїми назвами
+func (d *cowrieDecoder) Decode(data []byte) (models.Event, error) {
+	var envelope cowrieEnvelope
+	if err := json.Unmarshal(data, &envelope); err == nil && len(envelope.Event) > 0 && envelope.Event[0] == '{' {
+		data = envelope.Event
+	}
+
+	var raw map[string]interface{}
+	if err := unmarshal(data, &raw); err != nil {
+		return models.Event{}, err
+	}
+	fields := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if s, ok := models.FieldString(value); ok {
+			fields[key] = s
+		}
+	}
+	eventID := fields["eventid"]
+	if !strings.HasPrefix(eventID, cowrieEventIDPrefix) {
+		return models.Event{}, errors.New("подія Cowrie не містить eventid")
+	}
+
+	// Нормалізовані поля для сценаріїв
+	switch eventID {
+	case cowrieCommandInput:
+		fields["command"] = fields["input"]
+	case cowrieFileDownload:
+		fields["hash"] = fields["shasum"]
+	}
+
+	tags := []string{"cowrie", "honeypot"}
+	known, ok := cowrieEvents[eventID]
+	if ok {
+		tags = append(tags, known.tag)
+	}
+
+	return models.Event{
+		IP:       fields["src_ip"],
+		UUID:     fields["session"],
+		Rule:     eventID,
+		Priority: firstNonEmpty(d.priority, known.priority, defaultPriority),
+		Source:   TypeCowrie,
+		Tags:     tags,
+		Output:   fields["message"],
+		Hostname: fields["sensor"],
+		Time:     fields["timestamp"],
+		SourceIP: fields["dst_ip"],
+		Fields:   fields,
+		Raw:      data,
+	}, nil
+}
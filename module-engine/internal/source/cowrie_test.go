@@ -0,0 +1,121 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+func TestCowrieDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		priority  string // Пріоритет псевдоніма
+		data      string
+		wantRule  string
+		wantPrio  string
+		wantTags  []string
+		wantField map[string]string
+		wantErr   bool
+	}{
+		{
+			name:     "login failed",
+			data:     `{"eventid":"cowrie.login.failed","username":"root","password":"123456","message":"login attempt [root/123456] failed","sensor":"honeypot-1","timestamp":"2024-03-11T09:14:07.512843Z","src_ip":"198.51.100.23","session":"a1b2c3d4e5f6","dst_ip":"10.0.0.5"}`,
+			wantRule: "cowrie.login.failed",
+			wantPrio: "notice",
+			wantTags: []string{"cowrie", "honeypot", "login"},
+			wantField: map[string]string{
+				"username": "root",
+				"password": "123456",
+			},
+		},
+		{
+			name:     "login success",
+			data:     `{"eventid":"cowrie.login.success","username":"root","password":"admin","src_ip":"198.51.100.23","session":"a1b2c3d4e5f6"}`,
+			wantRule: "cowrie.login.success",
+			wantPrio: "critical",
+			wantTags: []string{"cowrie", "honeypot", "login"},
+			wantField: map[string]string{
+				"username": "root",
+				"password": "admin",
+			},
+		},
+		{
+			name:     "command input",
+			data:     `{"eventid":"cowrie.command.input","input":"uname -a; cat /proc/cpuinfo","src_ip":"198.51.100.23","session":"a1b2c3d4e5f6"}`,
+			wantRule: "cowrie.command.input",
+			wantPrio: "warning",
+			wantTags: []string{"cowrie", "honeypot", "command"},
+			wantField: map[string]string{
+				"command": "uname -a; cat /proc/cpuinfo",
+				"input":   "uname -a; cat /proc/cpuinfo",
+			},
+		},
+		{
+			name:     "file download",
+			data:     `{"eventid":"cowrie.session.file_download","url":"http://203.0.113.50/x.sh","shasum":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08","outfile":"var/lib/cowrie/downloads/9f86d0","src_ip":"198.51.100.23","session":"a1b2c3d4e5f6"}`,
+			wantRule: "cowrie.session.file_download",
+			wantPrio: "error",
+			wantTags: []string{"cowrie", "honeypot", "download"},
+			wantField: map[string]string{
+				"hash": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+				"url":  "http://203.0.113.50/x.sh",
+			},
+		},
+		{
+			name:     "other event with alias priority",
+			priority: "info",
+			data:     `{"eventid":"cowrie.session.connect","src_ip":"198.51.100.23","src_port":51544,"dst_port":2222,"session":"a1b2c3d4e5f6"}`,
+			wantRule: "cowrie.session.connect",
+			wantPrio: "info",
+			wantTags: []string{"cowrie", "honeypot"},
+			wantField: map[string]string{
+				"src_port": "51544",
+				"dst_port": "2222",
+			},
+		},
+		{
+			name:     "HEC envelope",
+			data:     `{"time":1710148447,"host":"honeypot-1","sourcetype":"cowrie","index":"honeypot","event":{"eventid":"cowrie.login.failed","username":"admin","src_ip":"198.51.100.23","session":"a1b2c3d4e5f6"}}`,
+			wantRule: "cowrie.login.failed",
+			wantPrio: "notice",
+			wantTags: []string{"cowrie", "honeypot", "login"},
+			wantField: map[string]string{
+				"username": "admin",
+			},
+		},
+		{name: "envelope with text event", data: `{"event":"cowrie.login.failed","src_ip":"198.51.100.23"}`, wantErr: true},
+		{name: "no eventid", data: `{"src_ip":"198.51.100.23","session":"a1b2c3d4e5f6"}`, wantErr: true},
+		{name: "foreign eventid", data: `{"eventid":"dionaea.connection","src_ip":"198.51.100.23"}`, wantErr: true},
+		{name: "not json", data: `2024-03-11T09:14:07Z [HoneyPotSSHTransport] login attempt`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New(config.Alias{Source: TypeCowrie, Priority: tt.priority})
+			if err != nil {
+				t.Fatal(err)
+			}
+			event, err := d.Decode([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if event.IP != "198.51.100.23" || event.UUID != "a1b2c3d4e5f6" || event.Source != TypeCowrie {
+				t.Errorf("IP = %q, UUID = %q, Source = %q", event.IP, event.UUID, event.Source)
+			}
+			if event.Rule != tt.wantRule || event.Priority != tt.wantPrio {
+				t.Errorf("Rule = %q, Priority = %q; want %q, %q", event.Rule, event.Priority, tt.wantRule, tt.wantPrio)
+			}
+			if !reflect.DeepEqual(event.Tags, tt.wantTags) {
+				t.Errorf("Tags = %v, want %v", event.Tags, tt.wantTags)
+			}
+			for name, want := range tt.wantField {
+				if got := event.Fields[name]; got != want {
+					t.Errorf("Fields[%s] = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
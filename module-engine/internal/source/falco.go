@@ -0,0 +1,19 @@
+package source
+
+import (
+	"encoding/json"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Декодер JSON-виводу Falco (http_output) та вебхука falcosidekick
+type falcoDecoder struct{}
+
+// Декодування події Falco; суб'єкт події визначає кожен сценарій
+func (d *falcoDecoder) Decode(data []byte) (models.Event, error) {
+	var falcoEvent models.FalcoEvent
+	if err := json.Unmarshal(data, &falcoEvent); err != nil {
+		return models.Event{}, err
+	}
+	return falcoEvent.Event(data), nil
+}
@@ -0,0 +1,143 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Правило за замовчуванням для потоків Hubble
+const defaultHubbleRule = "Hubble flow"
+
+// Декодер потоків Hubble. Поля події мають ті ж назви, що й у плагіні hubble для Falco
+// (hubble.source_ip, hubble.verdict тощо), тому сценарії працюють з обома джерелами
+type hubbleDecoder struct {
+	rule     string // Назва правила для подій
+	priority string // Пріоритет подій
+}
+
+// Відповідь GetFlows у форматі JSON: потік разом з назвою вузла
+type hubbleResponse struct {
+	Flow     *hubbleFlow `json:"flow"`
+	NodeName string      `json:"node_name"`
+	Time     string      `json:"time"`
+}
+
+// Потік Hubble (observer.Flow у JSON-представленні)
+type hubbleFlow struct {
+	Time    string `json:"time"`
+	UUID    string `json:"uuid"`
+	Verdict string `json:"verdict"`
+	IP      struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		IPVersion   string `json:"ipVersion"`
+	} `json:"IP"`
+	L4 struct {
+		TCP  *hubblePorts `json:"TCP"`
+		UDP  *hubblePorts `json:"UDP"`
+		SCTP *hubblePorts `json:"SCTP"`
+	} `json:"l4"`
+	Source      hubbleEndpoint `json:"source"`
+	Destination hubbleEndpoint `json:"destination"`
+	Type        string         `json:"Type"`
+	NodeName    string         `json:"node_name"`
+	EventType   struct {
+		Type    int `json:"type"`
+		SubType int `json:"sub_type"`
+	} `json:"event_type"`
+	TrafficDirection string `json:"traffic_direction"`
+	DropReasonDesc   string `json:"drop_reason_desc"`
+	IsReply          bool   `json:"is_reply"`
+	Summary          string `json:"Summary"`
+}
+
+// Порти транспортного рівня
+type hubblePorts struct {
+	SourcePort      int `json:"source_port"`
+	DestinationPort int `json:"destination_port"`
+}
+
+// Кінцева точка потоку (под у кластері)
+type hubbleEndpoint struct {
+	Namespace string   `json:"namespace"`
+	PodName   string   `json:"pod_name"`
+	Labels    []string `json:"labels"`
+}
+
+// Декодування потоку: приймається як відповідь GetFlows ({"flow": ...}), так і сам потік
+func (d *hubbleDecoder) Decode(data []byte) (models.Event, error) {
+	var resp hubbleResponse
+	if err := unmarshal(data, &resp); err != nil {
+		return models.Event{}, err
+	}
+	flow := resp.Flow
+	if flow == nil {
+		flow = &hubbleFlow{}
+		if err := unmarshal(data, flow); err != nil {
+			return models.Event{}, err
+		}
+	}
+	if flow.IP.Source == "" && flow.IP.Destination == "" {
+		return models.Event{}, errors.New("потік не містить IP-адрес")
+	}
+
+	protocol, ports := flow.ports()
+	fields := map[string]string{
+		"hubble.event_type":            fmt.Sprint(flow.EventType.Type),
+		"hubble.source_ip":             flow.IP.Source,
+		"hubble.destination_ip":        flow.IP.Destination,
+		"hubble.traffic_direction":     flow.TrafficDirection,
+		"hubble.flow_type":             flow.Type,
+		"hubble.pod_name":              flow.Destination.PodName,
+		"hubble.verdict":               flow.Verdict,
+		"hubble.summary":               flow.Summary,
+		"hubble.drop_reason":           flow.DropReasonDesc,
+		"hubble.protocol":              protocol,
+		"hubble.source_namespace":      flow.Source.Namespace,
+		"hubble.source_pod":            flow.Source.PodName,
+		"hubble.destination_namespace": flow.Destination.Namespace,
+		"hubble.is_reply":              fmt.Sprint(flow.IsReply),
+	}
+	if ports != nil {
+		fields["hubble.source_port"] = fmt.Sprint(ports.SourcePort)
+		fields["hubble.destination_port"] = fmt.Sprint(ports.DestinationPort)
+	}
+
+	tags := []string{"network", "hubble"}
+	if flow.Verdict != "" {
+		tags = append(tags, strings.ToLower(flow.Verdict))
+	}
+
+	nodeName := firstNonEmpty(flow.NodeName, resp.NodeName)
+	return models.Event{
+		IP:       flow.IP.Source, // Ініціатор з'єднання
+		UUID:     flow.UUID,
+		Rule:     firstNonEmpty(d.rule, defaultHubbleRule),
+		Priority: firstNonEmpty(d.priority, defaultPriority),
+		Source:   TypeHubble,
+		Tags:     tags,
+		Output:   fmt.Sprintf("%s %s -> %s (%s) %s", flow.Verdict, flow.IP.Source, flow.IP.Destination, flow.TrafficDirection, flow.Summary),
+		Hostname: nodeName,
+		Result:   flow.Verdict,
+		Time:     firstNonEmpty(flow.Time, resp.Time),
+		SourceIP: flow.IP.Destination,
+		Fields:   fields,
+		Raw:      data,
+	}, nil
+}
+
+// Протокол та порти потоку
+func (f *hubbleFlow) ports() (string, *hubblePorts) {
+	switch {
+	case f.L4.TCP != nil:
+		return "TCP", f.L4.TCP
+	case f.L4.UDP != nil:
+		return "UDP", f.L4.UDP
+	case f.L4.SCTP != nil:
+		return "SCTP", f.L4.SCTP
+	}
+	return "", nil
+}
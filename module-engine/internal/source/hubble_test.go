@@ -0,0 +1,112 @@
+package source
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+func TestHubbleDecode(t *testing.T) {
+	observed, err := os.ReadFile("testdata/hubble_observe.json") // Рядок виводу hubble observe -o json
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		alias     config.Alias
+		data      string
+		wantIP    string
+		wantRule  string
+		wantPrio  string
+		wantTags  []string
+		wantHost  string
+		wantTime  string
+		wantField map[string]string
+		wantErr   bool
+	}{
+		{
+			name:     "hubble observe",
+			data:     strings.TrimSpace(string(observed)),
+			wantIP:   "198.51.100.23",
+			wantRule: "Hubble flow",
+			wantPrio: "notice",
+			wantTags: []string{"network", "hubble", "dropped"},
+			wantHost: "gke-honeypot-pool-1-2f4b",
+			wantTime: "2024-03-11T09:14:07.512843210Z",
+			wantField: map[string]string{
+				"hubble.source_ip":             "198.51.100.23",
+				"hubble.destination_ip":        "10.244.1.17",
+				"hubble.verdict":               "DROPPED",
+				"hubble.drop_reason":           "POLICY_DENIED",
+				"hubble.protocol":              "TCP",
+				"hubble.source_port":           "51544",
+				"hubble.destination_port":      "22",
+				"hubble.traffic_direction":     "INGRESS",
+				"hubble.event_type":            "1",
+				"hubble.pod_name":              "cowrie-7d9c6b5f4-xk2lp",
+				"hubble.destination_namespace": "honeypot",
+				"hubble.is_reply":              "false",
+			},
+		},
+		{
+			name:     "bare flow with alias rule and priority",
+			alias:    config.Alias{Source: TypeHubble, Rule: "Honeypot UDP", Priority: "warning"},
+			data:     `{"time":"2024-03-11T09:15:00Z","verdict":"FORWARDED","IP":{"source":"203.0.113.5","destination":"10.244.1.17"},"l4":{"UDP":{"source_port":5353,"destination_port":53}},"node_name":"node-a","is_reply":true}`,
+			wantIP:   "203.0.113.5",
+			wantRule: "Honeypot UDP",
+			wantPrio: "warning",
+			wantTags: []string{"network", "hubble", "forwarded"},
+			wantHost: "node-a",
+			wantTime: "2024-03-11T09:15:00Z",
+			wantField: map[string]string{
+				"hubble.protocol":         "UDP",
+				"hubble.destination_port": "53",
+				"hubble.is_reply":         "true",
+			},
+		},
+		{
+			name:     "flow without l4 and verdict",
+			data:     `{"flow":{"IP":{"source":"2001:db8::7","destination":"2001:db8::1"}}}`,
+			wantIP:   "2001:db8::7",
+			wantRule: "Hubble flow",
+			wantPrio: "notice",
+			wantTags: []string{"network", "hubble"},
+			wantField: map[string]string{
+				"hubble.protocol":    "",
+				"hubble.source_port": "",
+			},
+		},
+		{name: "no addresses", data: `{"flow":{"verdict":"DROPPED"}}`, wantErr: true},
+		{name: "not json", data: `hubble: connection refused`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &hubbleDecoder{rule: tt.alias.Rule, priority: tt.alias.Priority}
+			event, err := d.Decode([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if event.IP != tt.wantIP || event.Rule != tt.wantRule || event.Priority != tt.wantPrio || event.Source != TypeHubble {
+				t.Errorf("event = %s/%s/%s/%s", event.IP, event.Rule, event.Priority, event.Source)
+			}
+			if !reflect.DeepEqual(event.Tags, tt.wantTags) {
+				t.Errorf("Tags = %v, want %v", event.Tags, tt.wantTags)
+			}
+			if event.Hostname != tt.wantHost || event.Time != tt.wantTime {
+				t.Errorf("Hostname = %q, Time = %q", event.Hostname, event.Time)
+			}
+			for name, want := range tt.wantField {
+				if got := event.Fields[name]; got != want {
+					t.Errorf("Fields[%s] = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
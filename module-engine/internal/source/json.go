@@ -0,0 +1,106 @@
+package source
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Декодер довільного JSON. Поля події задаються в конфігурації псевдоніма виразами JSONPath:
+// ip, uuid, rule, priority, source, tags, output, hostname, time, result та source_ip заповнюють
+// однойменні атрибути події, решта назв стають полями події для сценаріїв
+type jsonDecoder struct {
+	rule     string               // Правило, якщо його немає в події
+	priority string               // Пріоритет, якщо його немає в події
+	paths    map[string]*jsonPath // Вирази JSONPath за назвою поля
+	names    []string             // Назви полів у детермінованому порядку
+}
+
+// Створення декодера з перевіркою виразів JSONPath
+func newJSONDecoder(alias config.Alias) (*jsonDecoder, error) {
+	d := &jsonDecoder{
+		rule:     alias.Rule,
+		priority: alias.Priority,
+		paths:    make(map[string]*jsonPath, len(alias.Fields)),
+	}
+	for name, expr := range alias.Fields {
+		path, err := compilePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		d.paths[name] = path
+		d.names = append(d.names, name)
+	}
+	sort.Strings(d.names)
+	if d.rule == "" && d.paths["rule"] == nil {
+		return nil, errors.New("для джерела json потрібно вказати rule або поле rule у fields")
+	}
+	return d, nil
+}
+
+// Декодування події за відповідністю полів
+func (d *jsonDecoder) Decode(data []byte) (models.Event, error) {
+	var doc interface{}
+	if err := unmarshal(data, &doc); err != nil {
+		return models.Event{}, err
+	}
+
+	fields := make(map[string]string, len(d.names))
+	var tags []string
+	for _, name := range d.names {
+		value, ok := d.paths[name].Lookup(doc)
+		if !ok {
+			continue
+		}
+		// Теги можуть бути масивом або рядком через кому
+		if name == "tags" {
+			tags = tagList(value)
+		}
+		if s, ok := models.FieldString(value); ok {
+			fields[name] = s
+		}
+	}
+
+	event := models.Event{
+		IP:       fields["ip"],
+		UUID:     fields["uuid"],
+		Rule:     firstNonEmpty(fields["rule"], d.rule),
+		Priority: firstNonEmpty(fields["priority"], d.priority, defaultPriority),
+		Source:   firstNonEmpty(fields["source"], TypeJSON),
+		Tags:     tags,
+		Output:   fields["output"],
+		Hostname: fields["hostname"],
+		Result:   fields["result"],
+		Time:     fields["time"],
+		SourceIP: fields["source_ip"],
+		Fields:   fields,
+		Raw:      data,
+	}
+	if event.Rule == "" {
+		return models.Event{}, errors.New("подія не містить правила")
+	}
+	return event, nil
+}
+
+// Список тегів зі значення JSON
+func tagList(value interface{}) []string {
+	var tags []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := models.FieldString(item); ok && s != "" {
+				tags = append(tags, s)
+			}
+		}
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,137 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+)
+
+// Псевдонім джерела json з типовою відповідністю полів
+var jsonAlias = config.Alias{
+	Source:   TypeJSON,
+	Rule:     "Honeypot JSON",
+	Priority: "warning",
+	Fields: map[string]string{
+		"ip":       "$.src.ip",
+		"rule":     "$.alert.signature",
+		"priority": "$.alert.severity",
+		"tags":     "$.tags",
+		"hostname": "$['host-name']",
+		"port":     "$.src.port",
+		"first":    "$.hits[0].user",
+	},
+}
+
+func TestJSONDecode(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantIP     string
+		wantRule   string
+		wantPrio   string
+		wantTags   []string
+		wantHost   string
+		wantField  map[string]string
+		wantAbsent []string // Поля, шляхів яких немає в події
+		wantErr    bool
+	}{
+		{
+			name:     "all fields",
+			data:     `{"src":{"ip":"203.0.113.7","port":2222},"alert":{"signature":"SSH brute force","severity":"critical"},"tags":["ssh","brute"],"host-name":"sensor-1","hits":[{"user":"root"}]}`,
+			wantIP:   "203.0.113.7",
+			wantRule: "SSH brute force",
+			wantPrio: "critical",
+			wantTags: []string{"ssh", "brute"},
+			wantHost: "sensor-1",
+			wantField: map[string]string{
+				"port":  "2222",
+				"first": "root",
+				"rule":  "SSH brute force",
+			},
+		},
+		{
+			name:       "missing fields fall back to alias rule and priority",
+			data:       `{"src":{"ip":"203.0.113.8"}}`,
+			wantIP:     "203.0.113.8",
+			wantRule:   "Honeypot JSON",
+			wantPrio:   "warning",
+			wantAbsent: []string{"rule", "priority", "tags", "hostname", "port", "first"},
+		},
+		{
+			name:     "comma separated tags and numeric priority",
+			data:     `{"src":{"ip":"203.0.113.9"},"alert":{"severity":3},"tags":"ssh, ,brute ,"}`,
+			wantIP:   "203.0.113.9",
+			wantRule: "Honeypot JSON",
+			wantPrio: "3",
+			wantTags: []string{"ssh", "brute"},
+		},
+		{
+			name:       "wrong types are skipped",
+			data:       `{"src":"203.0.113.10","hits":{"user":"root"},"tags":42}`,
+			wantRule:   "Honeypot JSON",
+			wantPrio:   "warning",
+			wantAbsent: []string{"ip", "first"},
+		},
+		{name: "not json", data: `src=203.0.113.7`, wantErr: true},
+	}
+	d, err := New(jsonAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := d.Decode([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if event.IP != tt.wantIP || event.Rule != tt.wantRule || event.Priority != tt.wantPrio || event.Source != TypeJSON {
+				t.Errorf("event = %q/%q/%q/%q", event.IP, event.Rule, event.Priority, event.Source)
+			}
+			if !reflect.DeepEqual(event.Tags, tt.wantTags) {
+				t.Errorf("Tags = %#v, want %#v", event.Tags, tt.wantTags)
+			}
+			if event.Hostname != tt.wantHost {
+				t.Errorf("Hostname = %q, want %q", event.Hostname, tt.wantHost)
+			}
+			for name, want := range tt.wantField {
+				if got := event.Fields[name]; got != want {
+					t.Errorf("Fields[%s] = %q, want %q", name, got, want)
+				}
+			}
+			for _, name := range tt.wantAbsent {
+				if got, ok := event.Fields[name]; ok {
+					t.Errorf("Fields[%s] = %q, want absent", name, got)
+				}
+			}
+		})
+	}
+}
+
+// Без правила події та псевдоніма декодер не створюється, а подія без правила відхиляється
+func TestJSONRule(t *testing.T) {
+	if _, err := New(config.Alias{Source: TypeJSON, Fields: map[string]string{"ip": "$.ip"}}); err == nil {
+		t.Error("decoder without rule created")
+	}
+	if _, err := New(config.Alias{Source: TypeJSON, Rule: "x", Fields: map[string]string{"ip": "ip"}}); err == nil {
+		t.Error("decoder with malformed path created")
+	}
+
+	d, err := New(config.Alias{Source: TypeJSON, Fields: map[string]string{"ip": "$.ip", "rule": "$.rule", "source": "$.sensor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Decode([]byte(`{"ip":"203.0.113.7"}`)); err == nil {
+		t.Error("event without rule accepted")
+	}
+	event, err := d.Decode([]byte(`{"ip":"203.0.113.7","rule":"Port scan","sensor":"suricata"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Rule != "Port scan" || event.Priority != "notice" || event.Source != "suricata" {
+		t.Errorf("event = %q/%q/%q", event.Rule, event.Priority, event.Source)
+	}
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Крок шляху JSONPath: ключ об'єкта або індекс масиву
+type pathStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// Скомпільований вираз JSONPath. Підтримується підмножина синтаксису:
+// $.a.b, $['a-b'], $["a.b"], $.items[0]
+type jsonPath struct {
+	expr  string
+	steps []pathStep
+}
+
+// Розбір виразу JSONPath
+func compilePath(expr string) (*jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("вираз JSONPath %q має починатися з $", expr)
+	}
+	p := &jsonPath{expr: expr}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			// Ключ до наступної крапки або дужки
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("порожній ключ у виразі JSONPath %q", expr)
+			}
+			p.steps = append(p.steps, pathStep{key: rest[:end], isKey: true})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("незакрита дужка у виразі JSONPath %q", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.steps = append(p.steps, pathStep{key: inner[1 : len(inner)-1], isKey: true})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("невірний індекс %q у виразі JSONPath %q", inner, expr)
+			}
+			p.steps = append(p.steps, pathStep{index: index})
+		default:
+			return nil, fmt.Errorf("невірний синтаксис виразу JSONPath %q", expr)
+		}
+	}
+	return p, nil
+}
+
+// Значення за шляхом у декодованому JSON; false, якщо шлях не існує
+func (p *jsonPath) Lookup(doc interface{}) (interface{}, bool) {
+	current := doc
+	for _, step := range p.steps {
+		if step.isKey {
+			obj, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = obj[step.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		arr, ok := current.([]interface{})
+		if !ok || step.index >= len(arr) {
+			return nil, false
+		}
+		current = arr[step.index]
+	}
+	return current, true
+}
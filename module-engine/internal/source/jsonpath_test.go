@@ -0,0 +1,76 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompilePath(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []pathStep
+		wantErr bool
+	}{
+		{expr: "$", want: nil},
+		{expr: "$.a.b", want: []pathStep{{key: "a", isKey: true}, {key: "b", isKey: true}}},
+		{expr: "$['a-b']", want: []pathStep{{key: "a-b", isKey: true}}},
+		{expr: `$["a.b"].c`, want: []pathStep{{key: "a.b", isKey: true}, {key: "c", isKey: true}}},
+		{expr: "$.items[0].ip", want: []pathStep{{key: "items", isKey: true}, {index: 0}, {key: "ip", isKey: true}}},
+		{expr: "$[2][10]", want: []pathStep{{index: 2}, {index: 10}}},
+		{expr: "a.b", wantErr: true},
+		{expr: "$.", wantErr: true},
+		{expr: "$.a..b", wantErr: true},
+		{expr: "$.a[0", wantErr: true},
+		{expr: "$.a[-1]", wantErr: true},
+		{expr: "$.a[*]", wantErr: true},
+		{expr: "$['a]", wantErr: true},
+		{expr: "$a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := compilePath(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compilePath(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(p.steps, tt.want) {
+				t.Errorf("steps = %+v, want %+v", p.steps, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathLookup(t *testing.T) {
+	var doc interface{}
+	if err := unmarshal([]byte(`{"src":{"ip":"203.0.113.7","port":22},"a.b":"dotted","tags":["ssh","brute"],"hits":[{"ip":"198.51.100.1"}],"empty":null}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr   string
+		want   interface{}
+		wantOK bool
+	}{
+		{expr: "$.src.ip", want: "203.0.113.7", wantOK: true},
+		{expr: "$['src']['ip']", want: "203.0.113.7", wantOK: true},
+		{expr: `$["a.b"]`, want: "dotted", wantOK: true},
+		{expr: "$.tags[1]", want: "brute", wantOK: true},
+		{expr: "$.hits[0].ip", want: "198.51.100.1", wantOK: true},
+		{expr: "$.empty", want: nil, wantOK: true},
+		{expr: "$.src.user", wantOK: false},
+		{expr: "$.tags[2]", wantOK: false},
+		{expr: "$.src[0]", wantOK: false},
+		{expr: "$.tags.first", wantOK: false},
+		{expr: "$.src.ip.octet", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := compilePath(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := p.Lookup(doc)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
+)
+
+// Типи джерел подій
+const (
+	TypeFalco  = "falco"  // JSON-вивід Falco або вебхук falcosidekick
+	TypeHubble = "hubble" // Потоки Hubble у форматі JSON (hubble observe -o json)
+	TypeCowrie = "cowrie" // JSON-лог подій Cowrie
+	TypeJSON   = "json"   // Довільний JSON з відповідністю полів через JSONPath
+)
+
+// Пріоритет подій за замовчуванням для джерел без власного пріоритету
+const defaultPriority = "notice"
+
+// Інтерфейс декодера: перетворює одну подію джерела у внутрішню подію
+type Decoder interface {
+	Decode(data []byte) (models.Event, error)
+}
+
+// Створення декодера для псевдоніма відповідно до типу джерела
+func New(alias config.Alias) (Decoder, error) {
+	switch alias.Source {
+	case "", TypeFalco:
+		return &falcoDecoder{}, nil
+	case TypeHubble:
+		return &hubbleDecoder{rule: alias.Rule, priority: alias.Priority}, nil
+	case TypeCowrie:
+		return &cowrieDecoder{priority: alias.Priority}, nil
+	case TypeJSON:
+		return newJSONDecoder(alias)
+	default:
+		return nil, fmt.Errorf("невідомий тип джерела %q", alias.Source)
+	}
+}
+
+// Декодування JSON зі збереженням точності чисел
+func unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Перше непорожнє значення
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Інтервал перевірки файлу на нові рядки
+var tailInterval = time.Second
+
+// Читання нових рядків файлу (наприклад, cowrie.json) з урахуванням ротації та обрізання.
+// Читання починається з кінця файлу; кожен повний рядок передається у handle
+func TailFile(ctx context.Context, path string, handle func(line []byte)) {
+	var (
+		file   *os.File
+		reader *bufio.Reader
+		offset int64
+		buf    []byte // Незавершений рядок, що очікує на символ нового рядка
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+
+	first := true // Для першого відкриття пропускається наявний вміст
+	for {
+		if file == nil {
+			f, err := os.Open(path)
+			if err != nil {
+				if first {
+					log.Printf("Файл %s недоступний, очікування: %v", path, err)
+				}
+			} else {
+				if first {
+					offset, _ = f.Seek(0, io.SeekEnd)
+				} else {
+					offset = 0
+				}
+				file, reader, buf = f, bufio.NewReader(f), nil
+				log.Printf("Читання подій з файлу %s", path)
+			}
+			first = false
+		}
+
+		if file != nil {
+			// Читання всіх доступних повних рядків
+			for {
+				chunk, err := reader.ReadBytes('\n')
+				offset += int64(len(chunk))
+				buf = append(buf, chunk...)
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						log.Printf("Помилка читання файлу %s: %v", path, err)
+					}
+					break
+				}
+				if line := bytes.TrimSpace(buf); len(line) > 0 {
+					handle(line)
+				}
+				buf = nil
+			}
+
+			// Ротація (файл замінено) або обрізання: читання з початку нового вмісту
+			if info, err := os.Stat(path); err != nil || rotated(file, info, offset) {
+				file.Close()
+				file, reader = nil, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Перевірка, чи файл за шляхом відрізняється від відкритого або став коротшим
+func rotated(file *os.File, info os.FileInfo, offset int64) bool {
+	current, err := file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(current, info) || info.Size() < offset
+}
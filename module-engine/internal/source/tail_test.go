@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTailFile(t *testing.T) {
+	interval := tailInterval
+	tailInterval = 5 * time.Millisecond
+	t.Cleanup(func() { tailInterval = interval })
+
+	path := filepath.Join(t.TempDir(), "cowrie.json")
+	write := func(flag int, data string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(os.O_TRUNC, "{\"existing\":1}\n")
+
+	lines := make(chan string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		TailFile(ctx, path, func(line []byte) { lines <- string(line) })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				if got != w {
+					t.Fatalf("line = %q, want %q", got, w)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("line %q not read", w)
+			}
+		}
+		select {
+		case got := <-lines:
+			t.Fatalf("unexpected line %q", got)
+		case <-time.After(20 * tailInterval):
+		}
+	}
+	time.Sleep(20 * tailInterval) // Файл відкрито, наявний вміст пропущено
+
+	// Нові рядки, порожні рядки та рядок, дописаний частинами
+	write(os.O_APPEND, "{\"n\":1}\n\n{\"n\":")
+	expect(`{"n":1}`)
+	write(os.O_APPEND, "2}\n")
+	expect(`{"n":2}`)
+
+	// Обрізання: читання продовжується з початку файлу
+	write(os.O_TRUNC, "{\"n\":3}\n")
+	expect(`{"n":3}`)
+
+	// Ротація перейменуванням: залишок старого файлу дочитується, новий читається з початку
+	write(os.O_APPEND, "{\"n\":4}\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_EXCL, "{\"n\":5}\n")
+	expect(`{"n":4}`, `{"n":5}`)
+	write(os.O_APPEND, "{\"n\":6}\n")
+	expect(`{"n":6}`)
+}
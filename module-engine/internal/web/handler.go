@@ -1,19 +1,29 @@
 package web
 
 import (
+	"bytes"
+	"encoding/json"
+	"expvar"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
 	"github.com/vzinenko-set/SETMaster/module-engine/internal/scenario"
+	"github.com/vzinenko-set/SETMaster/module-engine/pkg/models"
 )
 
 // Структура для відображення записів блокування зі статусом
 type BlockRecordWithStatus struct {
 	ID            int    // Ідентифікатор запису
+	Scenario      string // Сценарій, до якого відноситься запис
 	IP            string // IP-адреса
 	Status        string // Поточний статус (Заблоковано/Не заблоковано)
 	BlockedAt     string // Час початку блокування
@@ -35,8 +45,48 @@ func StartDashboard(port int, db *db.SQLiteDB, mgr *scenario.Manager) {
 	mux := http.NewServeMux()                                     // Створення нового HTTP-мультиплексора
 	mux.HandleFunc("/", d.dashboardHandler)                       // Реєстрація обробника головної сторінки
 	mux.HandleFunc("/unblock", d.unblockHandler)                  // Реєстрація обробника розблокування
+	mux.HandleFunc("/ip", d.ipHandler)                            // Реєстрація обробника сторінки подій IP
+	mux.HandleFunc("/allowlist", d.allowlistHandler)              // Сторінка списку дозволених
+	mux.HandleFunc("/allowlist/add", d.allowlistAddHandler)       // Додавання запису до списку дозволених
+	mux.HandleFunc("/allowlist/delete", d.allowlistDeleteHandler) // Видалення запису зі списку дозволених
+	mux.HandleFunc("/networks", d.networksHandler)                // Сторінка об'єднаних блокувань мереж
+	mux.Handle("/debug/vars", expvar.Handler())                   // Лічильники (відхилені запити тощо)
 	log.Printf("Dashboard starting on :%d", port)                 // Логування запуску дашборда
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), mux)) // Запуск HTTP-сервера
+
+	// Запуск HTTP-сервера; форми дашборда приймаються лише з його власних сторінок
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), sameOrigin(mux)))
+}
+
+// Захист форм дашборда від підробки міжсайтових запитів (CSRF). Браузер додає до запиту заголовок
+// Sec-Fetch-Site або Origin, тому POST, надісланий сторінкою іншого сайту, відхиляється.
+// Запити без цих заголовків надходять не від браузера (curl, скрипти) і пропускаються
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !isSameOrigin(r) {
+			log.Printf("Rejected cross-origin %s %s from %s (Origin %q, Sec-Fetch-Site %q)",
+				r.Method, r.URL.Path, r.RemoteAddr, r.Header.Get("Origin"), r.Header.Get("Sec-Fetch-Site"))
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Перевірка, чи надіслано запит зі сторінки самого дашборда
+func isSameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none": // Сторінка дашборда або адреса, введена користувачем
+		return true
+	case "":
+	default: // same-site, cross-site
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
 }
 
 // Обробка HTTP-запитів для відображення дашборда
@@ -50,35 +100,8 @@ func (d *Dashboard) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 	currentTime := time.Now().Unix()              // Поточний час у форматі Unix timestamp
 	var recordsWithStatus []BlockRecordWithStatus // Слайс для зберігання записів зі статусами
 	for _, record := range records {
-		status := "Not Blocked" // За замовчуванням IP не заблоковано
-		if record.BlockedAt > 0 && record.UnblockAfter > currentTime {
-			status = "Blocked" // Якщо час блокування активний, статус "Заблоковано"
-		}
-
-		blockedAt := "N/A" // Значення за замовчуванням для часу блокування
-		if record.BlockedAt > 0 {
-			blockedAt = time.Unix(record.BlockedAt, 0).Format("2006-01-02 15:04:05") // Форматування часу блокування
-		}
-		unblockAfter := "N/A" // Значення за замовчуванням для часу розблокування
-		if record.UnblockAfter > 0 {
-			unblockAfter = time.Unix(record.UnblockAfter, 0).Format("2006-01-02 15:04:05") // Форматування часу розблокування
-		}
-		lastEventTime := "N/A" // Значення за замовчуванням для часу останньої події
-		if record.LastEventTime > 0 {
-			lastEventTime = time.Unix(record.LastEventTime, 0).Format("2006-01-02 15:04:05") // Форматування часу останньої події
-		}
-
 		// Додавання запису зі статусом до слайсу
-		recordsWithStatus = append(recordsWithStatus, BlockRecordWithStatus{
-			ID:            record.ID,
-			IP:            record.IP,
-			Status:        status,
-			BlockedAt:     blockedAt,
-			UnblockAfter:  unblockAfter,
-			BlockCount:    record.BlockCount,
-			TriggerCount:  record.TriggerCount,
-			LastEventTime: lastEventTime,
-		})
+		recordsWithStatus = append(recordsWithStatus, recordWithStatus(record, currentTime))
 	}
 
 	// Парсинг HTML-шаблону для веб-сторінки
@@ -90,6 +113,134 @@ func (d *Dashboard) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, recordsWithStatus) // Виконання шаблону з переданими даними
 }
 
+// Перетворення запису бази даних у запис для відображення
+func recordWithStatus(record models.BlockRecord, currentTime int64) BlockRecordWithStatus {
+	status := "Not Blocked" // За замовчуванням IP не заблоковано
+	if record.BlockedAt > 0 && record.UnblockAfter > currentTime {
+		status = "Blocked" // Якщо час блокування активний, статус "Заблоковано"
+	}
+
+	blockedAt := "N/A" // Значення за замовчуванням для часу блокування
+	if record.BlockedAt > 0 {
+		blockedAt = time.Unix(record.BlockedAt, 0).Format("2006-01-02 15:04:05") // Форматування часу блокування
+	}
+	unblockAfter := "N/A" // Значення за замовчуванням для часу розблокування
+	if record.UnblockAfter > 0 {
+		unblockAfter = time.Unix(record.UnblockAfter, 0).Format("2006-01-02 15:04:05") // Форматування часу розблокування
+	}
+	lastEventTime := "N/A" // Значення за замовчуванням для часу останньої події
+	if record.LastEventTime > 0 {
+		lastEventTime = time.Unix(record.LastEventTime, 0).Format("2006-01-02 15:04:05") // Форматування часу останньої події
+	}
+
+	return BlockRecordWithStatus{
+		ID:            record.ID,
+		Scenario:      record.Scenario,
+		IP:            record.IP,
+		Status:        status,
+		BlockedAt:     blockedAt,
+		UnblockAfter:  unblockAfter,
+		BlockCount:    record.BlockCount,
+		TriggerCount:  record.TriggerCount,
+		LastEventTime: lastEventTime,
+	}
+}
+
+// Структура для відображення збереженої події
+type EventView struct {
+	Scenario string // Сценарій, яким оброблено подію
+	Rule     string // Правило Falco
+	Priority string // Пріоритет події
+	Output   string // Текстовий опис події
+	Hostname string // Хост, на якому зафіксовано подію
+	Tags     string // Теги правила
+	Time     string // Час отримання події
+	Raw      string // Відформатований JSON події
+}
+
+// Рішення у сповіщенні для відображення на сторінці IP
+type DecisionView struct {
+	Time       string // Час рішення
+	Scenario   string // Сценарій інциденту
+	IncidentID string // Інцидент
+	Action     string // Обрана дія
+	User       string // Хто прийняв рішення
+}
+
+// Дані сторінки з деталями IP
+type IPPage struct {
+	IP        string                  // IP-адреса
+	Records   []BlockRecordWithStatus // Стан IP у кожному сценарії
+	Events    []EventView             // Події, що враховувалися сценаріями
+	Decisions []DecisionView          // Рішення, прийняті у сповіщеннях
+}
+
+// Обробка HTTP-запитів для сторінки з усіма подіями, що призвели до блокування IP
+func (d *Dashboard) ipHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.URL.Query().Get("ip") // Отримання IP-адреси з параметрів запиту
+	if ip == "" {
+		http.Error(w, "IP not provided", http.StatusBadRequest) // Помилка, якщо IP не вказано
+		return
+	}
+
+	records, err := d.db.GetRecordsByIP(ip) // Стан IP у всіх сценаріях
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	events, err := d.db.GetEventsByIP(ip) // Події для IP
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	decisions, err := d.db.GetDecisionsByIP(ip) // Рішення у сповіщеннях для IP
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	page := IPPage{IP: ip}
+	currentTime := time.Now().Unix()
+	for _, record := range records {
+		page.Records = append(page.Records, recordWithStatus(record, currentTime))
+	}
+	for _, e := range events {
+		raw := e.Raw
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, []byte(e.Raw), "", "  ") == nil {
+			raw = pretty.String() // Форматування JSON для читабельності
+		}
+		page.Events = append(page.Events, EventView{
+			Scenario: e.Scenario,
+			Rule:     e.Rule,
+			Priority: e.Priority,
+			Output:   e.Output,
+			Hostname: e.Hostname,
+			Tags:     strings.Join(e.Tags, ", "),
+			Time:     time.Unix(e.Time, 0).Format("2006-01-02 15:04:05"),
+			Raw:      raw,
+		})
+	}
+
+	for _, dec := range decisions {
+		page.Decisions = append(page.Decisions, DecisionView{
+			Time:       time.Unix(dec.Time, 0).Format("2006-01-02 15:04:05"),
+			Scenario:   dec.Scenario,
+			IncidentID: dec.IncidentID,
+			Action:     d.scenario.ActionLabel(dec.Scenario, dec.Action),
+			User:       dec.User,
+		})
+	}
+
+	// Парсинг HTML-шаблону сторінки IP
+	tmpl, err := template.ParseFiles("internal/web/templates/ip.html")
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError) // Помилка при збої шаблону
+		return
+	}
+	tmpl.Execute(w, page) // Виконання шаблону з переданими даними
+}
+
 // unblockHandler - обробник HTTP-запитів для ручного розблокування IP
 func (d *Dashboard) unblockHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -103,8 +254,14 @@ func (d *Dashboard) unblockHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Manual unblock requested for IP %s", ip) // Логування запиту на розблокування
-	err := d.scenario.ManualUnblock(ip)                  // Виклик методу ручного розблокування
+	scenarioName := r.FormValue("scenario") // Отримання сценарію, в якому заблоковано IP
+	if scenarioName == "" {
+		http.Error(w, "Scenario not provided", http.StatusBadRequest) // Помилка, якщо сценарій не вказано
+		return
+	}
+
+	log.Printf("Manual unblock requested for IP %s in scenario %s", ip, scenarioName) // Логування запиту на розблокування
+	err := d.scenario.ManualUnblock(scenarioName, ip)                                 // Виклик методу ручного розблокування
 	if err != nil {
 		log.Printf("Failed to manually unblock IP %s: %v", ip, err)           // Логування помилки
 		http.Error(w, "Failed to unblock IP", http.StatusInternalServerError) // Помилка при збої розблокування
@@ -113,3 +270,136 @@ func (d *Dashboard) unblockHandler(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, "/", http.StatusSeeOther) // Перенаправлення на головну сторінку
 }
+
+// Запис списку дозволених для відображення
+type AllowlistEntryView struct {
+	ID      int    // Ідентифікатор запису
+	Value   string // IP-адреса, CIDR або ім'я хоста
+	Comment string // Причина додавання
+	AddedBy string // Хто додав запис
+	Time    string // Час додавання
+}
+
+// Дані сторінки списку дозволених
+type AllowlistPage struct {
+	Entries []AllowlistEntryView // Записи з бази даних (можна редагувати)
+	Static  []string             // Записи конфігурації
+	Error   string               // Помилка додавання запису
+}
+
+// Сторінка списку дозволених
+func (d *Dashboard) allowlistHandler(w http.ResponseWriter, r *http.Request) {
+	d.renderAllowlist(w, "")
+}
+
+// Виведення сторінки списку дозволених
+func (d *Dashboard) renderAllowlist(w http.ResponseWriter, errText string) {
+	entries, err := d.db.GetAllowlist()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	page := AllowlistPage{Static: d.scenario.Allowlist().Static(), Error: errText}
+	for _, e := range entries {
+		page.Entries = append(page.Entries, AllowlistEntryView{
+			ID:      e.ID,
+			Value:   e.Value,
+			Comment: e.Comment,
+			AddedBy: e.AddedBy,
+			Time:    time.Unix(e.Time, 0).Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	tmpl, err := template.ParseFiles("internal/web/templates/allowlist.html")
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, page)
+}
+
+// Додавання запису до списку дозволених
+func (d *Dashboard) allowlistAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	value, err := allowlist.Validate(r.FormValue("value"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		d.renderAllowlist(w, err.Error())
+		return
+	}
+	entry := models.AllowlistEntry{
+		Value:   value,
+		Comment: r.FormValue("comment"),
+		AddedBy: "dashboard",
+		Time:    time.Now().Unix(),
+	}
+	if err := d.scenario.Allowlist().Add(entry); err != nil {
+		log.Printf("Failed to add %s to allowlist: %v", value, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Allowlist entry %s added from dashboard", value)
+	http.Redirect(w, r, "/allowlist", http.StatusSeeOther)
+}
+
+// Видалення запису зі списку дозволених
+func (d *Dashboard) allowlistDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := d.scenario.Allowlist().Delete(id); err != nil {
+		log.Printf("Failed to delete allowlist entry %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Allowlist entry %d removed from dashboard", id)
+	http.Redirect(w, r, "/allowlist", http.StatusSeeOther)
+}
+
+// Блокування мережі для відображення разом з адресами, які до неї увійшли
+type NetworkView struct {
+	BlockRecordWithStatus
+	Members []string // Адреси мережі з записами в тому ж сценарії
+}
+
+// Сторінка блокувань мереж, створених об'єднанням блокувань окремих адрес
+func (d *Dashboard) networksHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := d.db.GetAllRecords()
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	currentTime := time.Now().Unix()
+	var networks []NetworkView
+	for _, record := range records {
+		prefix, err := netip.ParsePrefix(record.IP)
+		if err != nil {
+			continue // Запис окремої адреси
+		}
+		view := NetworkView{BlockRecordWithStatus: recordWithStatus(record, currentTime)}
+		for _, member := range records {
+			addr, err := netip.ParseAddr(member.IP)
+			if err == nil && member.Scenario == record.Scenario && prefix.Contains(addr) {
+				view.Members = append(view.Members, member.IP)
+			}
+		}
+		networks = append(networks, view)
+	}
+
+	tmpl, err := template.ParseFiles("internal/web/templates/networks.html")
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, networks)
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/actioner"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/allowlist"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/config"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/db"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/notifier"
+	"github.com/vzinenko-set/SETMaster/module-engine/internal/scenario"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"page view from another site", http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+		{"dashboard form", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://dashboard:8080"}, http.StatusOK},
+		{"origin only", http.MethodPost, map[string]string{"Origin": "http://dashboard:8080"}, http.StatusOK},
+		{"non-browser client", http.MethodPost, nil, http.StatusOK},
+		{"cross-site form", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"same-site subdomain", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://other.dashboard:8080"}, http.StatusForbidden},
+		{"foreign origin without fetch metadata", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"other port", http.MethodPost, map[string]string{"Origin": "http://dashboard:9090"}, http.StatusForbidden},
+		{"opaque origin", http.MethodPost, map[string]string{"Origin": "null"}, http.StatusForbidden},
+	}
+	handler := sameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://dashboard:8080/allowlist/add", strings.NewReader("value=203.0.113.7"))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// Зміни списку дозволених на дашборді одразу враховуються під час перевірки подій
+func TestAllowlistFormUpdatesMatcher(t *testing.T) {
+	store, err := db.NewSQLiteDB(filepath.Join(t.TempDir(), "blocks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	allow, err := allowlist.New(cfg.Allowlist, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Dashboard{db: store, scenario: scenario.NewManager(cfg, map[string]actioner.Actioner{}, store, map[string]notifier.Notifier{}, allow)}
+	post := func(handler http.HandlerFunc, form url.Values) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/allowlist", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if _, ok := allow.Match("203.0.113.7"); ok {
+		t.Fatal("address allowed before it was added")
+	}
+	post(d.allowlistAddHandler, url.Values{"value": {"203.0.113.0/24"}, "comment": {"scanner"}})
+	if _, ok := allow.Match("203.0.113.7"); !ok {
+		t.Fatal("entry added on the dashboard not matched")
+	}
+
+	entries, err := store.GetAllowlist()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("entries = %+v, %v", entries, err)
+	}
+	post(d.allowlistDeleteHandler, url.Values{"id": {strconv.Itoa(entries[0].ID)}})
+	if _, ok := allow.Match("203.0.113.7"); ok {
+		t.Error("entry removed on the dashboard still matched")
+	}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Поле з IP-адресою атакуючого за замовчуванням
+const DefaultSubjectField = "fd.rip"
+
+// Структура події у форматі JSON-виводу Falco (json_output: true)
+type FalcoEvent struct {
+	UUID         string       `json:"uuid"`          // Унікальний ідентифікатор події
+	Output       string       `json:"output"`        // Текстовий опис події
+	Priority     string       `json:"priority"`      // Пріоритет події
+	Rule         string       `json:"rule"`          // Назва правила
+	Time         string       `json:"time"`          // Час події у форматі RFC3339
+	Source       string       `json:"source"`        // Джерело події (syscall, k8s_audit, плагін)
+	Tags         []string     `json:"tags"`          // Теги правила
+	Hostname     string       `json:"hostname"`      // Хост, на якому працює Falco
+	OutputFields OutputFields `json:"output_fields"` // Поля, використані у виводі правила
+}
+
+// Поля output_fields: значення можуть бути рядками, числами, логічними значеннями, масивами або null
+type OutputFields map[string]interface{}
+
+// Декодування output_fields зі збереженням точності цілих чисел (порти, PID, розміри)
+func (f *OutputFields) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return err
+	}
+	*f = fields
+	return nil
+}
+
+// Значення поля у текстовому вигляді; false, якщо поле відсутнє або дорівнює null
+func (f OutputFields) String(key string) (string, bool) {
+	value, ok := f[key]
+	if !ok {
+		return "", false
+	}
+	return FieldString(value)
+}
+
+// Текстове представлення значення JSON, декодованого з UseNumber; false для null
+func FieldString(value interface{}) (string, bool) {
+	if value == nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprintf("%t", v), true
+	case []interface{}:
+		// Списки (наприклад, proc.aname) об'єднуються через кому
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), true
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+}
+
+// Перетворення у внутрішню подію; IP береться з поля fd.rip, сценарії можуть обрати інше поле
+func (f FalcoEvent) Event(raw []byte) Event {
+	fields := make(map[string]string, len(f.OutputFields))
+	for key := range f.OutputFields {
+		if value, ok := f.OutputFields.String(key); ok {
+			fields[key] = value
+		}
+	}
+	return Event{
+		IP:       fields[DefaultSubjectField],
+		UUID:     f.UUID,
+		Rule:     f.Rule,
+		Priority: f.Priority,
+		Source:   f.Source,
+		Tags:     f.Tags,
+		Output:   f.Output,
+		Hostname: f.Hostname,
+		Result:   fields["evt.res"],
+		Time:     f.Time,
+		SourceIP: fields["fd.sip"],
+		Fields:   fields,
+		Raw:      raw,
+	}
+}
@@ -2,21 +2,74 @@ package models
 
 // Структура отриманої інформаційної події
 type Event struct {
-	IP       string `json:"ip"`
+	IP       string `json:"ip"` // Суб'єкт події: IP-адреса або інше значення поля, обраного сценарієм
+	UUID     string
 	Rule     string
+	Priority string
+	Source   string
+	Tags     []string
+	Output   string
+	Hostname string
 	Result   string
 	Time     string
 	SourceIP string
+	Fields   map[string]string // Поля output_fields у текстовому вигляді
+	Raw      []byte            // Повний JSON події в тому вигляді, в якому його отримано
+}
+
+// Значення поля події за назвою (наприклад, fd.rip або user.name)
+func (e Event) Field(name string) string {
+	return e.Fields[name]
+}
+
+// Структура збереженої події, що враховувалася сценарієм
+type EventRecord struct {
+	ID       int      // Ідентифікатор події
+	Scenario string   // Сценарій, яким оброблено подію
+	IP       string   // IP-адреса з події
+	Rule     string   // Правило Falco
+	Priority string   // Пріоритет події
+	Output   string   // Текстовий опис події
+	Hostname string   // Хост, на якому зафіксовано подію
+	Tags     []string // Теги правила
+	Time     int64    // Час отримання події
+	Raw      string   // Повний JSON події
 }
 
 // Структура запису в базу
 type BlockRecord struct {
-	ID            int    //  Ідентифікатор запису
-	IP            string // IP-адреса з інформаційного потоку
-	BlockedAt     int64  // Час початку блокування ІР
-	UnblockAfter  int64  // Час розблокування ІР
-	BlockCount    int    // Лічильник циклів блокуань
-	TriggerCount  int    // Кількість подій повязаних з ІР
-	LastEventTime int64  // Час останньої події
-	ActionTaken   bool   // Інформація про блокування
+	ID            int      //  Ідентифікатор запису
+	Scenario      string   // Сценарій, до якого відноситься запис
+	IP            string   // IP-адреса з інформаційного потоку
+	BlockedAt     int64    // Час початку блокування ІР
+	UnblockAfter  int64    // Час розблокування ІР
+	BlockCount    int      // Лічильник циклів блокуань
+	TriggerCount  int      // Кількість подій повязаних з ІР у ковзному вікні
+	LastEventTime int64    // Час останньої події
+	ActionTaken   bool     // Інформація про блокування
+	Actioners     []string // Діячі, що були успішно виконані для поточного блокування
+	NotifiedAt    int64    // Час надсилання сповіщення, що очікує на вибір дії
+	MessageTS     string   // Часова мітка (ts) повідомлення в Slack
+	ResetAt       int64    // Час останнього скидання лічильника; події до нього не враховуються (у майбутньому, якщо сповіщення відкладено)
+	IncidentID    string   // Ідентифікатор поточного інциденту (спрацювання сценарію)
+}
+
+// Рішення, прийняте у сповіщенні про інцидент
+type Decision struct {
+	ID         int    // Ідентифікатор рішення
+	IncidentID string // Інцидент, для якого обрано дію
+	Scenario   string // Сценарій інциденту
+	IP         string // Суб'єкт сценарію
+	Action     string // Обрана дія: діяч, all, dismiss, snooze або allowlist
+	User       string // Користувач, який обрав дію
+	Time       int64  // Час прийняття рішення
+}
+
+// Запис списку дозволених: події для нього не активують сценаріїв
+type AllowlistEntry struct {
+	ID      int    // Ідентифікатор запису
+	Value   string // IP-адреса або інший суб'єкт
+	Comment string // Причина додавання
+	AddedBy string // Хто додав запис
+	Time    int64  // Час додавання
 }